@@ -0,0 +1,3 @@
+-- One database per service, mirroring the per-service Mongo databases
+CREATE DATABASE orders;
+CREATE DATABASE payments;
@@ -0,0 +1,79 @@
+// Package apierror writes the error bodies returned to clients as RFC 7807
+// problem details (application/problem+json). Every body carries the
+// request and trace IDs so support can find the failing request.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+// ContentType is the media type of error responses
+const ContentType = "application/problem+json"
+
+// Problem is the JSON shape of an error response
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Error repeats Detail for clients written against the older
+	// {"error": "..."} bodies
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+}
+
+// New returns the problem for status and msg in the context of a request
+func New(ctx context.Context, status int, msg string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    msg,
+		Error:     msg,
+		RequestID: requestid.FromContext(ctx),
+		TraceID:   tracing.TraceID(ctx),
+	}
+}
+
+// Gin aborts the request with status and a problem body
+func Gin(c *gin.Context, status int, msg string) {
+	GinBody(c, status, New(c.Request.Context(), status, msg))
+}
+
+// GinBody aborts the request with status and body, which should embed a
+// Problem when a handler needs extension members
+func GinBody(c *gin.Context, status int, body any) {
+	c.Abort()
+	c.Render(status, problemRender{body})
+}
+
+// Write sends status and a problem body from a net/http handler
+func Write(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(New(r.Context(), status, msg)); err != nil {
+		log.Printf("write error: %v", err)
+	}
+}
+
+// problemRender is gin's JSON renderer with the problem content type
+type problemRender struct {
+	body any
+}
+
+func (p problemRender) Render(w http.ResponseWriter) error {
+	p.WriteContentType(w)
+	return json.NewEncoder(w).Encode(p.body)
+}
+
+func (p problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+}
@@ -0,0 +1,113 @@
+// Package buildinfo reports what a binary was built from: its version, git
+// commit, build time and whether the working tree had uncommitted changes.
+//
+// Go records the commit, commit time and dirty flag itself when building
+// inside a git checkout, but not the build time. Docker builds have no .git,
+// so the Dockerfiles pass all of them in with ldflags, which take precedence:
+//
+//	go build -ldflags "-X github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo.version=v1.4.0
+//	  -X github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo.commit=$(git rev-parse HEAD)
+//	  -X github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+//	  -X github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo.dirty=false"
+package buildinfo
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+)
+
+// Path is the endpoint served by Handler
+const Path = "/version"
+
+// Set with -ldflags "-X ...". Empty values fall back to the build info Go
+// embeds in the binary.
+var (
+	version   string
+	commit    string
+	buildTime string
+	dirty     string
+)
+
+// Info describes a build
+type Info struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	Dirty      bool   `json:"dirty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// Short is the version followed by the abbreviated commit, e.g.
+// "v1.4.0 (3f2a9c1)", with "-dirty" if the tree had local changes
+func (i Info) Short() string {
+	s := i.Version
+	if c := i.Commit; c != "" {
+		if len(c) > 7 {
+			c = c[:7]
+		}
+		if i.Dirty {
+			c += "-dirty"
+		}
+		s += " (" + c + ")"
+	}
+	return s
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the running binary's build info
+func Get() Info {
+	once.Do(func() { info = read() })
+	return info
+}
+
+func read() Info {
+	i := Info{Version: "devel", GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if v := bi.Main.Version; v != "" && v != "(devel)" {
+			i.Version = v
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				i.Commit = s.Value
+			case "vcs.time":
+				i.CommitTime = s.Value
+			case "vcs.modified":
+				i.Dirty = s.Value == "true"
+			}
+		}
+	}
+	if version != "" {
+		i.Version = version
+	}
+	if commit != "" {
+		i.Commit = commit
+	}
+	if buildTime != "" {
+		i.BuildTime = buildTime
+	}
+	if dirty != "" {
+		i.Dirty, _ = strconv.ParseBool(dirty)
+	}
+	return i
+}
+
+// Handler serves the build info of the running binary as JSON
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Get()); err != nil {
+			log.Printf("encode error: %v", err)
+		}
+	})
+}
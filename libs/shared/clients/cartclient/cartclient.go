@@ -0,0 +1,153 @@
+// Package cartclient is a typed client for the cart service, written
+// against services/cart/openapi.yaml. Every call acts on the caller's own
+// cart; through the gateway, pass the user's token with clients.WithToken.
+package cartclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// Line is a product in the cart, priced from the catalog. Available is
+// false for products that can no longer be ordered.
+type Line struct {
+	ProductID string      `json:"product_id"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	LineTotal money.Money `json:"line_total"`
+	Available bool        `json:"available"`
+}
+
+// Cart is the caller's cart at the catalog's current prices. The totals are
+// zero while it holds nothing that can be ordered; CouponError says why the
+// coupon takes nothing off, if it doesn't.
+type Cart struct {
+	Items       []Line      `json:"items"`
+	Coupon      string      `json:"coupon,omitempty"`
+	CouponError string      `json:"coupon_error,omitempty"`
+	Subtotal    money.Money `json:"subtotal"`
+	Discount    money.Money `json:"discount"`
+	Total       money.Money `json:"total"`
+	UpdatedAt   time.Time   `json:"updated_at,omitzero"`
+	ExpiresAt   time.Time   `json:"expires_at,omitzero"`
+}
+
+// Checkout statuses
+const (
+	CheckoutRunning   = "running"
+	CheckoutCompleted = "completed"
+	CheckoutFailed    = "failed"
+)
+
+// CheckoutItem is a product and quantity that was checked out
+type CheckoutItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Checkout places an order for a cart and takes its payment. Once the
+// payment with PaymentID completes the order is confirmed; if it fails or
+// isn't made by PaymentDue the order is cancelled.
+type Checkout struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`
+	Items       []CheckoutItem `json:"items"`
+	Coupon      string         `json:"coupon,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Status      string         `json:"status"`
+	// Step is the next step of a running checkout
+	Step       string       `json:"step,omitempty"`
+	OrderID    string       `json:"order_id,omitempty"`
+	PaymentID  string       `json:"payment_id,omitempty"`
+	Amount     *money.Money `json:"amount,omitempty"`
+	PaymentDue *time.Time   `json:"payment_due,omitempty"`
+	// Error says why the checkout failed or is being undone
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Client calls the cart service
+type Client struct {
+	c *clients.Client
+}
+
+// New returns a client for the cart service, or the gateway, at baseURL
+func New(baseURL string, opts ...clients.Option) *Client {
+	return &Client{c: clients.New(baseURL, opts...)}
+}
+
+// Get returns the cart, which is empty if the caller has none
+func (c *Client) Get(ctx context.Context) (*Cart, error) {
+	return c.cart(ctx, http.MethodGet, "/cart", nil)
+}
+
+// Clear empties the cart and removes its coupon
+func (c *Client) Clear(ctx context.Context) error {
+	return c.c.Do(ctx, http.MethodDelete, "/cart", nil, nil, nil)
+}
+
+// AddItem adds quantity of a product to the cart
+func (c *Client) AddItem(ctx context.Context, productID string, quantity int) (*Cart, error) {
+	body := map[string]any{"product_id": productID, "quantity": quantity}
+	return c.cart(ctx, http.MethodPost, "/cart/items", body)
+}
+
+// UpdateItem sets the quantity of a product already in the cart
+func (c *Client) UpdateItem(ctx context.Context, productID string, quantity int) (*Cart, error) {
+	body := map[string]int{"quantity": quantity}
+	return c.cart(ctx, http.MethodPut, "/cart/items/"+url.PathEscape(productID), body)
+}
+
+// RemoveItem takes a product out of the cart
+func (c *Client) RemoveItem(ctx context.Context, productID string) (*Cart, error) {
+	return c.cart(ctx, http.MethodDelete, "/cart/items/"+url.PathEscape(productID), nil)
+}
+
+// ApplyCoupon applies a coupon from the catalog. Unknown and expired codes
+// fail with 400 Bad Request.
+func (c *Client) ApplyCoupon(ctx context.Context, code string) (*Cart, error) {
+	return c.cart(ctx, http.MethodPut, "/cart/coupon", map[string]string{"code": code})
+}
+
+// RemoveCoupon removes the cart's coupon
+func (c *Client) RemoveCoupon(ctx context.Context) (*Cart, error) {
+	return c.cart(ctx, http.MethodDelete, "/cart/coupon", nil)
+}
+
+// Checkout checks out the cart: it places an order, empties the cart and
+// creates a pending payment for the order. If the orders service refuses
+// the order, its error is returned and the cart is kept. A checkout still
+// running after a failed step is returned with no error, as with 202
+// Accepted.
+func (c *Client) Checkout(ctx context.Context, description string) (*Checkout, error) {
+	var chk Checkout
+	body := map[string]string{"description": description}
+	if err := c.c.Do(ctx, http.MethodPost, "/cart/checkout", nil, body, &chk); err != nil {
+		return nil, err
+	}
+	return &chk, nil
+}
+
+// GetCheckout returns one of the caller's checkouts
+func (c *Client) GetCheckout(ctx context.Context, id string) (*Checkout, error) {
+	var chk Checkout
+	if err := c.c.Do(ctx, http.MethodGet, "/cart/checkouts/"+url.PathEscape(id), nil, nil, &chk); err != nil {
+		return nil, err
+	}
+	return &chk, nil
+}
+
+func (c *Client) cart(ctx context.Context, method, path string, body any) (*Cart, error) {
+	var cart Cart
+	if err := c.c.Do(ctx, method, path, nil, body, &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
@@ -0,0 +1,263 @@
+// Package catalogclient is a typed client for the catalog service, written
+// against services/catalog/openapi.yaml. Reading the catalog needs no token;
+// managing it needs a catalog admin's token, passed with clients.WithToken.
+// The reservation methods reach the catalog service directly, as the orders
+// service does; the gateway doesn't route them.
+package catalogclient
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// MaxLookup is the most products Lookup fetches in one request
+const MaxLookup = 100
+
+// Product is something that can be ordered
+type Product struct {
+	ID          string      `json:"id"`
+	SKU         string      `json:"sku"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	Active      bool        `json:"active"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// CreateProductRequest adds a product. Active defaults to true.
+type CreateProductRequest struct {
+	SKU         string      `json:"sku"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Price       money.Money `json:"price"`
+	Active      *bool       `json:"active,omitempty"`
+}
+
+// UpdateProductRequest changes a product; nil fields are left as they are
+type UpdateProductRequest struct {
+	Name        *string      `json:"name,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Price       *money.Money `json:"price,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+}
+
+// ErrCouponCurrency is returned by Coupon.Discount for an amount off in a
+// different currency from the subtotal
+var ErrCouponCurrency = errors.New("coupon is for a different currency")
+
+// Coupon takes a percentage or a fixed amount off a subtotal
+type Coupon struct {
+	Code       string       `json:"code"`
+	PercentOff int          `json:"percent_off,omitempty"`
+	AmountOff  *money.Money `json:"amount_off,omitempty"`
+	Active     bool         `json:"active"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// Valid reports whether the coupon is accepted at now
+func (c *Coupon) Valid(now time.Time) bool {
+	return c.Active && (c.ExpiresAt == nil || now.Before(*c.ExpiresAt))
+}
+
+// Discount returns what the coupon takes off subtotal, never more than
+// subtotal. A percentage is rounded down to the minor unit.
+func (c *Coupon) Discount(subtotal money.Money) (money.Money, error) {
+	if c.AmountOff == nil {
+		return money.New(subtotal.Minor()*int64(c.PercentOff)/100, subtotal.Currency())
+	}
+	if c.AmountOff.Currency() != subtotal.Currency() {
+		return money.Money{}, ErrCouponCurrency
+	}
+	if c.AmountOff.Minor() > subtotal.Minor() {
+		return subtotal, nil
+	}
+	return *c.AmountOff, nil
+}
+
+// PutCouponRequest creates or replaces a coupon. Set exactly one of
+// PercentOff and AmountOff; Active defaults to true.
+type PutCouponRequest struct {
+	PercentOff int          `json:"percent_off,omitempty"`
+	AmountOff  *money.Money `json:"amount_off,omitempty"`
+	Active     *bool        `json:"active,omitempty"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+}
+
+// Stock is a product's inventory
+type Stock struct {
+	ProductID string `json:"product_id"`
+	OnHand    int    `json:"on_hand"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+// ReservationItem is a quantity of one product to hold for an order
+type ReservationItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type reservationRequest struct {
+	Items []ReservationItem `json:"items"`
+}
+
+// ListOptions filters a listing
+type ListOptions struct {
+	// ActiveOnly leaves out products that can't be ordered
+	ActiveOnly bool
+	Limit      int
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.ActiveOnly {
+		q.Set("active", "true")
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return q
+}
+
+// Client calls the catalog service
+type Client struct {
+	c *clients.Client
+}
+
+// New returns a client for the catalog service, or the gateway, at baseURL
+func New(baseURL string, opts ...clients.Option) *Client {
+	return &Client{c: clients.New(baseURL, opts...)}
+}
+
+// List returns products ordered by SKU
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]Product, error) {
+	page, err := c.list(ctx, opts, "")
+	return page.Items, err
+}
+
+// All iterates over products ordered by SKU
+func (c *Client) All(ctx context.Context, opts ListOptions) iter.Seq2[Product, error] {
+	return clients.Iterate(ctx, func(ctx context.Context, cursor string) (clients.Page[Product], error) {
+		return c.list(ctx, opts, cursor)
+	})
+}
+
+func (c *Client) list(ctx context.Context, opts ListOptions, _ string) (clients.Page[Product], error) {
+	var products []Product
+	err := c.c.Do(ctx, http.MethodGet, "/products", opts.query(), nil, &products)
+	return clients.Page[Product]{Items: products}, err
+}
+
+// Lookup returns the products with the given IDs, active or not, in batches
+// of MaxLookup. IDs that aren't in the catalog are left out.
+func (c *Client) Lookup(ctx context.Context, ids []string) ([]Product, error) {
+	var products []Product
+	for batch := range slices.Chunk(ids, MaxLookup) {
+		var page []Product
+		q := url.Values{"ids": {strings.Join(batch, ",")}}
+		if err := c.c.Do(ctx, http.MethodGet, "/products", q, nil, &page); err != nil {
+			return nil, err
+		}
+		products = append(products, page...)
+	}
+	return products, nil
+}
+
+// Get returns one product
+func (c *Client) Get(ctx context.Context, id string) (*Product, error) {
+	var p Product
+	if err := c.c.Do(ctx, http.MethodGet, "/products/"+url.PathEscape(id), nil, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Create adds a product to the catalog
+func (c *Client) Create(ctx context.Context, req CreateProductRequest) (*Product, error) {
+	var p Product
+	if err := c.c.Do(ctx, http.MethodPost, "/products", nil, req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Update changes a product and returns it as updated
+func (c *Client) Update(ctx context.Context, id string, req UpdateProductRequest) (*Product, error) {
+	var p Product
+	if err := c.c.Do(ctx, http.MethodPatch, "/products/"+url.PathEscape(id), nil, req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Coupon returns the coupon with code, whether or not it is valid
+func (c *Client) Coupon(ctx context.Context, code string) (*Coupon, error) {
+	var coupon Coupon
+	if err := c.c.Do(ctx, http.MethodGet, "/coupons/"+url.PathEscape(code), nil, nil, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// PutCoupon creates or replaces a coupon
+func (c *Client) PutCoupon(ctx context.Context, code string, req PutCouponRequest) (*Coupon, error) {
+	var coupon Coupon
+	if err := c.c.Do(ctx, http.MethodPut, "/coupons/"+url.PathEscape(code), nil, req, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// Stock returns a product's stock
+func (c *Client) Stock(ctx context.Context, productID string) (*Stock, error) {
+	var st Stock
+	if err := c.c.Do(ctx, http.MethodGet, "/products/"+url.PathEscape(productID)+"/stock", nil, nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SetStock records how many of a product are on hand
+func (c *Client) SetStock(ctx context.Context, productID string, onHand int) (*Stock, error) {
+	var st Stock
+	body := map[string]int{"on_hand": onHand}
+	if err := c.c.Do(ctx, http.MethodPut, "/products/"+url.PathEscape(productID)+"/stock", nil, body, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Reserve holds items for an order until the catalog's hold TTL runs out.
+// If any item is short, nothing is held and the error has status 409.
+func (c *Client) Reserve(ctx context.Context, orderID string, items []ReservationItem) error {
+	return c.c.Do(ctx, http.MethodPut, "/reservations/"+url.PathEscape(orderID), nil, reservationRequest{items}, nil)
+}
+
+// ConfirmReservation keeps an order's holds until they are committed or
+// released, placing again any that expired. If the stock is gone the
+// order's holds are released and the error has status 409.
+func (c *Client) ConfirmReservation(ctx context.Context, orderID string, items []ReservationItem) error {
+	return c.c.Do(ctx, http.MethodPost, "/reservations/"+url.PathEscape(orderID)+"/confirm", nil, reservationRequest{items}, nil)
+}
+
+// CommitReservation takes an order's held stock off hand
+func (c *Client) CommitReservation(ctx context.Context, orderID string) error {
+	return c.c.Do(ctx, http.MethodPost, "/reservations/"+url.PathEscape(orderID)+"/commit", nil, nil, nil)
+}
+
+// ReleaseReservation drops an order's holds
+func (c *Client) ReleaseReservation(ctx context.Context, orderID string) error {
+	return c.c.Do(ctx, http.MethodDelete, "/reservations/"+url.PathEscape(orderID), nil, nil, nil)
+}
@@ -0,0 +1,270 @@
+// Package ordersclient is a typed client for the orders service, written
+// against services/orders/openapi.yaml. Through the gateway, pass the user's
+// token with clients.WithToken. Operator is the client for staff, whose
+// token must carry the operator role.
+package ordersclient
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// Order statuses
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusConfirmed = "confirmed"
+	StatusShipped   = "shipped"
+	StatusDelivered = "delivered"
+	StatusCancelled = "cancelled"
+)
+
+// OrderItem is one line of an order, with the product's name and price as
+// they were when it was placed
+type OrderItem struct {
+	ProductID   string      `json:"product_id"`
+	Name        string      `json:"name"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   money.Money `json:"unit_price"`
+	Description string      `json:"description,omitempty"`
+}
+
+// Order is an order placed by a user. Amount is what it costs once
+// Discount is taken off.
+type Order struct {
+	ID          string      `json:"id"`
+	UserID      string      `json:"user_id"`
+	Amount      money.Money `json:"amount"`
+	Discount    money.Money `json:"discount"`
+	Coupon      string      `json:"coupon,omitempty"`
+	Status      string      `json:"status"`
+	Items       []OrderItem `json:"items"`
+	Description string      `json:"description"`
+	CheckoutID  string      `json:"checkout_id,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// StatusChange is one entry in an order's history. The first records the
+// order's creation and has no From.
+type StatusChange struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Note is an internal remark staff keep on an order
+type Note struct {
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	At     time.Time `json:"at"`
+}
+
+// LineItem is a product and quantity to order; the price comes from the
+// catalog
+type LineItem struct {
+	ProductID   string `json:"product_id"`
+	Quantity    int    `json:"quantity"`
+	Description string `json:"description,omitempty"`
+}
+
+// CreateOrderRequest places an order. With a CheckoutID, repeating the
+// request returns the order it already placed.
+type CreateOrderRequest struct {
+	Items       []LineItem `json:"items"`
+	Coupon      string     `json:"coupon,omitempty"`
+	Description string     `json:"description,omitempty"`
+	CheckoutID  string     `json:"checkout_id,omitempty"`
+}
+
+// ListOptions filters a listing
+type ListOptions struct {
+	clients.PageOptions
+	// Statuses, if any, are the only ones listed
+	Statuses []string
+	// MinAmount and MaxAmount, if set, bound the amount inclusively and
+	// leave out orders in other currencies
+	MinAmount money.Money
+	MaxAmount money.Money
+}
+
+func (o ListOptions) query() url.Values {
+	q := o.PageOptions.Query(url.Values{})
+	if len(o.Statuses) > 0 {
+		q.Set("status", strings.Join(o.Statuses, ","))
+	}
+	if o.MinAmount.Currency() != "" {
+		q.Set("min_amount", o.MinAmount.Decimal())
+		q.Set("currency", o.MinAmount.Currency())
+	}
+	if o.MaxAmount.Currency() != "" {
+		q.Set("max_amount", o.MaxAmount.Decimal())
+		q.Set("currency", o.MaxAmount.Currency())
+	}
+	return q
+}
+
+// OperatorListOptions filters a listing of every customer's orders
+type OperatorListOptions struct {
+	ListOptions
+	// UserID, if set, lists only this customer's orders
+	UserID string
+	// ProductID, if set, lists only orders with an item of the product
+	ProductID string
+}
+
+func (o OperatorListOptions) query() url.Values {
+	q := o.ListOptions.query()
+	if o.UserID != "" {
+		q.Set("user_id", o.UserID)
+	}
+	if o.ProductID != "" {
+		q.Set("product_id", o.ProductID)
+	}
+	return q
+}
+
+// Client calls the orders service
+type Client struct {
+	c *clients.Client
+}
+
+// New returns a client for the orders service, or the gateway, at baseURL
+func New(baseURL string, opts ...clients.Option) *Client {
+	return &Client{c: clients.New(baseURL, opts...)}
+}
+
+// List returns a page of the user's orders, newest first unless
+// opts.Ascending
+func (c *Client) List(ctx context.Context, opts ListOptions) (clients.Page[Order], error) {
+	return clients.GetPage[Order](ctx, c.c, "/orders", opts.query())
+}
+
+// All iterates over the user's orders from the first page, fetching the
+// rest as they are needed
+func (c *Client) All(ctx context.Context, opts ListOptions) iter.Seq2[Order, error] {
+	return clients.Iterate(ctx, func(ctx context.Context, cursor string) (clients.Page[Order], error) {
+		opts.Cursor = cursor
+		return c.List(ctx, opts)
+	})
+}
+
+// Get returns one of the user's orders
+func (c *Client) Get(ctx context.Context, id string) (*Order, error) {
+	var order Order
+	if err := c.c.Do(ctx, http.MethodGet, "/orders/"+url.PathEscape(id), nil, nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Create places an order and returns it priced from the catalog. Unknown
+// and inactive products fail with 400 Bad Request.
+func (c *Client) Create(ctx context.Context, req CreateOrderRequest) (*Order, error) {
+	var order Order
+	if err := c.c.Do(ctx, http.MethodPost, "/orders", nil, req, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Cancel cancels an order that hasn't shipped, recording reason, which may
+// be empty, in its history
+func (c *Client) Cancel(ctx context.Context, id, reason string) error {
+	var body any
+	if reason != "" {
+		body = map[string]string{"reason": reason}
+	}
+	return c.c.Do(ctx, http.MethodPost, "/orders/"+url.PathEscape(id)+"/cancel", nil, body, nil)
+}
+
+// History returns an order's status changes, oldest first
+func (c *Client) History(ctx context.Context, id string) ([]StatusChange, error) {
+	var history []StatusChange
+	if err := c.c.Do(ctx, http.MethodGet, "/orders/"+url.PathEscape(id)+"/history", nil, nil, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Operator calls the orders service's operator endpoints, which act on every
+// customer's orders. Without the operator role they fail with 403
+// Forbidden.
+type Operator struct {
+	c *clients.Client
+}
+
+// NewOperator returns an operator client for the orders service, or the
+// gateway, at baseURL
+func NewOperator(baseURL string, opts ...clients.Option) *Operator {
+	return &Operator{c: clients.New(baseURL, opts...)}
+}
+
+// List returns a page of every customer's orders, newest first unless
+// opts.Ascending
+func (c *Operator) List(ctx context.Context, opts OperatorListOptions) (clients.Page[Order], error) {
+	return clients.GetPage[Order](ctx, c.c, "/operator/orders", opts.query())
+}
+
+// All iterates over every customer's orders from the first page, fetching
+// the rest as they are needed
+func (c *Operator) All(ctx context.Context, opts OperatorListOptions) iter.Seq2[Order, error] {
+	return clients.Iterate(ctx, func(ctx context.Context, cursor string) (clients.Page[Order], error) {
+		opts.Cursor = cursor
+		return c.List(ctx, opts)
+	})
+}
+
+// Get returns any customer's order
+func (c *Operator) Get(ctx context.Context, id string) (*Order, error) {
+	var order Order
+	if err := c.c.Do(ctx, http.MethodGet, "/operator/orders/"+url.PathEscape(id), nil, nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// History returns any customer's order's status changes, oldest first
+func (c *Operator) History(ctx context.Context, id string) ([]StatusChange, error) {
+	var history []StatusChange
+	if err := c.c.Do(ctx, http.MethodGet, "/operator/orders/"+url.PathEscape(id)+"/history", nil, nil, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// UpdateStatus moves an order to status, recording reason, which may be
+// empty, in its history. A move the order's lifecycle doesn't allow fails
+// with 409 Conflict.
+func (c *Operator) UpdateStatus(ctx context.Context, id, status, reason string) error {
+	body := map[string]string{"status": status, "reason": reason}
+	return c.c.Do(ctx, http.MethodPut, "/operator/orders/"+url.PathEscape(id)+"/status", nil, body, nil)
+}
+
+// AddNote adds an internal note to an order and returns it
+func (c *Operator) AddNote(ctx context.Context, id, text string) (*Note, error) {
+	var note Note
+	body := map[string]string{"text": text}
+	if err := c.c.Do(ctx, http.MethodPost, "/operator/orders/"+url.PathEscape(id)+"/notes", nil, body, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Notes returns an order's internal notes, oldest first
+func (c *Operator) Notes(ctx context.Context, id string) ([]Note, error) {
+	var notes []Note
+	if err := c.c.Do(ctx, http.MethodGet, "/operator/orders/"+url.PathEscape(id)+"/notes", nil, nil, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
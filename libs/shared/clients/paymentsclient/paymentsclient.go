@@ -0,0 +1,95 @@
+// Package paymentsclient is a typed client for the payments service, written
+// against services/payments/openapi.yaml. Through the gateway, pass the
+// user's token with clients.WithToken.
+package paymentsclient
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// Payment statuses
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+// Payment is a payment of an amount, optionally for an order
+type Payment struct {
+	ID        string      `json:"id"`
+	OrderID   string      `json:"order_id,omitempty"`
+	Amount    money.Money `json:"amount"`
+	Status    string      `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// PaymentRequest creates or replaces a payment. OrderID is only read on
+// create.
+type PaymentRequest struct {
+	Amount  money.Money `json:"amount"`
+	Status  string      `json:"status,omitempty"`
+	OrderID string      `json:"order_id,omitempty"`
+}
+
+// Client calls the payments service
+type Client struct {
+	c *clients.Client
+}
+
+// New returns a client for the payments service, or the gateway, at baseURL
+func New(baseURL string, opts ...clients.Option) *Client {
+	return &Client{c: clients.New(baseURL, opts...)}
+}
+
+// List returns a page of payments, newest first unless opts.Ascending
+func (c *Client) List(ctx context.Context, opts clients.PageOptions) (clients.Page[Payment], error) {
+	return clients.GetPage[Payment](ctx, c.c, "/payments", opts.Query(url.Values{}))
+}
+
+// All iterates over payments from the first page, fetching the rest as
+// they are needed
+func (c *Client) All(ctx context.Context, opts clients.PageOptions) iter.Seq2[Payment, error] {
+	return clients.Iterate(ctx, func(ctx context.Context, cursor string) (clients.Page[Payment], error) {
+		opts.Cursor = cursor
+		return c.List(ctx, opts)
+	})
+}
+
+// Get returns one payment
+func (c *Client) Get(ctx context.Context, id string) (*Payment, error) {
+	var p Payment
+	if err := c.c.Do(ctx, http.MethodGet, "/payments/"+url.PathEscape(id), nil, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Create creates a pending payment. Creating one for an order that already
+// has a payment of the same amount returns that payment.
+func (c *Client) Create(ctx context.Context, req PaymentRequest) (*Payment, error) {
+	var p Payment
+	if err := c.c.Do(ctx, http.MethodPost, "/payments", nil, req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Update replaces a payment's amount and status
+func (c *Client) Update(ctx context.Context, id string, req PaymentRequest) error {
+	return c.c.Do(ctx, http.MethodPut, "/payments/"+url.PathEscape(id), nil, req, nil)
+}
+
+// Delete deletes a payment
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, "/payments/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -0,0 +1,167 @@
+// Package deadline carries a request's deadline across service hops and
+// bounds each operation a handler performs.
+//
+// Outbound requests sent through Transport carry the time left before their
+// context's deadline in the X-Deadline-Budget-Ms header. Gin and Middleware
+// turn that budget back into a deadline on the incoming request's context,
+// so work a caller has given up on is cancelled downstream as well.
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+)
+
+// Header holds the caller's remaining budget in whole milliseconds
+const Header = "X-Deadline-Budget-Ms"
+
+// FromHeader returns the budget in h, if there is a well-formed one
+func FromHeader(h http.Header) (time.Duration, bool) {
+	v := h.Get(Header)
+	if v == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// withBudget applies the budget in r's headers to its context. It reports
+// false if the budget has already run out.
+func withBudget(r *http.Request) (*http.Request, context.CancelFunc, bool) {
+	budget, ok := FromHeader(r.Header)
+	if !ok {
+		return r, func() {}, true
+	}
+	if budget <= 0 {
+		return r, func() {}, false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	return r.WithContext(ctx), cancel, true
+}
+
+// Gin bounds the request context by the caller's budget, answering 504
+// straight away if none is left
+func Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, cancel, ok := withBudget(c.Request)
+		defer cancel()
+		if !ok {
+			apierror.Gin(c, http.StatusGatewayTimeout, "deadline exceeded before the request arrived")
+			return
+		}
+		c.Request = r
+		c.Next()
+	}
+}
+
+// Middleware is the net/http equivalent of Gin
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, cancel, ok := withBudget(r)
+		defer cancel()
+		if !ok {
+			apierror.Write(w, r, http.StatusGatewayTimeout, "deadline exceeded before the request arrived")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Transport sets Header on outbound requests whose context has a deadline,
+// replacing any budget copied from an incoming request
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base: base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	d, ok := req.Context().Deadline()
+	if !ok && req.Header.Get(Header) == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if ok {
+		left := max(time.Until(d).Milliseconds(), 0)
+		req.Header.Set(Header, strconv.FormatInt(left, 10))
+	} else {
+		req.Header.Del(Header)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Timeouts is how long each operation a service performs may take, keyed by
+// its OpenAPI operationId
+type Timeouts struct {
+	// Default applies to operations without an entry in Ops; zero means 5s
+	Default time.Duration
+	Ops     map[string]time.Duration
+}
+
+const defaultTimeout = 5 * time.Second
+
+// TimeoutsFromEnv reads the default from REQUEST_TIMEOUT (5s) and overrides
+// from REQUEST_TIMEOUT_<OPERATION>, e.g. REQUEST_TIMEOUT_LIST_ORDERS=2s for
+// listOrders
+func TimeoutsFromEnv() Timeouts {
+	t := Timeouts{
+		Default: shared.GetEnvDuration("REQUEST_TIMEOUT", defaultTimeout),
+		Ops:     make(map[string]time.Duration),
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if op, ok := strings.CutPrefix(key, "REQUEST_TIMEOUT_"); ok && op != "" {
+			t.Ops[op] = shared.GetEnvDuration(key, t.Default)
+		}
+	}
+	return t
+}
+
+// For returns the timeout for op
+func (t Timeouts) For(op string) time.Duration {
+	if d, ok := t.Ops[envName(op)]; ok && d > 0 {
+		return d
+	}
+	if d, ok := t.Ops[op]; ok && d > 0 {
+		return d
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return defaultTimeout
+}
+
+// Context bounds ctx by the timeout for op. The caller's deadline still
+// applies if it is sooner.
+func (t Timeouts) Context(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.For(op))
+}
+
+// envName turns an operationId such as listOrders into LIST_ORDERS
+func envName(op string) string {
+	var b strings.Builder
+	for i, r := range op {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,301 @@
+// Package events is the messaging layer between services: a Publisher and
+// a Subscriber over an event bus, the Envelope events travel in, and
+// consumer groups with retries and dead-lettering built in.
+//
+// The bus is chosen with EVENTS_BACKEND:
+//
+//	none    (default) no bus; Open returns nil
+//	memory  an in-process bus, for tests and single-process runs
+//	nats    NATS JetStream at NATS_URL (default nats://localhost:4222)
+//
+// Every member of a consumer group shares the group's events, so each event
+// is handled by one member. A handler that fails is retried with
+// exponential backoff; after RetryPolicy.MaxDeliveries the event is dead-
+// lettered instead. Delivery is at least once, so handlers should dedupe on
+// Envelope.ID, e.g. with an outbox.Deduplicator.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Envelope is an event on the bus
+type Envelope struct {
+	ID string `json:"id"`
+	// Type names what happened, e.g. "order.created". Subscribers select
+	// events by type.
+	Type string `json:"type"`
+	// Version is the version of Type's payload schema, starting at 1
+	Version int `json:"version"`
+	// Source is the service the event came from
+	Source string `json:"source"`
+	// Subject is the ID of what the event happened to, if any
+	Subject string `json:"subject,omitempty"`
+	// Sequence numbers the subject's events from 1, if the source counts
+	// them
+	Sequence int64     `json:"sequence,omitempty"`
+	Time     time.Time `json:"time"`
+	// TraceContext carries the publisher's trace, e.g. its traceparent, so
+	// handlers continue it
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	Payload      json.RawMessage   `json:"payload"`
+}
+
+// Context returns ctx carrying the trace the envelope was published in
+func (e Envelope) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.TraceContext))
+}
+
+// Type describes events of one type and payload version whose payload is a
+// T. It builds and reads their envelopes:
+//
+//	var OrderCreated = events.Type[Order]{Name: "order.created", Version: 1}
+//	env, err := OrderCreated.New(ctx, "orders", order.ID, order)
+//	order, err := OrderCreated.Decode(env)
+type Type[T any] struct {
+	Name    string
+	Version int
+}
+
+// New returns an envelope for payload from source, about subject, with the
+// trace active in ctx
+func (t Type[T]) New(ctx context.Context, source, subject string, payload T) (Envelope, error) {
+	id, err := ids.New(ids.Event)
+	if err != nil {
+		return Envelope{}, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		carrier = nil
+	}
+	return Envelope{
+		ID:           id,
+		Type:         t.Name,
+		Version:      t.Version,
+		Source:       source,
+		Subject:      subject,
+		Time:         time.Now().UTC(),
+		TraceContext: carrier,
+		Payload:      data,
+	}, nil
+}
+
+// ErrWrongType is returned (wrapped) by Type.Decode for an envelope of
+// another type or version
+var ErrWrongType = errors.New("events: wrong event type")
+
+// Decode returns e's payload, failing if e isn't of t's type and version
+func (t Type[T]) Decode(e Envelope) (T, error) {
+	var payload T
+	if e.Type != t.Name || e.Version != t.Version {
+		return payload, fmt.Errorf("%w: %s v%d is not %s v%d", ErrWrongType, e.Type, e.Version, t.Name, t.Version)
+	}
+	err := json.Unmarshal(e.Payload, &payload)
+	return payload, err
+}
+
+// Handle adapts h to a Handler for t's events
+func (t Type[T]) Handle(h func(ctx context.Context, payload T, e Envelope) error) Handler {
+	return func(ctx context.Context, e Envelope) error {
+		payload, err := t.Decode(e)
+		if err != nil {
+			return err
+		}
+		return h(ctx, payload, e)
+	}
+}
+
+// Handler handles an event. An error has the event redelivered, until the
+// group's retry policy dead-letters it.
+type Handler func(ctx context.Context, e Envelope) error
+
+// Publisher puts events on the bus
+type Publisher interface {
+	Publish(ctx context.Context, e Envelope) error
+}
+
+// Subscriber hands a consumer group the events it subscribes to
+type Subscriber interface {
+	// Subscribe adds a member running h to group g, returning once it is
+	// receiving events. A group sees the events published before it first
+	// subscribed as well as those after, where the bus keeps them.
+	Subscribe(ctx context.Context, g Group, h Handler) (Subscription, error)
+}
+
+// Subscription is one member of a consumer group
+type Subscription interface {
+	// Stop stops delivering events to the member, waiting for the one it is
+	// handling
+	Stop()
+}
+
+// Bus is an event bus
+type Bus interface {
+	Publisher
+	Subscriber
+	// Close stops every subscription and disconnects from the bus
+	Close() error
+}
+
+// Group is a consumer group: the members subscribing with the same Name
+// share its events. They must agree on its Types and Retry; the memory bus
+// refuses a member that doesn't with ErrGroupMismatch.
+type Group struct {
+	// Name identifies the group on the bus; letters, digits, - and _ only
+	Name string
+	// Types are the event types the group receives. A "*" element matches
+	// any one dot-separated element and a trailing ">" matches the rest, so
+	// "order.*" matches "order.created".
+	Types []string
+	Retry RetryPolicy
+}
+
+func (g Group) validate() error {
+	if g.Name == "" || strings.ContainsFunc(g.Name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) {
+		return fmt.Errorf("events: invalid group name %q", g.Name)
+	}
+	if len(g.Types) == 0 {
+		return fmt.Errorf("events: group %s subscribes to no types", g.Name)
+	}
+	return nil
+}
+
+// RetryPolicy says how often a failed event is redelivered to a group
+// before it is dead-lettered. Zero fields take the defaults.
+type RetryPolicy struct {
+	// MaxDeliveries bounds the deliveries of an event, the first included
+	// (default 5)
+	MaxDeliveries int
+	// Backoff is the delay before the first redelivery, doubled for each
+	// one after (default 1s)
+	Backoff time.Duration
+	// MaxBackoff caps the delay (default 1m)
+	MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxDeliveries <= 0 {
+		p.MaxDeliveries = 5
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = time.Minute
+	}
+	return p
+}
+
+// delay returns how long to wait before redelivering an event delivered
+// deliveries times
+func (p RetryPolicy) delay(deliveries int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < deliveries && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// DeadLetter is an event a group gave up on
+type DeadLetter struct {
+	Envelope   Envelope  `json:"envelope"`
+	Group      string    `json:"group"`
+	Deliveries int       `json:"deliveries"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+var handled = metrics.NewCounterVec(
+	"events_handled_total",
+	"Event deliveries to consumer groups, by outcome: \"ok\", \"retry\" or \"dead_letter\".",
+	"group", "type", "outcome",
+)
+
+// deliver runs h on e, delivered to g for the deliveries-th time, and says
+// what to do next: ack it, redeliver it after the returned delay, or dead-
+// letter it
+func deliver(ctx context.Context, g Group, h Handler, e Envelope, deliveries int) (retryAfter time.Duration, dead *DeadLetter) {
+	err := h(e.Context(ctx), e)
+	switch {
+	case err == nil:
+		handled.WithLabelValues(g.Name, e.Type, "ok").Inc()
+		return 0, nil
+	case deliveries < g.Retry.MaxDeliveries:
+		handled.WithLabelValues(g.Name, e.Type, "retry").Inc()
+		return g.Retry.delay(deliveries), nil
+	default:
+		handled.WithLabelValues(g.Name, e.Type, "dead_letter").Inc()
+		return 0, &DeadLetter{Envelope: e, Group: g.Name, Deliveries: deliveries, Error: err.Error(), FailedAt: time.Now().UTC()}
+	}
+}
+
+// matches reports whether typ is selected by pattern, with NATS subject
+// wildcards
+func matches(pattern, typ string) bool {
+	pats, elems := strings.Split(pattern, "."), strings.Split(typ, ".")
+	for i, p := range pats {
+		if p == ">" {
+			return i == len(pats)-1 && len(elems) > i
+		}
+		if i >= len(elems) || p != "*" && p != elems[i] {
+			return false
+		}
+	}
+	return len(pats) == len(elems)
+}
+
+// Config selects and configures the bus
+type Config struct {
+	// Backend is "none", "memory" or "nats"
+	Backend string
+	// NATSURL is the NATS server to connect to
+	NATSURL string
+	// Stream is the JetStream stream holding the events
+	Stream string
+}
+
+// ConfigFromEnv reads EVENTS_BACKEND, NATS_URL and EVENTS_STREAM
+func ConfigFromEnv() Config {
+	return Config{
+		Backend: shared.GetEnv("EVENTS_BACKEND", "none"),
+		NATSURL: shared.GetEnv("NATS_URL", "nats://localhost:4222"),
+		Stream:  shared.GetEnv("EVENTS_STREAM", "EVENTS"),
+	}
+}
+
+// Open connects to the bus cfg selects. It returns nil without an error if
+// no bus is configured.
+func Open(ctx context.Context, cfg Config) (Bus, error) {
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		return NewMemory(), nil
+	case "nats":
+		bus, err := ConnectJetStream(ctx, cfg.NATSURL, cfg.Stream)
+		if err != nil {
+			return nil, err
+		}
+		return bus, nil
+	default:
+		return nil, fmt.Errorf("unknown EVENTS_BACKEND %q", cfg.Backend)
+	}
+}
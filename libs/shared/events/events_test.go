@@ -0,0 +1,299 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+)
+
+type order struct {
+	ID string `json:"id"`
+}
+
+var orderCreated = Type[order]{Name: "order.created", Version: 1}
+
+// publishOrders publishes an order.created event for each of ids
+func publishOrders(t *testing.T, pub Publisher, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		e, err := orderCreated.New(context.Background(), "orders", id, order{ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pub.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+}
+
+// eventually fails the test unless cond holds within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// recorder is a handler recording the subjects it handled
+type recorder struct {
+	mu       sync.Mutex
+	subjects []string
+}
+
+func (r *recorder) handle(ctx context.Context, e Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subjects = append(r.subjects, e.Subject)
+	return nil
+}
+
+func (r *recorder) handled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.subjects)
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern, typ string
+		want         bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.paid", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.status.changed", false},
+		{"*.created", "payment.created", true},
+		{"order.>", "order.created", true},
+		{"order.>", "order.status.changed", true},
+		{"order.>", "order", false},
+		{">", "order.created", true},
+		{"order.>.x", "order.a.x", false},
+		{"order", "order.created", false},
+		{"order.created.v2", "order.created", false},
+	}
+	for _, tt := range tests {
+		if got := matches(tt.pattern, tt.typ); got != tt.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tt.pattern, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}.withDefaults()
+	for deliveries, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		if got := p.delay(deliveries); got != want {
+			t.Errorf("delay(%d) = %v, want %v", deliveries, got, want)
+		}
+	}
+	if d := (RetryPolicy{}).withDefaults(); d.MaxDeliveries != 5 || d.Backoff != time.Second || d.MaxBackoff != time.Minute {
+		t.Errorf("defaults = %+v", d)
+	}
+}
+
+func TestMemoryGroupsShareEvents(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	ctx := context.Background()
+
+	// Two members of billing share its events; audit gets its own copy
+	billing := Group{Name: "billing", Types: []string{"order.*"}}
+	members := []*recorder{{}, {}}
+	for _, r := range members {
+		slow := func(ctx context.Context, e Envelope) error {
+			time.Sleep(time.Millisecond)
+			return r.handle(ctx, e)
+		}
+		if _, err := bus.Subscribe(ctx, billing, slow); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	audit := &recorder{}
+	if _, err := bus.Subscribe(ctx, Group{Name: "audit", Types: []string{">"}}, audit.handle); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	var ids []string
+	for i := range 40 {
+		ids = append(ids, fmt.Sprintf("ord_%02d", i))
+	}
+	publishOrders(t, bus, ids...)
+
+	eventually(t, "billing to handle every event", func() bool {
+		return len(members[0].handled())+len(members[1].handled()) >= len(ids)
+	})
+	eventually(t, "audit to handle every event", func() bool { return len(audit.handled()) >= len(ids) })
+	time.Sleep(20 * time.Millisecond)
+
+	billed := append(members[0].handled(), members[1].handled()...)
+	slices.Sort(billed)
+	want := slices.Sorted(slices.Values(ids))
+	if !slices.Equal(billed, want) {
+		t.Errorf("billing handled %v, want each event once", billed)
+	}
+	for i, r := range members {
+		if len(r.handled()) == 0 {
+			t.Errorf("billing member %d handled nothing", i)
+		}
+	}
+	if got := audit.handled(); !slices.Equal(got, ids) {
+		t.Errorf("audit handled %v, want every event in order", got)
+	}
+}
+
+func TestMemoryRetriesThenDeadLetters(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	ctx := context.Background()
+	retry := RetryPolicy{MaxDeliveries: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	h := func(ctx context.Context, e Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[e.Subject]++
+		// ord_flaky succeeds on its second delivery; ord_broken never does
+		if e.Subject == "ord_broken" || attempts[e.Subject] < 2 {
+			return errors.New("handler failed")
+		}
+		return nil
+	}
+	if _, err := bus.Subscribe(ctx, Group{Name: "billing", Types: []string{"order.created"}, Retry: retry}, h); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	publishOrders(t, bus, "ord_flaky", "ord_broken")
+
+	eventually(t, "a dead letter", func() bool { return len(bus.DeadLetters()) > 0 })
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["ord_flaky"] != 2 || attempts["ord_broken"] != retry.MaxDeliveries {
+		t.Errorf("attempts = %v, want ord_flaky twice and ord_broken %d times", attempts, retry.MaxDeliveries)
+	}
+	dead := bus.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("dead letters = %+v, want only ord_broken's", dead)
+	}
+	if d := dead[0]; d.Envelope.Subject != "ord_broken" || d.Group != "billing" || d.Deliveries != 3 || d.Error != "handler failed" {
+		t.Errorf("dead letter = %+v", d)
+	}
+}
+
+func TestMemoryDropsDuplicates(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	ctx := context.Background()
+	e, err := orderCreated.New(ctx, "orders", "ord_1", order{ID: "ord_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := bus.Publish(ctx, e); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	// A group subscribing afterwards catches up on the single copy
+	r := &recorder{}
+	if _, err := bus.Subscribe(ctx, Group{Name: "billing", Types: []string{"order.created"}}, r.handle); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	eventually(t, "the event", func() bool { return len(r.handled()) > 0 })
+	time.Sleep(20 * time.Millisecond)
+	if got := r.handled(); len(got) != 1 || len(bus.Published()) != 1 {
+		t.Errorf("handled %v of %d published, want the event once", got, len(bus.Published()))
+	}
+}
+
+func TestMemoryRefusesMismatchedGroup(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	ctx := context.Background()
+	g := Group{Name: "billing", Types: []string{"order.created", "order.paid"}}
+	nop := func(context.Context, Envelope) error { return nil }
+	if _, err := bus.Subscribe(ctx, g, nop); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	same := g
+	same.Types = []string{"order.paid", "order.created"}
+	// Spelling out the default retry policy is the same policy
+	same.Retry = RetryPolicy{MaxDeliveries: 5}
+	if _, err := bus.Subscribe(ctx, same, nop); err != nil {
+		t.Errorf("Subscribe with the same configuration: %v", err)
+	}
+
+	otherTypes := g
+	otherTypes.Types = []string{"order.*"}
+	otherRetry := g
+	otherRetry.Retry = RetryPolicy{MaxDeliveries: 2}
+	for name, g := range map[string]Group{"other types": otherTypes, "other retry policy": otherRetry} {
+		if _, err := bus.Subscribe(ctx, g, nop); !errors.Is(err, ErrGroupMismatch) {
+			t.Errorf("Subscribe with %s: err = %v, want ErrGroupMismatch", name, err)
+		}
+	}
+}
+
+func TestOutboxRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := outbox.NewMemory()
+	created, err := outbox.New("order", "ord_1", "order.created", order{ID: "ord_1"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.TraceContext = map[string]string{"traceparent": "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"}
+	if err := store.Append(ctx, created); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	recorded := store.Events()[0]
+
+	bus := NewMemory()
+	defer bus.Close()
+	relay := outbox.NewRelay(store, OutboxPublisher(bus, "orders"), time.Hour)
+	if n, err := relay.Flush(ctx); err != nil || n != 1 {
+		t.Fatalf("Flush = %d, %v; want 1 published", n, err)
+	}
+	// Relaying again after the outbox lost track publishes nothing new
+	if err := OutboxPublisher(bus, "orders").Publish(ctx, recorded); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	published := bus.Published()
+	if len(published) != 1 {
+		t.Fatalf("published %d events, want 1", len(published))
+	}
+	e := published[0]
+	if e.ID != recorded.ID || e.Type != "order.created" || e.Version != 1 || e.Source != "orders" ||
+		e.Subject != "ord_1" || e.Sequence != recorded.Sequence || !e.Time.Equal(recorded.OccurredAt) {
+		t.Errorf("envelope = %+v, want outbox event %+v", e, recorded)
+	}
+	if e.TraceContext["traceparent"] != created.TraceContext["traceparent"] {
+		t.Errorf("trace context = %v, want the recording request's", e.TraceContext)
+	}
+	payload, err := orderCreated.Decode(e)
+	if err != nil || payload.ID != "ord_1" {
+		t.Errorf("Decode = %+v, %v", payload, err)
+	}
+	if _, err := (Type[order]{Name: "order.created", Version: 2}).Decode(e); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Decode as v2 err = %v, want ErrWrongType", err)
+	}
+}
@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned for calls on a closed bus
+var ErrClosed = errors.New("events: bus closed")
+
+// ErrGroupMismatch is returned (wrapped) when a member subscribes to a group
+// with other types or another retry policy than its first member did
+var ErrGroupMismatch = errors.New("events: group subscribed with another configuration")
+
+// Memory is an in-process bus, for tests and single-process runs. It keeps
+// every event published, so a group subscribing late still sees them, drops
+// events republished with the same ID, as JetStream does, and collects dead
+// letters for inspection.
+type Memory struct {
+	mu        sync.Mutex
+	published []Envelope
+	ids       map[string]bool
+	groups    map[string]*memoryGroup
+	dead      []DeadLetter
+	members   []*memoryMember
+	closed    bool
+}
+
+// NewMemory returns an empty in-memory bus
+func NewMemory() *Memory {
+	return &Memory{ids: make(map[string]bool), groups: make(map[string]*memoryGroup)}
+}
+
+type memoryGroup struct {
+	Group
+	mu      sync.Mutex
+	pending []delivery
+	// ready wakes a waiting member after a push
+	ready chan struct{}
+}
+
+// delivery is an event about to be delivered for the deliveries-th time
+type delivery struct {
+	envelope   Envelope
+	deliveries int
+}
+
+func (g *memoryGroup) push(d delivery) {
+	g.mu.Lock()
+	g.pending = append(g.pending, d)
+	g.mu.Unlock()
+	select {
+	case g.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (g *memoryGroup) pop() (delivery, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.pending) == 0 {
+		return delivery{}, false
+	}
+	d := g.pending[0]
+	g.pending = g.pending[1:]
+	return d, true
+}
+
+func (m *Memory) Publish(ctx context.Context, e Envelope) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if m.ids[e.ID] {
+		return nil
+	}
+	m.ids[e.ID] = true
+	m.published = append(m.published, e)
+	for _, g := range m.groups {
+		if g.wants(e.Type) {
+			g.push(delivery{envelope: e, deliveries: 1})
+		}
+	}
+	return nil
+}
+
+func (g *memoryGroup) wants(typ string) bool {
+	return slices.ContainsFunc(g.Types, func(pattern string) bool { return matches(pattern, typ) })
+}
+
+func (m *Memory) Subscribe(ctx context.Context, g Group, h Handler) (Subscription, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	g.Retry = g.Retry.withDefaults()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	group, ok := m.groups[g.Name]
+	if !ok {
+		// The group's first member: catch up on what was published before
+		group = &memoryGroup{Group: g, ready: make(chan struct{}, 1)}
+		for _, e := range m.published {
+			if group.wants(e.Type) {
+				group.pending = append(group.pending, delivery{envelope: e, deliveries: 1})
+			}
+		}
+		m.groups[g.Name] = group
+	} else if !sameGroup(group.Group, g) {
+		return nil, fmt.Errorf("%w: %s", ErrGroupMismatch, g.Name)
+	}
+	member := &memoryMember{bus: m, group: group, handler: h, stop: make(chan struct{}), done: make(chan struct{})}
+	m.members = append(m.members, member)
+	go member.run()
+	return member, nil
+}
+
+// sameGroup reports whether a and b, with their retry defaults applied,
+// subscribe to the same types with the same retry policy
+func sameGroup(a, b Group) bool {
+	return a.Retry == b.Retry && slices.Equal(slices.Sorted(slices.Values(a.Types)), slices.Sorted(slices.Values(b.Types)))
+}
+
+// memoryMember is one subscriber of a group, taking its turn at the
+// group's pending events
+type memoryMember struct {
+	bus     *Memory
+	group   *memoryGroup
+	handler Handler
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (s *memoryMember) run() {
+	defer close(s.done)
+	for {
+		d, ok := s.group.pop()
+		if !ok {
+			select {
+			case <-s.stop:
+				return
+			case <-s.group.ready:
+				continue
+			}
+		}
+		retryAfter, dead := deliver(context.Background(), s.group.Group, s.handler, d.envelope, d.deliveries)
+		switch {
+		case dead != nil:
+			s.bus.deadLetter(*dead)
+		case retryAfter > 0:
+			d.deliveries++
+			time.AfterFunc(retryAfter, func() { s.bus.redeliver(s.group, d) })
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+func (s *memoryMember) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (m *Memory) redeliver(g *memoryGroup, d delivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		g.push(d)
+	}
+}
+
+func (m *Memory) deadLetter(d DeadLetter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dead = append(m.dead, d)
+}
+
+// Published returns every event published, oldest first
+func (m *Memory) Published() []Envelope {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.published)
+}
+
+// DeadLetters returns the events groups gave up on, oldest first
+func (m *Memory) DeadLetters() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.dead)
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	members := m.members
+	m.members = nil
+	m.mu.Unlock()
+	for _, s := range members {
+		s.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// eventsPrefix and deadLetterPrefix start the subjects of events and of
+	// dead letters, e.g. events.order.created and
+	// deadletter.billing.order.created
+	eventsPrefix     = "events."
+	deadLetterPrefix = "deadletter."
+
+	// duplicateWindow is how long JetStream drops an event republished
+	// with the same ID, as the outbox relay does after a crash
+	duplicateWindow = 10 * time.Minute
+	// ackWait is how long a member may take over an event before it is
+	// redelivered, to another member if there is one
+	ackWait = time.Minute
+)
+
+// JetStream is a bus on NATS JetStream. Events and dead letters are kept
+// in one stream; each consumer group is a durable consumer on it.
+type JetStream struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	stream string
+
+	mu   sync.Mutex
+	subs []*jetStreamSub
+}
+
+// ConnectJetStream connects to the NATS server at url and creates or
+// updates the stream that holds the events
+func ConnectJetStream(ctx context.Context, url, stream string) (*JetStream, error) {
+	nc, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       stream,
+		Subjects:   []string{eventsPrefix + ">", deadLetterPrefix + ">"},
+		Storage:    jetstream.FileStorage,
+		Duplicates: duplicateWindow,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("create stream %s: %w", stream, err)
+	}
+	return &JetStream{nc: nc, js: js, stream: stream}, nil
+}
+
+// Publish stores e in the stream. The event's ID is its message ID, so the
+// stream drops republished events within its duplicate window.
+func (b *JetStream) Publish(ctx context.Context, e Envelope) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = b.js.Publish(ctx, eventsPrefix+e.Type, data, jetstream.WithMsgID(e.ID))
+	return err
+}
+
+func (b *JetStream) Subscribe(ctx context.Context, g Group, h Handler) (Subscription, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	g.Retry = g.Retry.withDefaults()
+	subjects := make([]string, len(g.Types))
+	for i, t := range g.Types {
+		subjects[i] = eventsPrefix + t
+	}
+	cons, err := b.js.CreateOrUpdateConsumer(ctx, b.stream, jetstream.ConsumerConfig{
+		Durable:        g.Name,
+		FilterSubjects: subjects,
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		AckWait:        ackWait,
+		// Unlimited: the member dead-letters an event itself, which it
+		// can't once the server has given up on it
+		MaxDeliver: -1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create consumer %s: %w", g.Name, err)
+	}
+	sub := &jetStreamSub{}
+	sub.consume, err = cons.Consume(func(msg jetstream.Msg) {
+		b.handle(g, h, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+	return sub, nil
+}
+
+// handle delivers msg to h and acknowledges it, asks for it again later or
+// dead-letters it
+func (b *JetStream) handle(g Group, h Handler, msg jetstream.Msg) {
+	var e Envelope
+	if err := json.Unmarshal(msg.Data(), &e); err != nil {
+		// Redelivering won't make it readable
+		log.Printf("[events] Dropping unreadable event on %s for %s: %v", msg.Subject(), g.Name, err)
+		msg.Term()
+		return
+	}
+	deliveries := 1
+	if meta, err := msg.Metadata(); err == nil {
+		deliveries = int(meta.NumDelivered)
+	}
+	retryAfter, dead := deliver(context.Background(), g, h, e, deliveries)
+	switch {
+	case dead != nil:
+		if err := b.deadLetter(*dead); err != nil {
+			// Try again rather than lose it
+			log.Printf("[events] Dead-lettering %s for %s failed: %v", e.ID, g.Name, err)
+			msg.NakWithDelay(g.Retry.MaxBackoff)
+			return
+		}
+		msg.Term()
+	case retryAfter > 0:
+		msg.NakWithDelay(retryAfter)
+	default:
+		msg.Ack()
+	}
+}
+
+// deadLetter stores d in the stream under deadletter.<group>.<type>
+func (b *JetStream) deadLetter(d DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = b.js.Publish(ctx, deadLetterPrefix+d.Group+"."+d.Envelope.Type, data,
+		jetstream.WithMsgID(d.Group+"/"+d.Envelope.ID))
+	return err
+}
+
+func (b *JetStream) Close() error {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+	for _, sub := range subs {
+		sub.Stop()
+	}
+	return b.nc.Drain()
+}
+
+// jetStreamSub is one member of a group, pulling from its consumer
+type jetStreamSub struct {
+	consume jetstream.ConsumeContext
+}
+
+// Stop finishes the events already pulled and stops pulling more
+func (s *jetStreamSub) Stop() {
+	s.consume.Drain()
+	<-s.consume.Closed()
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+)
+
+// outboxVersion is the payload version of events relayed from an outbox,
+// which doesn't version them
+const outboxVersion = 1
+
+// FromOutbox returns the envelope for an outbox event of source. It keeps
+// the event's ID, so redeliveries of either dedupe alike, and the trace of
+// the request that recorded it.
+func FromOutbox(source string, e outbox.Event) Envelope {
+	return Envelope{
+		ID:           e.ID,
+		Type:         e.Type,
+		Version:      outboxVersion,
+		Source:       source,
+		Subject:      e.AggregateID,
+		Sequence:     e.Sequence,
+		Time:         e.OccurredAt,
+		Payload:      e.Payload,
+		TraceContext: e.TraceContext,
+	}
+}
+
+// OutboxPublisher returns an outbox.Publisher that puts source's events on
+// pub, for an outbox.Relay to publish through
+func OutboxPublisher(pub Publisher, source string) outbox.Publisher {
+	return outbox.PublisherFunc(func(ctx context.Context, e outbox.Event) error {
+		return pub.Publish(ctx, FromOutbox(source, e))
+	})
+}
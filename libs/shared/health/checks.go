@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mongo checks that the client can reach the primary
+func Mongo(name string, client *mongo.Client) Checker {
+	return Func(name, func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	})
+}
+
+// HTTP checks that a GET to url returns a 2xx status. client may be nil to
+// use http.DefaultClient; the check's own timeout still applies.
+func HTTP(name, url string, client *http.Client) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return Func(name, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// Disk checks that the filesystem holding path has at least minFree bytes
+// available
+func Disk(path string, minFree uint64) Checker {
+	return Func("disk", func(ctx context.Context) error {
+		free, err := freeBytes(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s has %d bytes free, want at least %d", path, free, minFree)
+		}
+		return nil
+	})
+}
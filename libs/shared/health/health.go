@@ -0,0 +1,237 @@
+// Package health runs a service's dependency checks and serves the
+// Kubernetes-style probes:
+//
+//	/livez     the process is alive (liveness checks only)
+//	/startupz  startup work such as migrations and warmup has finished
+//	/readyz    started and every readiness check passes
+//	/health    detailed JSON report with per-check status and latency
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+)
+
+// Paths are the endpoints served by Health
+var Paths = []string{"/livez", "/readyz", "/startupz", "/health"}
+
+const defaultTimeout = 2 * time.Second
+
+// Checker reports whether one dependency is usable
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type funcChecker struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (f funcChecker) Name() string                    { return f.name }
+func (f funcChecker) Check(ctx context.Context) error { return f.fn(ctx) }
+
+// Func adapts a function to a Checker
+func Func(name string, fn func(ctx context.Context) error) Checker {
+	return funcChecker{name: name, fn: fn}
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body of the /health endpoint
+type Report struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version,omitempty"`
+	Build   *buildinfo.Info        `json:"build,omitempty"`
+	Started bool                   `json:"started"`
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
+// Health holds the registered checkers for one service
+type Health struct {
+	timeout time.Duration
+	version string
+	build   *buildinfo.Info
+
+	mu        sync.RWMutex
+	liveness  []Checker
+	readiness []Checker
+	startup   []Checker
+
+	started atomic.Bool
+}
+
+// New returns a Health that gives each check timeout to complete
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Health{timeout: timeout}
+}
+
+// SetVersion sets the version reported by /health
+func (h *Health) SetVersion(version string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version = version
+}
+
+// SetBuild reports the build in /health, and its version as the version
+func (h *Health) SetBuild(info buildinfo.Info) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version = info.Version
+	h.build = &info
+}
+
+// AddLiveness registers checks that should restart the process when they
+// fail. Keep these cheap and free of external dependencies.
+func (h *Health) AddLiveness(checkers ...Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, checkers...)
+}
+
+// AddReadiness registers checks that must pass for the service to receive
+// traffic, such as database and downstream connectivity
+func (h *Health) AddReadiness(checkers ...Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, checkers...)
+}
+
+// AddStartup registers checks that gate the startup probe, such as pending
+// migrations or cache warmup. Once they have all passed together the
+// service counts as started and they are not run again.
+func (h *Health) AddStartup(checkers ...Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startup = append(h.startup, checkers...)
+}
+
+// Started runs the startup checks if they haven't passed yet and reports
+// whether the service has finished starting
+func (h *Health) Started(ctx context.Context) bool {
+	if h.started.Load() {
+		return true
+	}
+	h.mu.RLock()
+	checkers := h.startup
+	h.mu.RUnlock()
+	if ok, _ := h.run(ctx, checkers); ok {
+		h.started.Store(true)
+		return true
+	}
+	return false
+}
+
+// Check runs the readiness checks concurrently and returns the full report
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.RLock()
+	checkers := append(append([]Checker(nil), h.liveness...), h.readiness...)
+	version, build := h.version, h.build
+	h.mu.RUnlock()
+
+	started := h.Started(ctx)
+	ok, results := h.run(ctx, checkers)
+	report := Report{Status: "ok", Version: version, Build: build, Started: started, Checks: results}
+	if !ok || !started {
+		report.Status = "fail"
+	}
+	return report
+}
+
+// run executes checkers concurrently, each with its own timeout
+func (h *Health) run(ctx context.Context, checkers []Checker) (bool, map[string]CheckResult) {
+	results := make(map[string]CheckResult, len(checkers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checkers {
+		wg.Add(1)
+		go func(c Checker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.Check(ctx)
+			res := CheckResult{
+				Status:    "ok",
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+			mu.Lock()
+			results[c.Name()] = res
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Status != "ok" {
+			return false, results
+		}
+	}
+	return true, results
+}
+
+// ServeHTTP serves all of Paths, so it can be mounted on a mux for each path
+// or wrapped with gin.WrapH
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+
+	switch r.URL.Path {
+	case "/livez":
+		h.mu.RLock()
+		checkers := h.liveness
+		h.mu.RUnlock()
+		ok, _ := h.run(ctx, checkers)
+		writeProbe(w, ok)
+	case "/startupz":
+		writeProbe(w, h.Started(ctx))
+	case "/readyz":
+		writeProbe(w, h.Check(ctx).Status == "ok")
+	default:
+		report := h.Check(ctx)
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("encode error: %v", err)
+		}
+	}
+}
+
+func writeProbe(w http.ResponseWriter, ok bool) {
+	status, body := http.StatusOK, "ok"
+	if !ok {
+		status, body = http.StatusServiceUnavailable, "fail"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Printf("write error: %v", err)
+	}
+}
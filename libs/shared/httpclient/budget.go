@@ -0,0 +1,39 @@
+package httpclient
+
+import "sync"
+
+// budget caps retries to a share of traffic. Every request deposits ratio
+// tokens, every retry spends one, and at most burst tokens are saved up, so
+// when a backend is failing everything the retries stop long before they
+// multiply the load on it.
+type budget struct {
+	ratio float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func newBudget(ratio float64, burst int) *budget {
+	return &budget{ratio: ratio, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// withdraw spends a token for one retry, reporting false if none are left
+func (b *budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,286 @@
+// Package httpclient builds the *http.Client used for calls between
+// services. On top of the tracing and request ID transports it adds:
+//
+//   - a deadline for the whole call and for each attempt
+//   - retries with jittered exponential backoff, only for idempotent methods
+//     or requests carrying an Idempotency-Key header
+//   - a retry budget, so retries can't multiply load during an outage
+//   - a circuit breaker per host, which fails fast while a host is down
+//   - Prometheus metrics and span events for attempts, retries and breakers
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IdempotencyKeyHeader marks a non-idempotent request as safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrCircuitOpen is returned without making a request while the breaker for
+// the host is open
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"http_client_requests_total",
+		"Outbound request attempts, by status code, \"error\" or \"circuit_open\".",
+		"client", "host", "code",
+	)
+	retriesTotal = metrics.NewCounterVec(
+		"http_client_retries_total",
+		"Outbound requests retried.",
+		"client", "host",
+	)
+	attemptDuration = metrics.NewHistogramVec(
+		"http_client_attempt_duration_seconds",
+		"Time from sending an outbound attempt to receiving response headers.",
+		"client", "host",
+	)
+	circuitOpen = metrics.NewGaugeVec(
+		"http_client_circuit_open",
+		"1 while the circuit breaker for a host is open.",
+		"client", "host",
+	)
+)
+
+// Config controls a client's deadlines, retries and circuit breakers
+type Config struct {
+	// Name labels the client's metrics
+	Name string
+	// Timeout bounds a whole call, including retries and reading the body
+	Timeout time.Duration
+	// AttemptTimeout bounds each attempt
+	AttemptTimeout time.Duration
+	// MaxAttempts is the most tries per call; 1 disables retries
+	MaxAttempts int
+	// BaseBackoff and MaxBackoff bound the jittered exponential backoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// RetryRatio is the share of requests that may be retried, and
+	// RetryBurst how many retries can be spent at once
+	RetryRatio float64
+	RetryBurst int
+	// BreakerThreshold consecutive failures open a host's breaker for
+	// BreakerCooldown, after which one probe request is let through
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Base is the underlying transport; nil means a clone of
+	// http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// ConfigFromEnv returns the defaults, overridable with HTTP_CLIENT_TIMEOUT,
+// HTTP_CLIENT_ATTEMPT_TIMEOUT and HTTP_CLIENT_MAX_ATTEMPTS
+func ConfigFromEnv(name string) Config {
+	return Config{
+		Name:             name,
+		Timeout:          shared.GetEnvDuration("HTTP_CLIENT_TIMEOUT", 30*time.Second),
+		AttemptTimeout:   shared.GetEnvDuration("HTTP_CLIENT_ATTEMPT_TIMEOUT", 10*time.Second),
+		MaxAttempts:      shared.GetEnvInt("HTTP_CLIENT_MAX_ATTEMPTS", 3),
+		BaseBackoff:      100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		RetryRatio:       0.2,
+		RetryBurst:       10,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// New returns a client configured by cfg
+func New(cfg Config) *http.Client {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	base := cfg.Base
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &transport{
+			cfg:      cfg,
+			next:     deadline.Transport(requestid.Transport(tracing.Transport(base))),
+			budget:   newBudget(cfg.RetryRatio, cfg.RetryBurst),
+			breakers: make(map[string]*breaker),
+		},
+	}
+}
+
+type transport struct {
+	cfg    Config
+	next   http.RoundTripper
+	budget *budget
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func (t *transport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		gauge := circuitOpen.WithLabelValues(t.cfg.Name, host)
+		b = newBreaker(t.cfg.BreakerThreshold, t.cfg.BreakerCooldown, func(open bool) {
+			if open {
+				gauge.Set(1)
+			} else {
+				gauge.Set(0)
+			}
+		})
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b := t.breaker(host)
+	retryable := canRetry(req)
+	t.budget.deposit()
+
+	for attempt := 1; ; attempt++ {
+		if !b.allow() {
+			requestsTotal.WithLabelValues(t.cfg.Name, host, "circuit_open").Inc()
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+
+		resp, err := t.attempt(req, attempt)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		requestsTotal.WithLabelValues(t.cfg.Name, host, code).Inc()
+		// A caller cancelling says nothing about the host's health
+		if req.Context().Err() == nil {
+			b.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+		} else {
+			b.forget()
+		}
+
+		if !retryable || !shouldRetry(resp, err) || req.Context().Err() != nil ||
+			attempt >= t.cfg.MaxAttempts || !t.budget.withdraw() {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain a little so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		retriesTotal.WithLabelValues(t.cfg.Name, host).Inc()
+		trace.SpanFromContext(req.Context()).AddEvent("http.retry", trace.WithAttributes(
+			attribute.Int("http.request.resend_count", attempt),
+			attribute.String("server.address", host),
+		))
+		if err := sleep(req.Context(), t.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends one try of req, with a fresh body after the first
+func (t *transport) attempt(req *http.Request, n int) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if t.cfg.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.cfg.AttemptTimeout)
+	}
+	try := req.WithContext(ctx)
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		try = req.Clone(ctx)
+		try.Body = body
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(try)
+	attemptDuration.WithLabelValues(t.cfg.Name, req.URL.Host).Observe(time.Since(start).Seconds())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt's deadline must last until the body has been read
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns a full-jitter delay before retry number attempt
+func (t *transport) backoff(attempt int) time.Duration {
+	d := t.cfg.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > t.cfg.MaxBackoff {
+		d = t.cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// canRetry reports whether req may be sent more than once: its method is
+// idempotent or it carries an idempotency key, and its body can be replayed
+func canRetry(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get(IdempotencyKeyHeader) == "" {
+			return false
+		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
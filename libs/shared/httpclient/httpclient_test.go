@@ -0,0 +1,313 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig retries quickly and leaves the breaker and budget out of the way
+func testConfig() Config {
+	return Config{
+		Name:           "test",
+		Timeout:        5 * time.Second,
+		AttemptTimeout: time.Second,
+		MaxAttempts:    3,
+		BaseBackoff:    time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		RetryRatio:     1,
+		RetryBurst:     100,
+	}
+}
+
+// failing returns a server answering 503 to every request and a count of the
+// requests it received
+func failing(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// do sends req with client, closing the response body
+func do(client *http.Client, req *http.Request) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRetriesOnlyRepeatableRequests(t *testing.T) {
+	srv, hits := failing(t)
+	client := New(testConfig())
+
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		attempts int32
+	}{
+		{"GET", http.MethodGet, "", 3},
+		{"PUT", http.MethodPut, "", 3},
+		{"DELETE", http.MethodDelete, "", 3},
+		{"POST", http.MethodPost, "", 1},
+		{"PATCH", http.MethodPatch, "", 1},
+		{"POST with key", http.MethodPost, "key-1", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("{}"))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			code, err := do(client, req)
+			if err != nil || code != http.StatusServiceUnavailable {
+				t.Fatalf("Do = %d, %v; want the last 503", code, err)
+			}
+			if got := hits.Load(); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+
+	t.Run("4xx", func(t *testing.T) {
+		var hits atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusConflict)
+		}))
+		defer srv.Close()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if _, err := do(client, req); err != nil || hits.Load() != 1 {
+			t.Errorf("%d attempts, %v; want a single one", hits.Load(), err)
+		}
+	})
+
+	t.Run("body that can't be replayed", func(t *testing.T) {
+		hits.Store(0)
+		req, _ := http.NewRequest(http.MethodPut, srv.URL, io.NopCloser(strings.NewReader("{}")))
+		if _, err := do(client, req); err != nil || hits.Load() != 1 {
+			t.Errorf("%d attempts, %v; want a single one", hits.Load(), err)
+		}
+	})
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"amount":"1.00"}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	code, err := do(New(testConfig()), req)
+	if err != nil || code != http.StatusCreated {
+		t.Fatalf("Do = %d, %v; want 201", code, err)
+	}
+	for i, b := range bodies {
+		if b != `{"amount":"1.00"}` {
+			t.Errorf("attempt %d sent body %q", i+1, b)
+		}
+	}
+	if len(bodies) != 3 {
+		t.Errorf("%d attempts, want 3", len(bodies))
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	srv, hits := failing(t)
+	cfg := testConfig()
+	cfg.MaxAttempts = 5
+	// Two retries saved up and none earned, so the budget runs dry
+	cfg.RetryRatio = 0
+	cfg.RetryBurst = 2
+	client := New(cfg)
+
+	for i, want := range []int32{3, 1, 1} {
+		hits.Store(0)
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if _, err := do(client, req); err != nil {
+			t.Fatal(err)
+		}
+		if got := hits.Load(); got != want {
+			t.Errorf("call %d made %d attempts, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var (
+		hits    atomic.Int32
+		healthy atomic.Bool
+		entered = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxAttempts = 1
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = 50 * time.Millisecond
+	client := New(cfg)
+	get := func() (int, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		return do(client, req)
+	}
+
+	for range 2 {
+		if code, err := get(); err != nil || code != http.StatusInternalServerError {
+			t.Fatalf("get = %d, %v; want 500", code, err)
+		}
+	}
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("get after %d failures err = %v, want ErrCircuitOpen", cfg.BreakerThreshold, err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("open breaker let a request through: %d hits", hits.Load())
+	}
+
+	// After the cooldown exactly one probe goes out
+	time.Sleep(cfg.BreakerCooldown)
+	healthy.Store(true)
+	probe := make(chan error, 1)
+	go func() {
+		_, err := get()
+		probe <- err
+	}()
+	<-entered
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second request during the probe err = %v, want ErrCircuitOpen", err)
+	}
+	close(release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	// The probe succeeded, so the breaker is closed again
+	for range 3 {
+		if code, err := get(); err != nil || code != http.StatusOK {
+			t.Fatalf("get after the probe = %d, %v; want 200", code, err)
+		}
+	}
+}
+
+func TestBreakerIgnoresCallerCancellation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxAttempts = 1
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Hour
+	client := New(cfg)
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		_, err := do(client, req)
+		cancel()
+		if errors.Is(err, ErrCircuitOpen) {
+			t.Fatal("callers giving up opened the breaker")
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want the caller's deadline", err)
+		}
+	}
+}
+
+func TestBreakerForgetsCancelledProbe(t *testing.T) {
+	b := newBreaker(1, 0, func(bool) {})
+	b.allow()
+	b.record(false)
+	if !b.allow() {
+		t.Fatal("breaker didn't let a probe through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("breaker let a second probe through")
+	}
+	// The probe's caller gave up, so another probe may go out
+	b.forget()
+	if !b.allow() {
+		t.Error("breaker stayed closed to probes after one was forgotten")
+	}
+}
+
+func TestAttemptDeadlineLastsUntilBodyRead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("head "))
+		w.(http.Flusher).Flush()
+		if r.URL.Query().Has("stall") {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("tail"))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AttemptTimeout = 100 * time.Millisecond
+	client := New(cfg)
+
+	t.Run("read in time", func(t *testing.T) {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		// The attempt's context must outlive RoundTrip returning
+		time.Sleep(20 * time.Millisecond)
+		if b, err := io.ReadAll(resp.Body); err != nil || string(b) != "head tail" {
+			t.Errorf("body = %q, %v", b, err)
+		}
+	})
+
+	t.Run("stalled body", func(t *testing.T) {
+		resp, err := client.Get(srv.URL + "?stall")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		start := time.Now()
+		if _, err := io.ReadAll(resp.Body); err == nil {
+			t.Error("reading a stalled body succeeded")
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("stalled body read for %v, past the attempt deadline", waited)
+		}
+	})
+}
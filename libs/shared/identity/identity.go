@@ -0,0 +1,280 @@
+// Package identity carries the authenticated user from the gateway to the
+// services behind it. After checking the client's JWT the gateway signs a
+// short-lived assertion for the one service it is calling, and that service
+// verifies it instead of trusting headers anyone on the network could set.
+//
+// Assertions also carry the user's roles, which services check with
+// RequireRole before serving staff-only routes.
+//
+// The raw X-User-ID header is only honoured when TRUSTED_NETWORK=true, for
+// deployments where nothing but the gateway can reach the services.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+)
+
+// Header carries the signed assertion on requests from the gateway
+const Header = "X-Identity-Assertion"
+
+// Legacy headers set by the gateway. Services only read them on a trusted
+// network; the gateway strips any a client sends.
+const (
+	UserIDHeader   = "X-User-ID"
+	UsernameHeader = "X-Username"
+	// RolesHeader lists the user's roles, comma-separated
+	RolesHeader = "X-User-Roles"
+)
+
+// RoleOperator is held by back-office staff, who manage every customer's
+// orders
+const RoleOperator = "operator"
+
+const issuer = "api-gateway"
+
+// servicePrefix starts the user ID of a service's own identity. Auth never
+// issues IDs like it, so no user can pass for a service.
+const servicePrefix = "service:"
+
+var (
+	// ErrMissing is returned when a request carries no identity
+	ErrMissing = errors.New("identity: missing assertion")
+	// ErrInvalid is returned for a bad signature, audience or expiry
+	ErrInvalid = errors.New("identity: invalid assertion")
+)
+
+// Identity is the user a request is made on behalf of
+type Identity struct {
+	UserID   string
+	Username string
+	Roles    []string
+}
+
+// HasRole reports whether the user holds role
+func (id Identity) HasRole(role string) bool {
+	return slices.Contains(id.Roles, role)
+}
+
+// Service returns the identity the named service asserts for calls it
+// makes on its own behalf rather than a user's
+func Service(name string) Identity {
+	return Identity{UserID: servicePrefix + name, Username: name}
+}
+
+// IsService reports whether id is the named service's own
+func (id Identity) IsService(name string) bool {
+	return id.UserID == servicePrefix+name
+}
+
+// Config holds the shared signing key and policy
+type Config struct {
+	// Secret signs and verifies assertions. It must differ from JWT_SECRET
+	// so a client token can never pass as an assertion.
+	Secret []byte
+	// TTL is how long a signed assertion stays valid
+	TTL time.Duration
+	// TrustedNetwork accepts the raw X-User-ID header when no assertion
+	// is present
+	TrustedNetwork bool
+}
+
+// ConfigFromEnv reads SERVICE_IDENTITY_SECRET, SERVICE_IDENTITY_TTL and
+// TRUSTED_NETWORK. The secret is required unless the network is trusted.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Secret:         []byte(shared.GetEnv("SERVICE_IDENTITY_SECRET", "")),
+		TTL:            shared.GetEnvDuration("SERVICE_IDENTITY_TTL", 30*time.Second),
+		TrustedNetwork: shared.GetEnv("TRUSTED_NETWORK", "false") == "true",
+	}
+	if len(cfg.Secret) == 0 && !cfg.TrustedNetwork {
+		return cfg, errors.New("SERVICE_IDENTITY_SECRET is required unless TRUSTED_NETWORK=true")
+	}
+	return cfg, nil
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// Sign returns an assertion of id that only audience will accept
+func (c Config) Sign(id Identity, audience string) (string, error) {
+	if len(c.Secret) == 0 {
+		return "", errors.New("identity: no signing secret")
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   id.UserID,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(c.TTL)),
+		},
+		Username: id.Username,
+		Roles:    id.Roles,
+	})
+	return token.SignedString(c.Secret)
+}
+
+// SetHeaders sets the headers on h that make a request on behalf of id to
+// audience: an assertion signed with c, if it has a secret, and the plain
+// headers services on a trusted network fall back to
+func (c Config) SetHeaders(h http.Header, id Identity, audience string) error {
+	if len(c.Secret) > 0 {
+		assertion, err := c.Sign(id, audience)
+		if err != nil {
+			return err
+		}
+		h.Set(Header, assertion)
+	}
+	h.Set(UserIDHeader, id.UserID)
+	h.Set(UsernameHeader, id.Username)
+	if len(id.Roles) > 0 {
+		h.Set(RolesHeader, strings.Join(id.Roles, ","))
+	}
+	return nil
+}
+
+// Verify checks an assertion addressed to audience and returns its identity
+func (c Config) Verify(assertion, audience string) (Identity, error) {
+	if len(c.Secret) == 0 {
+		return Identity{}, fmt.Errorf("%w: no verification secret", ErrInvalid)
+	}
+	var cl claims
+	_, err := jwt.ParseWithClaims(assertion, &cl, func(*jwt.Token) (interface{}, error) {
+		return c.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(5*time.Second),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if cl.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: no subject", ErrInvalid)
+	}
+	return Identity{UserID: cl.Subject, Username: cl.Username, Roles: cl.Roles}, nil
+}
+
+// FromRequest returns the identity of r for audience: the verified
+// assertion, or on a trusted network the raw headers
+func (c Config) FromRequest(r *http.Request, audience string) (Identity, error) {
+	if assertion := r.Header.Get(Header); assertion != "" {
+		return c.Verify(assertion, audience)
+	}
+	if c.TrustedNetwork {
+		if userID := r.Header.Get(UserIDHeader); userID != "" {
+			return Identity{
+				UserID:   userID,
+				Username: r.Header.Get(UsernameHeader),
+				Roles:    SplitRoles(r.Header.Get(RolesHeader)),
+			}, nil
+		}
+	}
+	return Identity{}, ErrMissing
+}
+
+// SplitRoles parses the comma-separated roles of RolesHeader
+func SplitRoles(header string) []string {
+	var roles []string
+	for _, role := range strings.Split(header, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+type ctxKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the identity stored by the middleware, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// Gin rejects requests without a valid identity for audience with 401 and
+// stores the identity in the request context
+func Gin(cfg Config, audience string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := cfg.FromRequest(c.Request, audience)
+		if err != nil {
+			apierror.Gin(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.Request = c.Request.WithContext(WithIdentity(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests whose identity, stored by Gin, lacks role
+// with 403
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := FromContext(c.Request.Context())
+		if !id.HasRole(role) {
+			apierror.Gin(c, http.StatusForbidden, "requires the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireService rejects requests whose identity, stored by Gin, isn't the
+// named service's own with 403
+func RequireService(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := FromContext(c.Request.Context())
+		if !id.IsService(name) {
+			apierror.Gin(c, http.StatusForbidden, "only the "+name+" service can call this")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleOrService is RequireRole that also lets the named service's
+// own identity through
+func RequireRoleOrService(role, service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := FromContext(c.Request.Context())
+		if !id.HasRole(role) && !id.IsService(service) {
+			apierror.Gin(c, http.StatusForbidden, "requires the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware is the net/http equivalent of Gin
+func Middleware(cfg Config, audience string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := cfg.FromRequest(r, audience)
+		if err != nil {
+			apierror.Write(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
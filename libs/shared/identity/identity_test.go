@@ -0,0 +1,238 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testConfig = Config{Secret: []byte("test-identity-secret"), TTL: time.Minute}
+
+var alice = Identity{UserID: "usr_alice", Username: "alice", Roles: []string{RoleOperator}}
+
+// sign returns an assertion of alice for audience, failing the test on an
+// error
+func sign(t *testing.T, cfg Config, audience string) string {
+	t.Helper()
+	assertion, err := cfg.Sign(alice, audience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assertion
+}
+
+func TestVerify(t *testing.T) {
+	id, err := testConfig.Verify(sign(t, testConfig, "orders"), "orders")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if id.UserID != alice.UserID || id.Username != alice.Username || !id.HasRole(RoleOperator) {
+		t.Errorf("Verify = %+v, want %+v", id, alice)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	valid := sign(t, testConfig, "orders")
+	head, rest, _ := strings.Cut(valid, ".")
+	claims, sig, _ := strings.Cut(rest, ".")
+	// Flip the signature's first character to another base64url one
+	flipped := "A"
+	if sig[0] == 'A' {
+		flipped = "B"
+	}
+
+	expired := testConfig
+	expired.TTL = -time.Minute
+	other := testConfig
+	other.Secret = []byte("another-secret")
+	aliceToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "someone-else",
+		Subject:   "usr_alice",
+		Audience:  jwt.ClaimStrings{"orders"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}).SignedString(testConfig.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   "usr_alice",
+		Audience:  jwt.ClaimStrings{"orders"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"wrong audience":     sign(t, testConfig, "payments"),
+		"expired":            sign(t, expired, "orders"),
+		"tampered signature": head + "." + claims + "." + flipped + sig[1:],
+		"tampered claims":    head + "." + claims[:len(claims)-2] + "." + sig,
+		"other secret":       sign(t, other, "orders"),
+		"other issuer":       aliceToken,
+		"unsigned":           unsigned,
+		"garbage":            "not-a-jwt",
+	}
+	for name, assertion := range tests {
+		t.Run(name, func(t *testing.T) {
+			if id, err := testConfig.Verify(assertion, "orders"); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify = %+v, %v; want ErrInvalid", id, err)
+			}
+		})
+	}
+	if _, err := (Config{}).Verify(valid, "orders"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify without a secret err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	trusted := testConfig
+	trusted.TrustedNetwork = true
+	headers := func(r *http.Request) {
+		r.Header.Set(UserIDHeader, "usr_mallory")
+		r.Header.Set(RolesHeader, RoleOperator+", ")
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		prepare func(r *http.Request)
+		userID  string
+		err     error
+	}{
+		{"assertion", testConfig, func(r *http.Request) { r.Header.Set(Header, sign(t, testConfig, "orders")) }, "usr_alice", nil},
+		{"raw headers ignored", testConfig, headers, "", ErrMissing},
+		{"raw headers on a trusted network", trusted, headers, "usr_mallory", nil},
+		{"assertion wins on a trusted network", trusted, func(r *http.Request) {
+			headers(r)
+			r.Header.Set(Header, sign(t, testConfig, "orders"))
+		}, "usr_alice", nil},
+		{"bad assertion not rescued by headers", trusted, func(r *http.Request) {
+			headers(r)
+			r.Header.Set(Header, sign(t, testConfig, "payments"))
+		}, "", ErrInvalid},
+		{"nothing", trusted, func(*http.Request) {}, "", ErrMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			tt.prepare(r)
+			id, err := tt.cfg.FromRequest(r, "orders")
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("FromRequest = %+v, %v; want %v", id, err, tt.err)
+				}
+				return
+			}
+			if err != nil || id.UserID != tt.userID {
+				t.Errorf("FromRequest = %+v, %v; want %s", id, err, tt.userID)
+			}
+		})
+	}
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	headers(r)
+	if id, _ := trusted.FromRequest(r, "orders"); len(id.Roles) != 1 || id.Roles[0] != RoleOperator {
+		t.Errorf("roles from header = %q, want [%s]", id.Roles, RoleOperator)
+	}
+}
+
+// serve sends a request carrying an assertion of id, if it has a user,
+// through the identity middleware and check, returning the status
+func serve(t *testing.T, id Identity, check gin.HandlerFunc) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Gin(testConfig, "catalog"), check, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id.UserID != "" {
+		assertion, err := testConfig.Sign(id, "catalog")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(Header, assertion)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name string
+		id   Identity
+		want int
+	}{
+		{"operator", alice, http.StatusNoContent},
+		{"customer", Identity{UserID: "usr_bob"}, http.StatusForbidden},
+		{"other role", Identity{UserID: "usr_bob", Roles: []string{"support"}}, http.StatusForbidden},
+		{"anonymous", Identity{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := serve(t, tt.id, RequireRole(RoleOperator)); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequireService(t *testing.T) {
+	tests := []struct {
+		name string
+		id   Identity
+		want int
+	}{
+		{"the service", Service("orders"), http.StatusNoContent},
+		{"another service", Service("cart"), http.StatusForbidden},
+		{"operator", alice, http.StatusForbidden},
+		// A user can't pick a username that passes for the service
+		{"user named like it", Identity{UserID: "usr_bob", Username: "orders"}, http.StatusForbidden},
+		{"anonymous", Identity{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := serve(t, tt.id, RequireService("orders")); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	trusted := Config{TrustedNetwork: true}
+	for name, cfg := range map[string]Config{"signed": testConfig, "trusted network": trusted} {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if err := cfg.SetHeaders(r.Header, alice, "orders"); err != nil {
+			t.Fatalf("%s: SetHeaders: %v", name, err)
+		}
+		if got := r.Header.Get(Header) != ""; got != (len(cfg.Secret) > 0) {
+			t.Errorf("%s: assertion sent = %v", name, got)
+		}
+		id, err := cfg.FromRequest(r, "orders")
+		if err != nil || id.UserID != alice.UserID || id.Username != alice.Username || !id.HasRole(RoleOperator) {
+			t.Errorf("%s: FromRequest = %+v, %v; want %+v", name, id, err, alice)
+		}
+	}
+}
+
+func TestRequireRoleOrService(t *testing.T) {
+	tests := []struct {
+		name string
+		id   Identity
+		want int
+	}{
+		{"operator", alice, http.StatusNoContent},
+		{"the service", Service("cart"), http.StatusNoContent},
+		{"another service", Service("orders"), http.StatusForbidden},
+		{"customer", Identity{UserID: "usr_bob", Username: "cart"}, http.StatusForbidden},
+		{"anonymous", Identity{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := serve(t, tt.id, RequireRoleOrService(RoleOperator, "cart")); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
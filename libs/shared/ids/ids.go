@@ -0,0 +1,209 @@
+// Package ids generates and validates the typed entity IDs used across the
+// services. An ID is a kind prefix followed by a ULID, e.g.
+//
+//	ord_01J9Z8Q4XK7T3M2N5P6R8S9V0W
+//
+// The ULID part is 48 bits of millisecond timestamp and 80 random bits in
+// Crockford base32, so IDs of the same kind sort by creation time. IDs
+// minted before this scheme (16 lowercase hex characters from
+// shared.GenerateID) are still accepted as legacy IDs.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies what an ID refers to and is used as its prefix
+type Kind string
+
+const (
+	User    Kind = "usr"
+	Order   Kind = "ord"
+	Payment Kind = "pay"
+	Product Kind = "prd"
+	// Checkout is a cart checkout, which places an order and takes its
+	// payment
+	Checkout Kind = "chk"
+	// Event is a domain event written to a service's outbox
+	Event Kind = "evt"
+)
+
+// ErrInvalid is returned (wrapped) for any malformed ID
+var ErrInvalid = errors.New("invalid id")
+
+const (
+	alphabet   = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ulidLength = 26
+	legacyLen  = 16
+)
+
+// ID is a parsed entity ID
+type ID struct {
+	Kind Kind
+	// Time is when the ID was minted; zero for legacy IDs
+	Time time.Time
+	// Legacy is true for the old untyped hex IDs, whose Kind is unknown
+	Legacy bool
+
+	raw string
+}
+
+// String returns the ID as it was parsed
+func (id ID) String() string {
+	return id.raw
+}
+
+var defaultGenerator generator
+
+// New returns a new ID of the given kind. It only fails if the system's
+// secure random source does.
+func New(kind Kind) (string, error) {
+	u, err := defaultGenerator.next(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return string(kind) + "_" + encode(u), nil
+}
+
+// Parse parses an ID of any kind, including legacy hex IDs
+func Parse(s string) (ID, error) {
+	if isLegacy(s) {
+		return ID{Legacy: true, raw: s}, nil
+	}
+	prefix, body, ok := strings.Cut(s, "_")
+	if !ok || prefix == "" {
+		return ID{}, fmt.Errorf("%w: %q has no kind prefix", ErrInvalid, s)
+	}
+	u, err := decode(body)
+	if err != nil {
+		return ID{}, fmt.Errorf("%w: %q: %v", ErrInvalid, s, err)
+	}
+	ms := binary.BigEndian.Uint64(append([]byte{0, 0}, u[:6]...))
+	return ID{Kind: Kind(prefix), Time: time.UnixMilli(int64(ms)), raw: s}, nil
+}
+
+// Validate checks that s is an ID of the given kind. Legacy hex IDs are
+// accepted for every kind so existing records stay addressable.
+func Validate(kind Kind, s string) error {
+	id, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	if !id.Legacy && id.Kind != kind {
+		return fmt.Errorf("%w: %q is not a %s ID", ErrInvalid, s, kind)
+	}
+	return nil
+}
+
+func isLegacy(s string) bool {
+	if len(s) != legacyLen {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// generator produces monotonically increasing ULIDs: within the same
+// millisecond the random part is incremented instead of redrawn, so IDs
+// minted by one process never sort out of order.
+type generator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func (g *generator) next(now time.Time) ([16]byte, error) {
+	var u [16]byte
+	ms := uint64(now.UnixMilli())
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ms <= g.lastMs {
+		// Same millisecond, or the clock stepped backwards
+		ms = g.lastMs
+		if !increment(g.entropy[:]) {
+			return u, errors.New("ids: too many IDs in one millisecond")
+		}
+	} else {
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			return u, fmt.Errorf("ids: read random: %w", err)
+		}
+		g.lastMs = ms
+	}
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(u[:6], ts[2:])
+	copy(u[6:], g.entropy[:])
+	return u, nil
+}
+
+// increment adds one to b as a big-endian number, reporting false on overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits of u as 26 base32 characters. The first
+// character only carries 3 bits, so it is always 0-7.
+func encode(u [16]byte) string {
+	out := make([]byte, ulidLength)
+	for i := range out {
+		var v byte
+		for bit := 0; bit < 5; bit++ {
+			v = v<<1 | bitAt(u, i*5+bit-2)
+		}
+		out[i] = alphabet[v]
+	}
+	return string(out)
+}
+
+func decode(s string) ([16]byte, error) {
+	var u [16]byte
+	if len(s) != ulidLength {
+		return u, fmt.Errorf("want %d characters, got %d", ulidLength, len(s))
+	}
+	if s[0] > '7' {
+		return u, errors.New("timestamp overflows 48 bits")
+	}
+	for i := 0; i < ulidLength; i++ {
+		v := strings.IndexByte(alphabet, s[i])
+		if v < 0 {
+			return u, fmt.Errorf("invalid character %q", s[i])
+		}
+		for bit := 0; bit < 5; bit++ {
+			pos := i*5 + bit - 2
+			if pos < 0 {
+				continue
+			}
+			if v&(1<<(4-bit)) != 0 {
+				u[pos/8] |= 1 << (7 - pos%8)
+			}
+		}
+	}
+	return u, nil
+}
+
+// bitAt returns bit pos of u counting from the most significant bit; the
+// two padding bits before the start read as zero
+func bitAt(u [16]byte, pos int) byte {
+	if pos < 0 {
+		return 0
+	}
+	return (u[pos/8] >> (7 - pos%8)) & 1
+}
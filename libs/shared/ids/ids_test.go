@@ -0,0 +1,106 @@
+package ids
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewIsMonotonic(t *testing.T) {
+	prev, err := New(Order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Far more than one millisecond's worth, so many share a timestamp
+	for range 10000 {
+		id, err := New(Order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= prev {
+			t.Fatalf("%s minted after %s doesn't sort after it", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestGeneratorSurvivesClockStepBack(t *testing.T) {
+	var g generator
+	now := time.Now()
+	first, err := g.next(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := g.next(now.Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encode(second) <= encode(first) {
+		t.Errorf("ID after the clock stepped back sorts before the one minted earlier")
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	s, err := New(Payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	if id.Kind != Payment || id.Legacy || id.String() != s {
+		t.Errorf("Parse(%q) = %+v, want a payment ID", s, id)
+	}
+	if id.Time.Before(before) || id.Time.After(time.Now()) {
+		t.Errorf("Parse(%q).Time = %v, want about %v", s, id.Time, before)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	order, err := New(Order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		kind Kind
+		id   string
+		ok   bool
+	}{
+		{"same kind", Order, order, true},
+		{"other kind", Payment, order, false},
+		{"legacy hex", Order, "0123456789abcdef", true},
+		{"legacy hex for any kind", Payment, "0123456789abcdef", true},
+		{"uppercase hex", Order, "0123456789ABCDEF", false},
+		{"short hex", Order, "0123456789abcde", false},
+		{"no prefix", Order, order[len("ord_"):], false},
+		{"empty prefix", Order, "_" + order[len("ord_"):], false},
+		{"short body", Order, order[:len(order)-1], false},
+		{"bad character", Order, order[:len(order)-1] + "U", false},
+		{"timestamp overflow", Order, "ord_8" + order[len("ord_")+1:], false},
+		{"empty", Order, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.kind, tt.id)
+			if tt.ok && err != nil {
+				t.Errorf("Validate(%s, %q): %v", tt.kind, tt.id, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalid) {
+				t.Errorf("Validate(%s, %q) = %v, want ErrInvalid", tt.kind, tt.id, err)
+			}
+		})
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	id, err := Parse("00ff00ff00ff00ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Legacy || id.Kind != "" || !id.Time.IsZero() {
+		t.Errorf("Parse(legacy) = %+v, want a legacy ID of unknown kind and time", id)
+	}
+}
@@ -0,0 +1,48 @@
+// Package logging writes log lines that carry the request's correlation
+// IDs, so a line can be matched to the trace that produced it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+// Printf logs like log.Printf, prefixed with the request and trace IDs from ctx
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	log.Print(prefix(ctx) + fmt.Sprintf(format, args...))
+}
+
+func prefix(ctx context.Context) string {
+	var p string
+	if id := requestid.FromContext(ctx); id != "" {
+		p += "request_id=" + id + " "
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		p += "trace_id=" + id + " "
+	}
+	return p
+}
+
+// Gin is an access log middleware for gin that includes the request and
+// trace IDs. Use it with gin.New() in place of gin.Default()'s logger. It must
+// run after requestid.Gin and tracing.Gin so both are in the request context.
+func Gin() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %s | %3d | %13v | %15s | %-7s %#v %s%s\n",
+			p.TimeStamp.Format(time.RFC3339),
+			p.StatusCode,
+			p.Latency,
+			p.ClientIP,
+			p.Method,
+			p.Path,
+			prefix(p.Request.Context()),
+			p.ErrorMessage,
+		)
+	})
+}
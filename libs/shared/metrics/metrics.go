@@ -0,0 +1,158 @@
+// Package metrics exposes Prometheus metrics for the services. It owns the
+// process-wide registry, serves it at /metrics and provides RED-style
+// (rate, errors, duration) middleware for gin and net/http that labels
+// requests by route template rather than raw path, so /orders/:id is one
+// series no matter how many orders exist.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is where Handler is mounted
+const Path = "/metrics"
+
+// unmatchedRoute labels requests that didn't match any registered route
+const unmatchedRoute = "unmatched"
+
+// Registry holds every metric exposed by the process. Services register
+// their business metrics on it through Factory.
+var Registry = prometheus.NewRegistry()
+
+// Factory creates metrics that are registered on Registry
+var Factory = promauto.With(Registry)
+
+var (
+	requestsTotal = Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status code.",
+	}, []string{"service", "method", "route", "code"})
+
+	requestDuration = Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method", "route"})
+
+	requestsInFlight = Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	}, []string{"service"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Gin records request metrics for a gin engine, labelled by c.FullPath()
+func Gin(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inFlight := requestsInFlight.WithLabelValues(service)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		observe(service, c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// Middleware records request metrics for a net/http handler, normally a
+// *http.ServeMux. Requests are labelled by the pattern the mux matched.
+func Middleware(service string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight := requestsInFlight.WithLabelValues(service)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// ServeMux fills in r.Pattern while routing. Drop the method of
+		// "GET /path" patterns; it has its own label.
+		route := r.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		if route == "" {
+			route = unmatchedRoute
+		}
+		observe(service, r.Method, route, rec.status, time.Since(start))
+	})
+}
+
+func observe(service, method, route string, status int, elapsed time.Duration) {
+	requestsTotal.WithLabelValues(service, method, route, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(service, method, route).Observe(elapsed.Seconds())
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// NewCounter registers a counter for a business event
+func NewCounter(name, help string) prometheus.Counter {
+	return Factory.NewCounter(prometheus.CounterOpts{Name: name, Help: help})
+}
+
+// NewCounterVec registers a labelled counter for a business event
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	return Factory.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+}
+
+// NewHistogramVec registers a labelled latency histogram in seconds
+func NewHistogramVec(name, help string, labels ...string) *prometheus.HistogramVec {
+	return Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+}
+
+// NewGaugeVec registers a labelled gauge
+func NewGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	return Factory.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+}
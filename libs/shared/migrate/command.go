@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = "usage: migrate up | down [steps] | status"
+
+// RunCommand implements the migrate subcommand shared by every service
+// binary. args are the arguments after "migrate":
+//
+//	migrate up           apply all pending migrations
+//	migrate down [n]     roll back the last n migrations (default 1)
+//	migrate status       list migrations and whether they are applied
+func RunCommand(ctx context.Context, r Runner, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "up":
+		if err := r.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		if err := r.Down(ctx, steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return errors.New(usage)
+	}
+	return printStatus(ctx, r, out)
+}
+
+func printStatus(ctx context.Context, r Runner, out io.Writer) error {
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Description, applied)
+	}
+	return w.Flush()
+}
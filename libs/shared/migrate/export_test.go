@@ -0,0 +1,11 @@
+package migrate
+
+import "time"
+
+// SetLockRenewal makes migrators renew their lock every d, until the
+// returned func restores the default
+func SetLockRenewal(d time.Duration) (restore func()) {
+	old := lockRenewal
+	lockRenewal = d
+	return func() { lockRenewal = old }
+}
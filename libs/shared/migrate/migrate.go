@@ -0,0 +1,287 @@
+// Package migrate applies ordered, versioned schema migrations to a service's
+// Mongo database and records them in a schema_migrations collection.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationsCollection = "schema_migrations"
+	lockCollection       = "schema_migrations_lock"
+	lockID               = "lock"
+
+	// lockTTL bounds how long a crashed migrator can keep others waiting
+	lockTTL      = 5 * time.Minute
+	lockInterval = 500 * time.Millisecond
+)
+
+// lockRenewal is how often a running migrator extends its lock; tests
+// shorten it
+var lockRenewal = lockTTL / 5
+
+// ErrPending is returned by RequireCurrent when the database is behind the
+// migrations compiled into the binary
+var ErrPending = errors.New("migrations pending")
+
+// ErrLockLost is returned (wrapped) by Up and Down when the migration lock
+// expired or was taken over while migrations ran. The migration running at
+// the time may have been cut short; check Status before running again.
+var ErrLockLost = errors.New("migration lock lost")
+
+// Migration is a single schema change. Versions must be unique and positive;
+// they are applied in ascending order and rolled back in descending order.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status describes whether a known migration has been applied
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Runner is implemented by every migration backend, so the migrate
+// subcommand and the startup check don't care where the schema lives
+type Runner interface {
+	Up(ctx context.Context) error
+	Down(ctx context.Context, steps int) error
+	Status(ctx context.Context) ([]Status, error)
+}
+
+type record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator runs Mongo migrations against one database
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+}
+
+// New returns a Migrator for the given migrations, which may be passed in
+// any order
+func New(db *mongo.Database, migrations ...Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q: version must be positive", m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no Up", m.Version)
+		}
+	}
+
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	return &Migrator{db: db, migrations: sorted, owner: owner}, nil
+}
+
+// Up applies every migration that hasn't been applied yet
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := mig.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Description, err)
+			}
+			_, err := m.db.Collection(migrationsCollection).InsertOne(ctx, record{
+				Version:     mig.Version,
+				Description: mig.Description,
+				AppliedAt:   time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("record migration %d: %w", mig.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the most recently applied migrations, steps at a time
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("migration %d (%s) cannot be rolled back", mig.Version, mig.Description)
+			}
+			if err := mig.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("rollback %d (%s): %w", mig.Version, mig.Description, err)
+			}
+			_, err := m.db.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": mig.Version})
+			if err != nil {
+				return fmt.Errorf("unrecord migration %d: %w", mig.Version, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		rec, ok := applied[mig.Version]
+		statuses[i] = Status{
+			Version:     mig.Version,
+			Description: mig.Description,
+			Applied:     ok,
+			AppliedAt:   rec.AppliedAt,
+		}
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]record, error) {
+	cursor, err := m.db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// withLock runs fn while holding the migration lock document. The lock
+// expires after lockTTL so a crashed replica can't block deploys forever;
+// while fn runs it is renewed, and if it is lost fn's context is cancelled
+// and withLock returns ErrLockLost.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	locks := m.db.Collection(lockCollection)
+	var expires time.Time
+	for {
+		now := time.Now()
+		expires = now.Add(lockTTL)
+		_, err := locks.UpdateOne(ctx,
+			bson.M{"_id": lockID, "expires_at": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": m.owner, "expires_at": expires}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		// Another replica holds the lock
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockInterval):
+		}
+	}
+	defer locks.DeleteOne(context.Background(), bson.M{"_id": lockID, "owner": m.owner})
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	renewing := make(chan struct{})
+	go func() {
+		defer close(renewing)
+		m.renewLock(ctx, cancel, expires)
+	}()
+	err := fn(ctx)
+	cancel(nil)
+	<-renewing
+	if cause := context.Cause(ctx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+// renewLock extends the lock, held until expires, every lockRenewal until
+// ctx is done. It cancels ctx with ErrLockLost once another migrator has
+// taken the lock, or once failed renewals leave it about to expire.
+func (m *Migrator) renewLock(ctx context.Context, cancel context.CancelCauseFunc, expires time.Time) {
+	locks := m.db.Collection(lockCollection)
+	ticker := time.NewTicker(lockRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		res, err := locks.UpdateOne(ctx,
+			bson.M{"_id": lockID, "owner": m.owner},
+			bson.M{"$set": bson.M{"expires_at": now.Add(lockTTL)}},
+		)
+		switch {
+		case err == nil && res.MatchedCount == 0:
+			cancel(fmt.Errorf("%w: another migrator took it", ErrLockLost))
+			return
+		case err == nil:
+			expires = now.Add(lockTTL)
+		case ctx.Err() != nil:
+			return
+		case time.Now().Add(lockRenewal).After(expires):
+			// The next try would come too late
+			cancel(fmt.Errorf("%w: renewing it failed: %v", ErrLockLost, err))
+			return
+		}
+	}
+}
+
+// RequireCurrent returns ErrPending if any migration known to r has not
+// been applied, so services can refuse to start against an old schema
+func RequireCurrent(ctx context.Context, r Runner) error {
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []int
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %v (run the migrate subcommand)", ErrPending, pending)
+	}
+	return nil
+}
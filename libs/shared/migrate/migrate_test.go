@@ -0,0 +1,109 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// lockExpiry returns when the migration lock in db expires
+func lockExpiry(ctx context.Context, db *mongo.Database) (time.Time, error) {
+	var lock struct {
+		ExpiresAt time.Time `bson:"expires_at"`
+	}
+	err := db.Collection("schema_migrations_lock").FindOne(ctx, bson.M{"_id": "lock"}).Decode(&lock)
+	return lock.ExpiresAt, err
+}
+
+func TestLockRenewedWhileMigrating(t *testing.T) {
+	db := dbtest.Mongo(t)
+	defer migrate.SetLockRenewal(20 * time.Millisecond)()
+
+	m, err := migrate.New(db, migrate.Migration{
+		Version:     1,
+		Description: "outlast a renewal",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			before, err := lockExpiry(ctx, db)
+			if err != nil {
+				return err
+			}
+			time.Sleep(200 * time.Millisecond)
+			after, err := lockExpiry(ctx, db)
+			if err != nil {
+				return err
+			}
+			if !after.After(before) {
+				t.Errorf("lock expiry went from %v to %v, want it extended", before, after)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+}
+
+func TestLostLockStopsMigrations(t *testing.T) {
+	db := dbtest.Mongo(t)
+	defer migrate.SetLockRenewal(20 * time.Millisecond)()
+	ctx := context.Background()
+
+	secondRan := false
+	m, err := migrate.New(db,
+		migrate.Migration{
+			Version:     1,
+			Description: "lose the lock",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// Another migrator takes the lock over, as it would once the
+				// lock expired
+				_, err := db.Collection("schema_migrations_lock").UpdateOne(ctx,
+					bson.M{"_id": "lock"}, bson.M{"$set": bson.M{"owner": "another-replica"}})
+				if err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(5 * time.Second):
+					t.Error("migration kept running after losing the lock")
+					return nil
+				}
+			},
+		},
+		migrate.Migration{
+			Version:     2,
+			Description: "after the lock was lost",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				secondRan = true
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); !errors.Is(err, migrate.ErrLockLost) {
+		t.Fatalf("Up: err = %v, want ErrLockLost", err)
+	}
+	if secondRan {
+		t.Error("the next migration ran without the lock")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			t.Errorf("migration %d recorded as applied", s.Version)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "12.34", "currency": "USD"}. The
+// amount is a string so clients don't parse it into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.currency == "" {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.currency})
+}
+
+// UnmarshalJSON accepts the object form, with the amount as a string or a
+// number, and the legacy bare number in DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v, err := DecodeJSON(data, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// DecodeJSON decodes a Money, reading a legacy bare number in currency.
+// Handlers use it when the legacy request format sent the currency in a
+// separate field.
+func DecodeJSON(data []byte, currency string) (Money, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return Money{}, nil
+	case len(data) > 0 && data[0] == '{':
+		var v jsonMoney
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return Money{}, err
+		}
+		if v.Currency == "" {
+			return Money{}, fmt.Errorf("%w: currency is required", ErrInvalidAmount)
+		}
+		return Parse(v.Amount.String(), v.Currency)
+	default:
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+		}
+		return Parse(n.String(), currency)
+	}
+}
+
+type bsonMoney struct {
+	Minor    int64  `bson:"minor"`
+	Currency string `bson:"currency"`
+}
+
+// MarshalBSONValue stores m as a {minor, currency} subdocument
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if m.currency == "" {
+		return bson.TypeNull, nil, nil
+	}
+	return bson.MarshalValue(bsonMoney{Minor: m.minor, Currency: m.currency})
+}
+
+// UnmarshalBSONValue reads the subdocument form, and legacy double or
+// integer amounts in DefaultCurrency
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	var (
+		v   Money
+		err error
+	)
+	switch t {
+	case bson.TypeNull, bson.TypeUndefined:
+		v = Money{}
+	case bson.TypeEmbeddedDocument:
+		var doc bsonMoney
+		if err := raw.Unmarshal(&doc); err != nil {
+			return err
+		}
+		v, err = New(doc.Minor, doc.Currency)
+	case bson.TypeDouble:
+		v, err = FromFloat(raw.Double(), DefaultCurrency)
+	case bson.TypeInt32, bson.TypeInt64:
+		v, err = Parse(fmt.Sprint(raw.AsInt64()), DefaultCurrency)
+	default:
+		err = errors.New("money: cannot decode BSON " + t.String())
+	}
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
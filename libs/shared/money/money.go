@@ -0,0 +1,245 @@
+// Package money represents amounts exactly, as an integer number of minor
+// units (cents, pence, yen) in an ISO 4217 currency. Amounts are never
+// floating point once parsed, so sums and splits don't drift.
+//
+// On the wire a Money is
+//
+//	JSON  {"amount": "12.34", "currency": "USD"}
+//	BSON  {minor: 1234, currency: "USD"}
+//
+// During the move away from float64 amounts both decoders also accept a
+// bare number, which is read as an amount in DefaultCurrency.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownCurrency is returned for a code that isn't in the currency table
+	ErrUnknownCurrency = errors.New("money: unknown currency")
+	// ErrCurrencyMismatch is returned when combining amounts in different currencies
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	// ErrInvalidAmount is returned for malformed or out of range amounts
+	ErrInvalidAmount = errors.New("money: invalid amount")
+)
+
+// DefaultCurrency is used for legacy bare-number amounts, which carried no
+// currency of their own
+var DefaultCurrency = "USD"
+
+// Money is an exact amount in one currency. The zero value has no currency
+// and is only useful to detect a missing amount.
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// New returns minor units of currency, e.g. New(1234, "USD") is $12.34
+func New(minor int64, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if _, err := Exponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+// Zero returns an amount of nothing in currency
+func Zero(currency string) (Money, error) {
+	return New(0, currency)
+}
+
+// Parse reads a decimal string such as "12.34" or "-5" in currency. It
+// rejects more decimal places than the currency has.
+func Parse(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := strings.TrimSpace(amount)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || !digits(whole) || !digits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places for %s", ErrInvalidAmount, amount, exp, currency)
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if whole+frac == "" {
+		minor, err = 0, nil
+	}
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, amount)
+	}
+	if neg {
+		minor = -minor
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+// FromFloat converts a legacy float64 amount, rounding to the nearest minor
+// unit. Only use it for data written before amounts were Money.
+func FromFloat(f float64, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, fmt.Errorf("%w: %v", ErrInvalidAmount, f)
+	}
+	return Parse(strconv.FormatFloat(f, 'f', exp, 64), currency)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount in minor units
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+// Currency returns the ISO 4217 code, or "" for the zero value
+func (m Money) Currency() string {
+	return m.currency
+}
+
+// IsZero reports whether the amount is zero (in any currency)
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+// IsNegative reports whether the amount is less than zero
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.currency != o.currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+	sum := m.minor + o.minor
+	if (sum > m.minor) != (o.minor > 0) {
+		return Money{}, fmt.Errorf("%w: overflow", ErrInvalidAmount)
+	}
+	return Money{minor: sum, currency: m.currency}, nil
+}
+
+// Sub returns m - o. Both must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.minor == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: overflow", ErrInvalidAmount)
+	}
+	return m.Add(Money{minor: -o.minor, currency: o.currency})
+}
+
+// Mul returns m * n, e.g. a unit price times a quantity
+func (m Money) Mul(n int64) (Money, error) {
+	p := new(big.Int).Mul(big.NewInt(m.minor), big.NewInt(n))
+	if !p.IsInt64() {
+		return Money{}, fmt.Errorf("%w: overflow", ErrInvalidAmount)
+	}
+	return Money{minor: p.Int64(), currency: m.currency}, nil
+}
+
+// Allocate splits m in proportion to ratios without losing minor units: the
+// remainder left by rounding down is handed out one unit at a time, starting
+// with the first share. Allocate(1, 1, 1) of $1.00 is $0.34, $0.33, $0.33.
+func (m Money) Allocate(ratios ...int) ([]Money, error) {
+	var total int64
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("%w: negative ratio %d", ErrInvalidAmount, r)
+		}
+		total += int64(r)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: ratios must sum to more than zero", ErrInvalidAmount)
+	}
+
+	amount := big.NewInt(m.minor)
+	shares := make([]Money, len(ratios))
+	remainder := m.minor
+	for i, r := range ratios {
+		// Quo truncates toward zero, so negative amounts round toward zero too
+		share := new(big.Int).Mul(amount, big.NewInt(int64(r)))
+		share.Quo(share, big.NewInt(total))
+		shares[i] = Money{minor: share.Int64(), currency: m.currency}
+		remainder -= shares[i].minor
+	}
+
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(shares) {
+		if ratios[i] == 0 {
+			continue
+		}
+		shares[i].minor += step
+		remainder -= step
+	}
+	return shares, nil
+}
+
+// Split divides m into n shares that differ by at most one minor unit
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: cannot split into %d shares", ErrInvalidAmount, n)
+	}
+	ratios := make([]int, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Decimal formats the amount without its currency, e.g. "12.34"
+func (m Money) Decimal() string {
+	exp, _ := Exponent(m.currency)
+	s := strconv.FormatInt(m.minor, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+		s = s[:len(s)-exp] + "." + s[len(s)-exp:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// String formats the amount with its currency, e.g. "12.34 USD"
+func (m Money) String() string {
+	if m.currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.currency
+}
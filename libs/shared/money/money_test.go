@@ -0,0 +1,309 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mustNew returns New(minor, currency), failing the test on an error
+func mustNew(t *testing.T, minor int64, currency string) Money {
+	t.Helper()
+	m, err := New(minor, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		minor            int64
+		err              error
+	}{
+		{"12.34", "USD", 1234, nil},
+		{"12.3", "usd", 1230, nil},
+		{"12", "USD", 1200, nil},
+		{"12.", "USD", 1200, nil},
+		{".5", "USD", 50, nil},
+		{"-5", "USD", -500, nil},
+		{"+5.01", "USD", 501, nil},
+		{" 7.00 ", "EUR", 700, nil},
+		// Trailing zeros beyond the exponent are not extra precision
+		{"1.2300", "USD", 123, nil},
+		{"1234", "JPY", 1234, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"0", "USD", 0, nil},
+		{"12.345", "USD", 0, ErrInvalidAmount},
+		{"1.5", "JPY", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{".", "USD", 0, ErrInvalidAmount},
+		{"-", "USD", 0, ErrInvalidAmount},
+		{"1,00", "USD", 0, ErrInvalidAmount},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{"--1", "USD", 0, ErrInvalidAmount},
+		{"92233720368547758.08", "USD", 0, ErrInvalidAmount},
+		{"1", "XXX", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		m, err := Parse(tt.amount, tt.currency)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q, %s) = %v, %v; want %v", tt.amount, tt.currency, m, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || m.Minor() != tt.minor {
+			t.Errorf("Parse(%q, %s) = %v, %v; want %d minor units", tt.amount, tt.currency, m, err, tt.minor)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		f        float64
+		currency string
+		minor    int64
+	}{
+		{12.34, "USD", 1234},
+		// Sums that drift in binary land on the intended cent
+		{0.1 + 0.2, "USD", 30},
+		{19.999, "USD", 2000},
+		{-4.996, "USD", -500},
+		// 1.005 is just below 1.005 in binary, so it rounds down
+		{1.005, "USD", 100},
+		{1234.6, "JPY", 1235},
+		{0.0005, "KWD", 1},
+	}
+	for _, tt := range tests {
+		m, err := FromFloat(tt.f, tt.currency)
+		if err != nil || m.Minor() != tt.minor || m.Currency() != tt.currency {
+			t.Errorf("FromFloat(%v, %s) = %v, %v; want %d minor units", tt.f, tt.currency, m, err, tt.minor)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), 1e300} {
+		if _, err := FromFloat(f, "USD"); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("FromFloat(%v) err = %v, want ErrInvalidAmount", f, err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b  Money
+		minor int64
+		err   error
+	}{
+		{mustNew(t, 150, "USD"), mustNew(t, 250, "USD"), 400, nil},
+		{mustNew(t, 150, "USD"), mustNew(t, -250, "USD"), -100, nil},
+		{mustNew(t, math.MaxInt64, "USD"), mustNew(t, 0, "USD"), math.MaxInt64, nil},
+		{mustNew(t, math.MaxInt64, "USD"), mustNew(t, 1, "USD"), 0, ErrInvalidAmount},
+		{mustNew(t, math.MinInt64, "USD"), mustNew(t, -1, "USD"), 0, ErrInvalidAmount},
+		{mustNew(t, 1, "USD"), mustNew(t, 1, "EUR"), 0, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		sum, err := tt.a.Add(tt.b)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v + %v = %v, %v; want %v", tt.a, tt.b, sum, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || sum.Minor() != tt.minor {
+			t.Errorf("%v + %v = %v, %v; want %d minor units", tt.a, tt.b, sum, err, tt.minor)
+		}
+	}
+	if _, err := mustNew(t, 0, "USD").Sub(mustNew(t, math.MinInt64, "USD")); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("0 - MinInt64 err = %v, want overflow", err)
+	}
+}
+
+func TestMul(t *testing.T) {
+	price := mustNew(t, 1999, "USD")
+	if got, err := price.Mul(3); err != nil || got != mustNew(t, 5997, "USD") {
+		t.Errorf("%v * 3 = %v, %v", price, got, err)
+	}
+	if got, err := price.Mul(-2); err != nil || got.Minor() != -3998 {
+		t.Errorf("%v * -2 = %v, %v", price, got, err)
+	}
+	if _, err := mustNew(t, math.MaxInt64/2+1, "USD").Mul(2); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("overflowing Mul err = %v, want ErrInvalidAmount", err)
+	}
+}
+
+// minors returns the minor units of shares
+func minors(shares []Money) []int64 {
+	out := make([]int64, len(shares))
+	for i, s := range shares {
+		out[i] = s.Minor()
+	}
+	return out
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		minor  int64
+		ratios []int
+		want   []int64
+	}{
+		{100, []int{1, 1, 1}, []int64{34, 33, 33}},
+		{101, []int{1, 1, 1}, []int64{34, 34, 33}},
+		{-100, []int{1, 1, 1}, []int64{-34, -33, -33}},
+		{5, []int{3, 7}, []int64{2, 3}},
+		// Shares with a zero ratio get nothing, not even remainder
+		{100, []int{0, 1, 1, 1}, []int64{0, 34, 33, 33}},
+		{0, []int{1, 2}, []int64{0, 0}},
+		// Large enough that amount * ratio overflows int64
+		{math.MaxInt64, []int{1, 1}, []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+	}
+	for _, tt := range tests {
+		shares, err := mustNew(t, tt.minor, "USD").Allocate(tt.ratios...)
+		if err != nil {
+			t.Errorf("Allocate(%d, %v): %v", tt.minor, tt.ratios, err)
+			continue
+		}
+		if got := minors(shares); !slices.Equal(got, tt.want) {
+			t.Errorf("Allocate(%d, %v) = %v, want %v", tt.minor, tt.ratios, got, tt.want)
+		}
+		for _, s := range shares {
+			if s.Currency() != "USD" {
+				t.Errorf("share %v lost its currency", s)
+			}
+		}
+	}
+	for _, ratios := range [][]int{{}, {0, 0}, {1, -1}} {
+		if _, err := mustNew(t, 100, "USD").Allocate(ratios...); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Allocate(%v) err = %v, want ErrInvalidAmount", ratios, err)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	shares, err := mustNew(t, 1000, "JPY").Split(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := minors(shares); !slices.Equal(got, []int64{334, 333, 333}) {
+		t.Errorf("Split(3) of 1000 JPY = %v", got)
+	}
+	if _, err := mustNew(t, 1000, "JPY").Split(0); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Split(0) err = %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{mustNew(t, 1234, "USD"), "12.34 USD"},
+		{mustNew(t, 5, "USD"), "0.05 USD"},
+		{mustNew(t, -5, "USD"), "-0.05 USD"},
+		{mustNew(t, 1234, "JPY"), "1234 JPY"},
+		{mustNew(t, 1, "KWD"), "0.001 KWD"},
+		{Money{}, "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := mustNew(t, 1234, "USD")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"12.34","currency":"USD"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`{"amount":"12.34","currency":"USD"}`, m},
+		{`{"amount":12.34,"currency":"usd"}`, m},
+		// Legacy bare numbers are in DefaultCurrency
+		{`12.34`, m},
+		{`1234`, mustNew(t, 123400, "USD")},
+		{`null`, Money{}},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`{"amount":"1.00"}`, `{"amount":"1.001","currency":"USD"}`, `true`} {
+		var got Money
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want an error", in, got)
+		}
+	}
+
+	// Handlers read legacy requests' separate currency field
+	if got, err := DecodeJSON([]byte(`1500`), "JPY"); err != nil || got != mustNew(t, 1500, "JPY") {
+		t.Errorf("DecodeJSON(1500, JPY) = %v, %v", got, err)
+	}
+}
+
+func TestBSON(t *testing.T) {
+	type doc struct {
+		Amount Money `bson:"amount"`
+	}
+	m := mustNew(t, 1234, "EUR")
+	data, err := bson.Marshal(doc{m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bson.M
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if sub, ok := raw["amount"].(bson.M); !ok || sub["minor"] != int64(1234) || sub["currency"] != "EUR" {
+		t.Errorf("stored as %v, want {minor: 1234, currency: EUR}", raw["amount"])
+	}
+
+	tests := []struct {
+		name string
+		in   bson.M
+		want Money
+	}{
+		{"subdocument", bson.M{"amount": bson.M{"minor": int64(1234), "currency": "EUR"}}, m},
+		// Documents written before Money stored amounts as numbers
+		{"legacy double", bson.M{"amount": 12.34}, mustNew(t, 1234, "USD")},
+		{"legacy drifted double", bson.M{"amount": 0.1 + 0.2}, mustNew(t, 30, "USD")},
+		{"legacy int32", bson.M{"amount": int32(12)}, mustNew(t, 1200, "USD")},
+		{"legacy int64", bson.M{"amount": int64(12)}, mustNew(t, 1200, "USD")},
+		{"null", bson.M{"amount": nil}, Money{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got doc
+			if err := bson.Unmarshal(data, &got); err != nil || got.Amount != tt.want {
+				t.Errorf("Unmarshal = %v, %v; want %v", got.Amount, err, tt.want)
+			}
+		})
+	}
+
+	data, err = bson.Marshal(bson.M{"amount": "12.34"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got doc
+	if err := bson.Unmarshal(data, &got); err == nil {
+		t.Errorf("Unmarshal(string) = %v, want an error", got.Amount)
+	}
+}
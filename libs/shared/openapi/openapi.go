@@ -0,0 +1,181 @@
+// Package openapi checks a service's OpenAPI spec against the routes it
+// actually registers, so the spec that client SDKs are written against can't
+// silently drift from the code. Each service runs the check through its
+// "speccheck" subcommand, which CI calls after building it.
+package openapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// Operational lists the paths every service serves outside its API, the
+// health probes, metrics and build info, which specs don't document
+var Operational = append(append([]string{}, health.Paths...), metrics.Path, buildinfo.Path)
+
+// Route is one operation: an upper-case method and an OpenAPI path template
+// such as /orders/{id}
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+	http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace,
+}
+
+// SpecRoutes returns the operations declared under paths in an OpenAPI
+// document
+func SpecRoutes(spec []byte) ([]Route, error) {
+	var doc struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	var routes []Route
+	for path, item := range doc.Paths {
+		for _, m := range methods {
+			if _, ok := item[strings.ToLower(m)]; ok {
+				routes = append(routes, Route{Method: m, Path: path})
+			}
+		}
+	}
+	return routes, nil
+}
+
+var ginParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// GinRoutes returns the routes registered on a gin engine, with :id and
+// *path parameters rewritten to {id} and {path}
+func GinRoutes(r *gin.Engine) []Route {
+	var routes []Route
+	for _, info := range r.Routes() {
+		routes = append(routes, Route{
+			Method: info.Method,
+			Path:   ginParam.ReplaceAllString(info.Path, "{$1}"),
+		})
+	}
+	return routes
+}
+
+// MuxRoute parses a "METHOD /path/{param}" http.ServeMux pattern
+func MuxRoute(pattern string) Route {
+	method, path, _ := strings.Cut(pattern, " ")
+	return Route{Method: method, Path: strings.TrimSuffix(path, "{$}")}
+}
+
+// Diff compares spec against routes, ignoring any route whose path is in
+// ignore (health probes, metrics). It returns the operations only the spec
+// has and those only the code has.
+func Diff(spec []byte, routes []Route, ignore ...string) (onlySpec, onlyCode []Route, err error) {
+	declared, err := SpecRoutes(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	skip := make(map[string]bool, len(ignore))
+	for _, p := range ignore {
+		skip[p] = true
+	}
+	inSpec := make(map[Route]bool, len(declared))
+	for _, r := range declared {
+		inSpec[r] = true
+	}
+	inCode := make(map[Route]bool, len(routes))
+	for _, r := range routes {
+		if skip[r.Path] {
+			continue
+		}
+		inCode[r] = true
+		if !inSpec[r] {
+			onlyCode = append(onlyCode, r)
+		}
+	}
+	for _, r := range declared {
+		if !inCode[r] && !skip[r.Path] {
+			onlySpec = append(onlySpec, r)
+		}
+	}
+	sortRoutes(onlySpec)
+	sortRoutes(onlyCode)
+	return onlySpec, onlyCode, nil
+}
+
+// Check runs Diff and reports every mismatch to out, returning an error if
+// there were any
+func Check(spec []byte, routes []Route, out io.Writer, ignore ...string) error {
+	onlySpec, onlyCode, err := Diff(spec, routes, ignore...)
+	if err != nil {
+		return err
+	}
+	for _, r := range onlySpec {
+		fmt.Fprintf(out, "documented but not registered: %s\n", r)
+	}
+	for _, r := range onlyCode {
+		fmt.Fprintf(out, "registered but not documented: %s\n", r)
+	}
+	if n := len(onlySpec) + len(onlyCode); n > 0 {
+		return fmt.Errorf("spec and routes differ in %d operations", n)
+	}
+	fmt.Fprintln(out, "spec matches registered routes")
+	return nil
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
+
+// Router is satisfied by *http.ServeMux
+type Router interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// CheckRouted reports to out every operation in spec that mux doesn't route,
+// for the gateway, whose routes are prefixes forwarded to the services
+func CheckRouted(spec []byte, mux Router, out io.Writer) error {
+	declared, err := SpecRoutes(spec)
+	if err != nil {
+		return err
+	}
+	sortRoutes(declared)
+	var missing int
+	for _, route := range declared {
+		// Any value will do for path parameters
+		path := specParam.ReplaceAllString(route.Path, "x")
+		req, err := http.NewRequest(route.Method, path, nil)
+		if err != nil {
+			return err
+		}
+		if _, pattern := mux.Handler(req); pattern == "" || strings.HasSuffix(pattern, "/") && path+"/" == pattern {
+			fmt.Fprintf(out, "documented but not routed: %s\n", route)
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d documented operations are not routed", missing)
+	}
+	fmt.Fprintln(out, "every documented operation is routed")
+	return nil
+}
+
+var specParam = regexp.MustCompile(`\{[^/}]+\}`)
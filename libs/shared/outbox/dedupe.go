@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Handler handles an event delivered to a consumer
+type Handler func(ctx context.Context, e Event) error
+
+// Deduplicator remembers which events each consumer has handled, so a
+// consumer can ignore the redeliveries at-least-once delivery brings
+type Deduplicator interface {
+	// Seen reports whether consumer has handled the event with id
+	Seen(ctx context.Context, consumer, id string) (bool, error)
+	// Mark records that consumer has handled the event with id
+	Mark(ctx context.Context, consumer, id string) error
+}
+
+// Once wraps h so that consumer skips events it has already handled. An
+// event is marked only after h succeeds, so a failure or a crash before
+// marking lets it be handled again; h should tolerate that, and two
+// deliveries of one event racing each other.
+func Once(consumer string, d Deduplicator, h Handler) Handler {
+	return func(ctx context.Context, e Event) error {
+		seen, err := d.Seen(ctx, consumer, e.ID)
+		if err != nil || seen {
+			return err
+		}
+		if err := h(ctx, e); err != nil {
+			return err
+		}
+		return d.Mark(ctx, consumer, e.ID)
+	}
+}
+
+// mongoDeduplicator keeps one document per consumer and event
+type mongoDeduplicator struct {
+	coll *mongo.Collection
+}
+
+// NewMongoDeduplicator remembers handled events in coll. A TTL index on
+// handled_at can bound it to the window in which redeliveries happen.
+func NewMongoDeduplicator(coll *mongo.Collection) Deduplicator {
+	return &mongoDeduplicator{coll: coll}
+}
+
+func handledID(consumer, id string) string {
+	return consumer + "/" + id
+}
+
+func (d *mongoDeduplicator) Seen(ctx context.Context, consumer, id string) (bool, error) {
+	n, err := d.coll.CountDocuments(ctx, bson.M{"_id": handledID(consumer, id)}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (d *mongoDeduplicator) Mark(ctx context.Context, consumer, id string) error {
+	_, err := d.coll.InsertOne(ctx, bson.M{
+		"_id":        handledID(consumer, id),
+		"consumer":   consumer,
+		"event_id":   id,
+		"handled_at": time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// A racing delivery marked it first
+		return nil
+	}
+	return err
+}
+
+// memoryDeduplicator keeps handled events in a set, for tests
+type memoryDeduplicator struct {
+	mu      sync.Mutex
+	handled map[string]bool
+}
+
+// NewMemoryDeduplicator returns a Deduplicator that has seen nothing
+func NewMemoryDeduplicator() Deduplicator {
+	return &memoryDeduplicator{handled: make(map[string]bool)}
+}
+
+func (d *memoryDeduplicator) Seen(ctx context.Context, consumer, id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.handled[handledID(consumer, id)], nil
+}
+
+func (d *memoryDeduplicator) Mark(ctx context.Context, consumer, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handled[handledID(consumer, id)] = true
+	return nil
+}
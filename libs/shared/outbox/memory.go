@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Memory is an outbox kept in memory, for tests and local runs without a
+// database. Stores that use it append while holding their own lock, which
+// stands in for the transaction.
+type Memory struct {
+	mu        sync.Mutex
+	events    []Event
+	published map[string]time.Time
+	sequences map[aggregate]int64
+	holder    string
+	until     time.Time
+}
+
+// NewMemory returns an empty in-memory outbox
+func NewMemory() *Memory {
+	return &Memory{
+		published: make(map[string]time.Time),
+		sequences: make(map[aggregate]int64),
+	}
+}
+
+// Append records events, numbering each within its aggregate and tagging
+// it with the trace of ctx
+func (m *Memory) Append(ctx context.Context, events ...Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range events {
+		e = withTrace(ctx, e)
+		m.sequences[e.aggregate()]++
+		e.Sequence = m.sequences[e.aggregate()]
+		m.events = append(m.events, e)
+	}
+	return nil
+}
+
+// Events returns every event recorded, published or not, in the order they
+// were appended
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.events)
+}
+
+// Pending returns the unpublished events in the order they were appended,
+// which is each aggregate's sequence order
+func (m *Memory) Pending(ctx context.Context, limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []Event
+	for _, e := range m.events {
+		if len(pending) == limit {
+			break
+		}
+		if _, ok := m.published[e.ID]; !ok {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Memory) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		m.published[id] = at
+	}
+	return nil
+}
+
+func (m *Memory) Lease(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.holder != holder && now.Before(m.until) {
+		return false, nil
+	}
+	m.holder, m.until = holder, now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The collections of an outbox. The service's migrations create them and
+// their indexes.
+const (
+	eventsCollection = "outbox"
+	// sequencesCollection holds the last sequence number of each aggregate
+	sequencesCollection = "outbox_sequences"
+	leaseCollection     = "outbox_lease"
+	leaseID             = "relay"
+)
+
+// Mongo is the outbox of one database. Mongo transactions need a replica
+// set, which may have a single member.
+type Mongo struct {
+	db *mongo.Database
+}
+
+// NewMongo returns the outbox of db
+func NewMongo(db *mongo.Database) *Mongo {
+	return &Mongo{db: db}
+}
+
+// mongoEvent is an event as stored. PublishedAt stays null until the relay
+// has published it, so unpublished events can be found through an index.
+type mongoEvent struct {
+	Event       `bson:",inline"`
+	PublishedAt *time.Time `bson:"published_at"`
+}
+
+// Transact runs fn in a transaction, passing it the context to make its
+// writes and Append with. fn may run more than once if the transaction hits
+// a transient error, such as a write conflict.
+func (m *Mongo) Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	sess, err := m.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+	_, err = sess.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// Append records events, numbering each within its aggregate and tagging
+// it with the trace of ctx. ctx must be one Transact passed to its function.
+func (m *Mongo) Append(ctx context.Context, events ...Event) error {
+	docs := make([]any, len(events))
+	for i, e := range events {
+		e = withTrace(ctx, e)
+		var seq struct {
+			Seq int64 `bson:"seq"`
+		}
+		err := m.db.Collection(sequencesCollection).FindOneAndUpdate(ctx,
+			bson.M{"_id": e.AggregateType + "/" + e.AggregateID},
+			bson.M{"$inc": bson.M{"seq": 1}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&seq)
+		if err != nil {
+			return err
+		}
+		e.Sequence = seq.Seq
+		docs[i] = mongoEvent{Event: e}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	_, err := m.db.Collection(eventsCollection).InsertMany(ctx, docs)
+	return err
+}
+
+func (m *Mongo) Pending(ctx context.Context, limit int) ([]Event, error) {
+	// Sorting by time alone could cut a batch between an aggregate's events
+	// whose clocks disagree, leaving out one that must go first
+	cur, err := m.db.Collection(eventsCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"published_at": nil}}},
+		{{Key: "$setWindowFields", Value: bson.M{
+			"partitionBy": bson.M{"type": "$aggregate_type", "id": "$aggregate_id"},
+			"output":      bson.M{"first_at": bson.M{"$min": "$occurred_at"}},
+		}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "first_at", Value: 1},
+			{Key: "aggregate_type", Value: 1},
+			{Key: "aggregate_id", Value: 1},
+			{Key: "sequence", Value: 1},
+		}}},
+		{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (m *Mongo) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	_, err := m.db.Collection(eventsCollection).UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"published_at": at}},
+	)
+	return err
+}
+
+func (m *Mongo) Lease(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	_, err := m.db.Collection(leaseCollection).UpdateOne(ctx,
+		bson.M{"_id": leaseID, "$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another relay holds the lease
+		return false, nil
+	}
+	return err == nil, err
+}
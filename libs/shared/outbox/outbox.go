@@ -0,0 +1,129 @@
+// Package outbox implements the transactional outbox. A service appends the
+// domain events of a state change to its outbox in the same transaction as
+// the change itself, so an event is recorded if and only if the change is.
+// A Relay then delivers the recorded events to an event bus through a
+// Publisher:
+//
+//	events := outbox.NewMongo(db)
+//	err := events.Transact(ctx, func(ctx context.Context) error {
+//		if _, err := orders.InsertOne(ctx, order); err != nil {
+//			return err
+//		}
+//		return events.Append(ctx, created)
+//	})
+//	...
+//	go outbox.NewRelay(events, publisher, time.Second).Run(ctx)
+//
+// Delivery is at least once: an event is marked published only after the
+// bus accepted it, so a crash in between publishes it again. Consumers
+// dedupe on Event.ID with Once. Events of one aggregate are numbered by
+// Sequence and published in that order.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Event is a domain event: something that happened to one aggregate, such
+// as an order or a payment
+type Event struct {
+	ID string `json:"id" bson:"_id"`
+	// Type names what happened, e.g. "order.created"
+	Type          string `json:"type" bson:"type"`
+	AggregateType string `json:"aggregate_type" bson:"aggregate_type"`
+	AggregateID   string `json:"aggregate_id" bson:"aggregate_id"`
+	// Sequence numbers the aggregate's events from 1, in the order they
+	// were appended. Append assigns it.
+	Sequence   int64           `json:"sequence" bson:"sequence"`
+	Payload    json.RawMessage `json:"payload" bson:"payload"`
+	OccurredAt time.Time       `json:"occurred_at" bson:"occurred_at"`
+	// TraceContext is the W3C trace context, e.g. the traceparent, of the
+	// request that made the change. Append records it from its context.
+	TraceContext map[string]string `json:"trace_context,omitempty" bson:"trace_context,omitempty"`
+}
+
+// New returns an event of type typ that happened to an aggregate at at,
+// with payload encoded as JSON
+func New(aggregateType, aggregateID, typ string, payload any, at time.Time) (Event, error) {
+	id, err := ids.New(ids.Event)
+	if err != nil {
+		return Event{}, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:            id,
+		Type:          typ,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       data,
+		OccurredAt:    at.UTC(),
+	}, nil
+}
+
+// withTrace returns e carrying the trace of ctx, unless it has one already
+func withTrace(ctx context.Context, e Event) Event {
+	if e.TraceContext != nil {
+		return e
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		e.TraceContext = carrier
+	}
+	return e
+}
+
+// aggregate identifies the aggregate an event happened to
+type aggregate struct {
+	typ, id string
+}
+
+func (e Event) aggregate() aggregate {
+	return aggregate{typ: e.AggregateType, id: e.AggregateID}
+}
+
+// Store is the relay's view of an outbox
+type Store interface {
+	// Pending returns up to limit unpublished events. Each aggregate's come
+	// in sequence order from its first unpublished one, so no event is
+	// returned without those before it; aggregates come oldest first.
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	// MarkPublished records that the events with ids were published at at
+	MarkPublished(ctx context.Context, ids []string, at time.Time) error
+	// Lease makes holder the only relay publishing from the outbox until
+	// ttl from now, reporting false if another holder's lease hasn't
+	// expired. The holder renews it by leasing again.
+	Lease(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+}
+
+// Publisher delivers events to an event bus. An error means the event may
+// not have been delivered and will be published again.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// PublisherFunc adapts a function to a Publisher
+type PublisherFunc func(ctx context.Context, e Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// LogPublisher logs events instead of delivering them, for services that
+// have no event bus configured
+func LogPublisher(service string) Publisher {
+	return PublisherFunc(func(ctx context.Context, e Event) error {
+		log.Printf("[%s] Event %s %s %s/%s #%d", service, e.ID, e.Type, e.AggregateType, e.AggregateID, e.Sequence)
+		return nil
+	})
+}
@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// outboxSQL creates the tables Postgres uses, as the services' migrations do
+const outboxSQL = `
+CREATE TABLE outbox_events (
+    id             TEXT PRIMARY KEY,
+    type           TEXT NOT NULL,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id   TEXT NOT NULL,
+    sequence       BIGINT NOT NULL,
+    payload        JSONB NOT NULL,
+    occurred_at    TIMESTAMPTZ NOT NULL,
+    published_at   TIMESTAMPTZ,
+    trace_context  JSONB,
+    UNIQUE (aggregate_type, aggregate_id, sequence)
+);
+CREATE TABLE outbox_sequences (
+    aggregate_type TEXT NOT NULL,
+    aggregate_id   TEXT NOT NULL,
+    seq            BIGINT NOT NULL,
+    PRIMARY KEY (aggregate_type, aggregate_id)
+);
+CREATE TABLE outbox_lease (
+    id         TEXT PRIMARY KEY,
+    holder     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+`
+
+// appendFunc appends events to an outbox in one transaction
+type appendFunc func(ctx context.Context, events ...Event) error
+
+// testEvent returns an event of type typ for the order id at at
+func testEvent(t *testing.T, id, typ string, at time.Time) Event {
+	t.Helper()
+	e, err := New("order", id, typ, map[string]string{"id": id}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// testPendingInSequence checks that a batch never holds an aggregate's event
+// without the ones before it, even when their times are out of order
+func testPendingInSequence(t *testing.T, store Store, appendEvents appendFunc) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+	// The order's events were stamped by replicas whose clocks disagree, so
+	// its second event looks older than its first
+	for _, events := range [][]Event{
+		{testEvent(t, "ord_other", "order.created", now.Add(-time.Minute))},
+		{testEvent(t, "ord_skewed", "order.created", now.Add(time.Second))},
+		{testEvent(t, "ord_skewed", "order.paid", now)},
+	} {
+		if err := appendEvents(ctx, events...); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	// Publish one event per batch, so the batches overlap
+	var seen []string
+	for range 3 {
+		batch, err := store.Pending(ctx, 2)
+		if err != nil {
+			t.Fatalf("Pending: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, e := range batch {
+			seen = append(seen, e.AggregateID+" "+e.Type)
+		}
+		if err := store.MarkPublished(ctx, []string{batch[0].ID}, time.Now()); err != nil {
+			t.Fatalf("MarkPublished: %v", err)
+		}
+	}
+	want := []string{
+		"ord_other order.created", "ord_skewed order.created",
+		"ord_skewed order.created", "ord_skewed order.paid",
+		"ord_skewed order.paid",
+	}
+	if !slices.Equal(seen, want) {
+		t.Errorf("batches = %v, want %v", seen, want)
+	}
+}
+
+func TestMemoryPendingInSequence(t *testing.T) {
+	m := NewMemory()
+	testPendingInSequence(t, m, m.Append)
+}
+
+func TestMongoPendingInSequence(t *testing.T) {
+	m := NewMongo(dbtest.Mongo(t))
+	testPendingInSequence(t, m, func(ctx context.Context, events ...Event) error {
+		return m.Transact(ctx, func(ctx context.Context) error {
+			return m.Append(ctx, events...)
+		})
+	})
+}
+
+func TestPostgresPendingInSequence(t *testing.T) {
+	pool := dbtest.Postgres(t, fstest.MapFS{
+		"0001_outbox.up.sql":   {Data: []byte(outboxSQL)},
+		"0001_outbox.down.sql": {Data: []byte("DROP TABLE outbox_lease, outbox_sequences, outbox_events;")},
+	})
+	p := NewPostgres(pool)
+	testPendingInSequence(t, p, func(ctx context.Context, events ...Event) error {
+		return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			return p.Append(ctx, tx, events...)
+		})
+	})
+}
+
+func TestAppendRecordsTrace(t *testing.T) {
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), span)
+
+	m := NewMemory()
+	if err := m.Append(ctx, testEvent(t, "ord_1", "order.created", time.Now())); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	got := m.Events()[0].TraceContext["traceparent"]
+	if want := "00-" + span.TraceID().String() + "-" + span.SpanID().String() + "-01"; got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+}
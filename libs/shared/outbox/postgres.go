@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres is the outbox kept in a database's outbox_events,
+// outbox_sequences and outbox_lease tables, which the service's migrations
+// create
+type Postgres struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgres returns the outbox of the database pool connects to
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{pool: pool}
+}
+
+// Append records events in tx, numbering each within its aggregate and
+// tagging it with the trace of ctx. The sequence row stays locked until tx
+// ends, so concurrent changes to one aggregate are numbered in commit order.
+func (p *Postgres) Append(ctx context.Context, tx pgx.Tx, events ...Event) error {
+	for _, e := range events {
+		e = withTrace(ctx, e)
+		err := tx.QueryRow(ctx, `
+			INSERT INTO outbox_sequences (aggregate_type, aggregate_id, seq)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (aggregate_type, aggregate_id) DO UPDATE SET seq = outbox_sequences.seq + 1
+			RETURNING seq`,
+			e.AggregateType, e.AggregateID,
+		).Scan(&e.Sequence)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO outbox_events (id, type, aggregate_type, aggregate_id, sequence, payload, occurred_at, trace_context)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			e.ID, e.Type, e.AggregateType, e.AggregateID, e.Sequence, e.Payload, e.OccurredAt, e.TraceContext,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) Pending(ctx context.Context, limit int) ([]Event, error) {
+	// Ordering by time alone could cut a batch between an aggregate's
+	// events whose clocks disagree, leaving out one that must go first
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, type, aggregate_type, aggregate_id, sequence, payload, occurred_at, trace_context
+		FROM (
+			SELECT *, min(occurred_at) OVER (PARTITION BY aggregate_type, aggregate_id) AS first_at
+			FROM outbox_events
+			WHERE published_at IS NULL
+		) pending
+		ORDER BY first_at, aggregate_type, aggregate_id, sequence
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &e.Sequence, &e.Payload, &e.OccurredAt, &e.TraceContext); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (p *Postgres) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	_, err := p.pool.Exec(ctx, `UPDATE outbox_events SET published_at = $1 WHERE id = ANY($2)`, at, ids)
+	return err
+}
+
+func (p *Postgres) Lease(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO outbox_lease (id, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE outbox_lease.holder = EXCLUDED.holder OR outbox_lease.expires_at < $4`,
+		leaseID, holder, now.Add(ttl), now,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
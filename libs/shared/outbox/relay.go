@@ -0,0 +1,130 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+)
+
+const (
+	// batchSize is how many pending events a relay reads at a time
+	batchSize = 100
+	// leaseIntervals is how many intervals a relay's lease outlives its
+	// last renewal, so a relay that died is replaced within a few
+	leaseIntervals = 5
+)
+
+var (
+	eventsPublished = metrics.NewCounterVec(
+		"outbox_events_published_total",
+		"Outbox events delivered to the event bus, by type.",
+		"type",
+	)
+	publishFailures = metrics.NewCounterVec(
+		"outbox_publish_failures_total",
+		"Outbox events the event bus refused, by type.",
+		"type",
+	)
+)
+
+// Relay publishes the events recorded in an outbox. Every replica of a
+// service may run one; a lease in the outbox lets only one of them publish
+// at a time, which keeps each aggregate's events in order.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+	holder    string
+}
+
+// NewRelay returns a Relay that publishes store's events to publisher,
+// looking for new ones every interval
+func NewRelay(store Store, publisher Publisher, interval time.Duration) *Relay {
+	host, _ := os.Hostname()
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		interval:  interval,
+		holder:    fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+	}
+}
+
+// Run publishes pending events every interval until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[outbox] Relaying events failed: %v", err)
+			}
+		}
+	}
+}
+
+// Flush publishes the pending events, if r holds the lease, and returns how
+// many it published. An event the publisher refuses holds back the later
+// events of its aggregate until a later flush.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	ok, err := r.store.Lease(ctx, r.holder, leaseIntervals*r.interval)
+	if err != nil || !ok {
+		return 0, err
+	}
+	total := 0
+	for {
+		events, err := r.store.Pending(ctx, batchSize)
+		if err != nil {
+			return total, err
+		}
+		published := r.publish(ctx, events)
+		if len(published) > 0 {
+			if err := r.store.MarkPublished(ctx, published, time.Now()); err != nil {
+				return total, err
+			}
+		}
+		total += len(published)
+		if len(events) < batchSize || len(published) < len(events) {
+			// Drained, or stuck on a refused event until the next tick
+			return total, nil
+		}
+	}
+}
+
+// publish publishes events aggregate by aggregate, in sequence, and returns
+// the IDs of those the publisher accepted. It stops at an aggregate's first
+// refused event so none of its later events overtake it.
+func (r *Relay) publish(ctx context.Context, events []Event) []string {
+	var order []aggregate
+	byAggregate := make(map[aggregate][]Event)
+	for _, e := range events {
+		a := e.aggregate()
+		if _, ok := byAggregate[a]; !ok {
+			order = append(order, a)
+		}
+		byAggregate[a] = append(byAggregate[a], e)
+	}
+	var published []string
+	for _, a := range order {
+		pending := byAggregate[a]
+		slices.SortFunc(pending, func(x, y Event) int { return cmp.Compare(x.Sequence, y.Sequence) })
+		for _, e := range pending {
+			if err := r.publisher.Publish(ctx, e); err != nil {
+				publishFailures.WithLabelValues(e.Type).Inc()
+				log.Printf("[outbox] Publishing %s %s failed: %v", e.Type, e.ID, err)
+				break
+			}
+			eventsPublished.WithLabelValues(e.Type).Inc()
+			published = append(published, e.ID)
+		}
+	}
+	return published
+}
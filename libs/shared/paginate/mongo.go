@@ -0,0 +1,71 @@
+package paginate
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoFilter returns the conditions on p's created range and cursor
+func (p Params) MongoFilter(f Fields) bson.D {
+	var conds bson.D
+	created := bson.D{}
+	if !p.CreatedAfter.IsZero() {
+		created = append(created, bson.E{Key: "$gt", Value: p.CreatedAfter})
+	}
+	if !p.CreatedBefore.IsZero() {
+		created = append(created, bson.E{Key: "$lt", Value: p.CreatedBefore})
+	}
+	if len(created) > 0 {
+		conds = append(conds, bson.E{Key: f.CreatedAt, Value: created})
+	}
+	if p.After != nil {
+		op := "$lt"
+		if p.Ascending {
+			op = "$gt"
+		}
+		conds = append(conds, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: f.CreatedAt, Value: bson.D{{Key: op, Value: p.After.CreatedAt}}}},
+			bson.D{
+				{Key: f.CreatedAt, Value: p.After.CreatedAt},
+				{Key: f.ID, Value: bson.D{{Key: op, Value: p.After.ID}}},
+			},
+		}})
+	}
+	return conds
+}
+
+// MongoSort returns the sort order of p
+func (p Params) MongoSort(f Fields) bson.D {
+	dir := -1
+	if p.Ascending {
+		dir = 1
+	}
+	return bson.D{{Key: f.CreatedAt, Value: dir}, {Key: f.ID, Value: dir}}
+}
+
+// MongoFind fetches the page of coll selected by filter and p. opts may set
+// a projection; the sort and limit are p's.
+func MongoFind[T any](ctx context.Context, coll *mongo.Collection, filter bson.D, p Params, f Fields, key func(T) Key, opts ...*options.FindOptions) (Page[T], error) {
+	query := append(append(bson.D{}, filter...), p.MongoFilter(f)...)
+	opts = append(opts, options.Find().SetSort(p.MongoSort(f)).SetLimit(int64(p.Limit)+1))
+	cur, err := coll.Find(ctx, query, opts...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	var items []T
+	if err := cur.All(ctx, &items); err != nil {
+		return Page[T]{}, err
+	}
+	page := NewPage(items, p, key)
+	if p.Total {
+		total, err := coll.CountDocuments(ctx, append(append(bson.D{}, filter...), p.Unpaged().MongoFilter(f)...))
+		if err != nil {
+			return Page[T]{}, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
@@ -0,0 +1,219 @@
+// Package paginate pages through listings ordered by creation time. Pages
+// are keyed on (created_at, id) rather than offsets, so a listing that
+// grows while it is read neither skips nor repeats items, and each page
+// costs an index seek however deep it is.
+//
+// A handler parses the query with FromQuery, the store fetches one page
+// with Slice, MongoFind or the SQL helpers, and the handler answers with
+// the Page, whose next_cursor the client sends back for the next one:
+//
+//	GET /orders?limit=20&order=desc&created_after=2024-01-01T00:00:00Z
+//	{"items": [...], "next_cursor": "eyJ0Ijoi..."}
+package paginate
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultLimit is the page size when the query has no limit
+	DefaultLimit = 20
+	// MaxLimit is the largest page a client may ask for
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned (wrapped) for a cursor that wasn't issued by
+// this package, or was issued for the other order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Key is an item's position in a listing: its creation time, with its ID
+// to break ties
+type Key struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Compare orders keys oldest first
+func (k Key) Compare(o Key) int {
+	if c := k.CreatedAt.Compare(o.CreatedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(k.ID, o.ID)
+}
+
+// Fields names the creation time and ID in a collection or table
+type Fields struct {
+	CreatedAt string
+	ID        string
+}
+
+// Params select one page of a listing
+type Params struct {
+	// Limit is the most items on the page
+	Limit int
+	// After is the key of the last item of the previous page; nil for the
+	// first page
+	After *Key
+	// Ascending lists the oldest items first instead of the newest
+	Ascending bool
+	// CreatedAfter and CreatedBefore, if set, leave out items created at or
+	// before and at or after them
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Total asks for the number of items across all pages
+	Total bool
+}
+
+// FromQuery reads limit, cursor, order (asc or desc, the default),
+// created_after, created_before (RFC 3339) and include_total from q. Its
+// errors are the client's and fit a 400 response.
+func FromQuery(q url.Values) (Params, error) {
+	p := Params{Limit: DefaultLimit}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Params{}, fmt.Errorf("limit must be a number from 1 to %d", MaxLimit)
+		}
+		p.Limit = n
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		p.Ascending = true
+	default:
+		return Params{}, errors.New("order must be asc or desc")
+	}
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_after", &p.CreatedAfter},
+		{"created_before", &p.CreatedBefore},
+	} {
+		if v := q.Get(t.name); v != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return Params{}, fmt.Errorf("%s must be an RFC 3339 time", t.name)
+			}
+			*t.dst = parsed
+		}
+	}
+	if v := q.Get("include_total"); v != "" {
+		total, err := strconv.ParseBool(v)
+		if err != nil {
+			return Params{}, errors.New("include_total must be true or false")
+		}
+		p.Total = total
+	}
+	if v := q.Get("cursor"); v != "" {
+		after, err := decodeCursor(v, p.Ascending)
+		if err != nil {
+			return Params{}, err
+		}
+		p.After = &after
+	}
+	return p, nil
+}
+
+// Unpaged returns p without its cursor, for counting the whole listing
+func (p Params) Unpaged() Params {
+	p.After = nil
+	return p
+}
+
+// compare orders keys the way p lists them
+func (p Params) compare(a, b Key) int {
+	if p.Ascending {
+		return a.Compare(b)
+	}
+	return b.Compare(a)
+}
+
+// inRange reports whether an item created at t falls in p's created range
+func (p Params) inRange(t time.Time) bool {
+	return (p.CreatedAfter.IsZero() || t.After(p.CreatedAfter)) &&
+		(p.CreatedBefore.IsZero() || t.Before(p.CreatedBefore))
+}
+
+// cursor is the JSON inside an encoded cursor
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+	Ascending bool      `json:"asc,omitempty"`
+}
+
+func encodeCursor(k Key, ascending bool) string {
+	b, _ := json.Marshal(cursor{CreatedAt: k.CreatedAt, ID: k.ID, Ascending: ascending})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, ascending bool) (Key, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Key{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return Key{}, ErrInvalidCursor
+	}
+	if c.Ascending != ascending {
+		return Key{}, fmt.Errorf("%w: it was issued for the other order", ErrInvalidCursor)
+	}
+	return Key{CreatedAt: c.CreatedAt, ID: c.ID}, nil
+}
+
+// Page is one page of a listing. NextCursor is empty on the last page;
+// Total is only set when Params.Total asked for it.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// NewPage makes a page of items, which were fetched in p's order with a
+// limit of p.Limit+1. The extra item only shows there is another page.
+func NewPage[T any](items []T, p Params, key func(T) Key) Page[T] {
+	page := Page[T]{Items: items}
+	if len(items) > p.Limit {
+		page.Items = items[:p.Limit]
+		page.NextCursor = encodeCursor(key(page.Items[p.Limit-1]), p.Ascending)
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// Slice pages through items held in memory, in any order
+func Slice[T any](items []T, p Params, key func(T) Key) Page[T] {
+	var matched []T
+	for _, item := range items {
+		if p.inRange(key(item).CreatedAt) {
+			matched = append(matched, item)
+		}
+	}
+	slices.SortFunc(matched, func(a, b T) int { return p.compare(key(a), key(b)) })
+	total := int64(len(matched))
+	if p.After != nil {
+		i, _ := slices.BinarySearchFunc(matched, *p.After, func(item T, after Key) int {
+			if p.compare(key(item), after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		matched = matched[i:]
+	}
+	page := NewPage(matched[:min(len(matched), p.Limit+1)], p, key)
+	if p.Total {
+		page.Total = &total
+	}
+	return page
+}
@@ -0,0 +1,314 @@
+package paginate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type item struct {
+	ID        string    `bson:"_id"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func itemKey(i item) Key {
+	return Key{CreatedAt: i.CreatedAt, ID: i.ID}
+}
+
+var fields = Fields{CreatedAt: "created_at", ID: "_id"}
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testItems returns items created a minute apart, except that b, c and d
+// share a creation time, listed in no particular order
+func testItems() []item {
+	return []item{
+		{"d", epoch.Add(time.Minute)},
+		{"a", epoch},
+		{"e", epoch.Add(2 * time.Minute)},
+		{"b", epoch.Add(time.Minute)},
+		{"c", epoch.Add(time.Minute)},
+	}
+}
+
+// ids returns the IDs of items
+func ids(items []item) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = it.ID
+	}
+	return out
+}
+
+// query returns the query string for a page in order, after cursor
+func query(order, cursor string, limit int) url.Values {
+	q := url.Values{"order": {order}, "limit": {fmt.Sprint(limit)}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	return q
+}
+
+// walk reads every page of a listing with fetch, following the cursors
+// through FromQuery as a client would, and returns the IDs in the order
+// listed
+func walk(t *testing.T, order string, limit int, fetch func(Params) Page[item]) []string {
+	t.Helper()
+	var got []string
+	cursor := ""
+	for range 10 {
+		p, err := FromQuery(query(order, cursor, limit))
+		if err != nil {
+			t.Fatalf("FromQuery: %v", err)
+		}
+		page := fetch(p)
+		if len(page.Items) > limit {
+			t.Fatalf("page of %d items, over the limit of %d", len(page.Items), limit)
+		}
+		got = append(got, ids(page.Items)...)
+		if cursor = page.NextCursor; cursor == "" {
+			return got
+		}
+	}
+	t.Fatal("listing didn't end")
+	return nil
+}
+
+func TestSlice(t *testing.T) {
+	// Ties on created_at are broken by ID, in the listing's direction
+	want := map[string][]string{
+		"asc":  {"a", "b", "c", "d", "e"},
+		"desc": {"e", "d", "c", "b", "a"},
+	}
+	for order, want := range want {
+		for _, limit := range []int{1, 2, 4, 5, 6} {
+			got := walk(t, order, limit, func(p Params) Page[item] { return Slice(testItems(), p, itemKey) })
+			if !slices.Equal(got, want) {
+				t.Errorf("%s pages of %d = %v, want %v", order, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestSliceRange(t *testing.T) {
+	p := Params{
+		Limit:         10,
+		Ascending:     true,
+		CreatedAfter:  epoch,
+		CreatedBefore: epoch.Add(2 * time.Minute),
+		Total:         true,
+	}
+	page := Slice(testItems(), p, itemKey)
+	if got := ids(page.Items); !slices.Equal(got, []string{"b", "c", "d"}) {
+		t.Errorf("items = %v, want those strictly inside the range", got)
+	}
+	if page.Total == nil || *page.Total != 3 {
+		t.Errorf("Total = %v, want 3", page.Total)
+	}
+
+	// The total counts the whole range, not what is left after the cursor
+	p.Limit = 1
+	p.After = &Key{CreatedAt: epoch.Add(time.Minute), ID: "b"}
+	page = Slice(testItems(), p, itemKey)
+	if got := ids(page.Items); !slices.Equal(got, []string{"c"}) || *page.Total != 3 {
+		t.Errorf("page after b = %v with total %d, want [c] of 3", got, *page.Total)
+	}
+}
+
+// matches evaluates the filters MongoFilter produces against it, comparing
+// times with its creation time and strings with its ID
+func matches(filter bson.D, it item) bool {
+	for _, e := range filter {
+		if e.Key == "$or" {
+			matched := false
+			for _, alt := range e.Value.(bson.A) {
+				matched = matched || matches(alt.(bson.D), it)
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		ops, ok := e.Value.(bson.D)
+		if !ok {
+			ops = bson.D{{Key: "$eq", Value: e.Value}}
+		}
+		for _, op := range ops {
+			var c int
+			switch v := op.Value.(type) {
+			case time.Time:
+				c = it.CreatedAt.Compare(v)
+			case string:
+				c = strings.Compare(it.ID, v)
+			}
+			if op.Key == "$eq" && c != 0 || op.Key == "$gt" && c <= 0 || op.Key == "$lt" && c >= 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestMongoFilterAgreesWithSlice(t *testing.T) {
+	all := testItems()
+	for _, ascending := range []bool{true, false} {
+		p := Params{Limit: 10, Ascending: ascending, CreatedAfter: epoch.Add(-time.Hour)}
+		sorted := Slice(all, p, itemKey).Items
+		for _, after := range sorted {
+			p.After = &Key{CreatedAt: after.CreatedAt, ID: after.ID}
+			var got []item
+			for _, it := range all {
+				if matches(p.MongoFilter(fields), it) {
+					got = append(got, it)
+				}
+			}
+			slices.SortFunc(got, func(a, b item) int { return p.compare(itemKey(a), itemKey(b)) })
+			if want := Slice(all, p, itemKey).Items; !slices.Equal(ids(got), ids(want)) {
+				t.Errorf("ascending %v, after %s: filter matches %v, Slice lists %v", ascending, after.ID, ids(got), ids(want))
+			}
+		}
+	}
+
+	dir := func(p Params) bson.D { return p.MongoSort(fields) }
+	if got := dir(Params{Ascending: true}); got[0].Value != 1 || got[1].Key != "_id" || got[1].Value != 1 {
+		t.Errorf("ascending sort = %v", got)
+	}
+	if got := dir(Params{}); got[0].Value != -1 || got[1].Value != -1 {
+		t.Errorf("descending sort = %v", got)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	p := Params{
+		Limit:        20,
+		After:        &Key{CreatedAt: epoch, ID: "b"},
+		CreatedAfter: epoch.Add(-time.Hour),
+	}
+	where, args := p.SQLWhere(Fields{CreatedAt: "created_at", ID: "id"}, []any{"usr_alice"})
+	if want := "created_at > $2 AND (created_at, id) < ($3, $4)"; where != want {
+		t.Errorf("SQLWhere = %q, want %q", where, want)
+	}
+	if len(args) != 4 || args[3] != "b" {
+		t.Errorf("args = %v", args)
+	}
+	if got := p.SQLOrder(Fields{CreatedAt: "created_at", ID: "id"}); got != "ORDER BY created_at DESC, id DESC LIMIT 21" {
+		t.Errorf("SQLOrder = %q", got)
+	}
+	p.Ascending = true
+	if where, _ := p.SQLWhere(Fields{CreatedAt: "created_at", ID: "id"}, nil); !strings.Contains(where, "(created_at, id) > ($2, $3)") {
+		t.Errorf("ascending SQLWhere = %q", where)
+	}
+	if where, args := (Params{}).SQLWhere(fields, nil); where != "TRUE" || len(args) != 0 {
+		t.Errorf("SQLWhere without conditions = %q, %v", where, args)
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	p, err := FromQuery(url.Values{})
+	if err != nil || p.Limit != DefaultLimit || p.Ascending || p.After != nil {
+		t.Errorf("FromQuery() = %+v, %v; want the defaults", p, err)
+	}
+
+	for _, limit := range []string{"1", "100"} {
+		if _, err := FromQuery(url.Values{"limit": {limit}}); err != nil {
+			t.Errorf("limit %s: %v", limit, err)
+		}
+	}
+	for _, bad := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"101"}},
+		{"limit": {"-1"}},
+		{"limit": {"ten"}},
+		{"order": {"newest"}},
+		{"created_after": {"2024-01-01"}},
+		{"include_total": {"maybe"}},
+	} {
+		if p, err := FromQuery(bad); err == nil {
+			t.Errorf("FromQuery(%v) = %+v, want an error", bad, p)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	page := Slice(testItems(), Params{Limit: 2}, itemKey)
+	if page.NextCursor == "" {
+		t.Fatal("no cursor for a listing with more pages")
+	}
+	p, err := FromQuery(url.Values{"cursor": {page.NextCursor}})
+	if err != nil {
+		t.Fatalf("FromQuery: %v", err)
+	}
+	if want := (Key{CreatedAt: epoch.Add(time.Minute), ID: "d"}); p.After == nil || p.After.Compare(want) != 0 {
+		t.Errorf("After = %+v, want %+v", p.After, want)
+	}
+
+	// A descending listing's cursor would skip the wrong items ascending
+	if _, err := FromQuery(url.Values{"cursor": {page.NextCursor}, "order": {"asc"}}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("desc cursor with order=asc err = %v, want ErrInvalidCursor", err)
+	}
+	asc := Slice(testItems(), Params{Limit: 2, Ascending: true}, itemKey)
+	if _, err := FromQuery(url.Values{"cursor": {asc.NextCursor}}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("asc cursor with the default order err = %v, want ErrInvalidCursor", err)
+	}
+	for _, bad := range []string{"not base64!", "bm90IGpzb24", encodeCursor(Key{CreatedAt: epoch}, false)} {
+		if _, err := FromQuery(url.Values{"cursor": {bad}}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q err = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	p := Params{Limit: 3}
+	items := testItems()[:4]
+
+	page := NewPage(items[:3], p, itemKey)
+	if len(page.Items) != 3 || page.NextCursor != "" {
+		t.Errorf("exactly Limit items: %d items, cursor %q; want all, and no next page", len(page.Items), page.NextCursor)
+	}
+
+	page = NewPage(items, p, itemKey)
+	if got := ids(page.Items); !slices.Equal(got, ids(items[:3])) || page.NextCursor == "" {
+		t.Errorf("Limit+1 items: %v, cursor %q; want the first 3 and a next page", got, page.NextCursor)
+	}
+	if after, err := decodeCursor(page.NextCursor, false); err != nil || after.ID != items[2].ID {
+		t.Errorf("cursor = %+v, %v; want the last item on the page", after, err)
+	}
+
+	page = NewPage[item](nil, p, itemKey)
+	if page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("no items: %#v, want an empty, non-nil slice", page.Items)
+	}
+}
+
+func TestMongoFind(t *testing.T) {
+	coll := dbtest.Mongo(t).Collection("items")
+	ctx := context.Background()
+	for _, it := range testItems() {
+		if _, err := coll.InsertOne(ctx, it); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for order, want := range map[string][]string{
+		"asc":  {"a", "b", "c", "d", "e"},
+		"desc": {"e", "d", "c", "b", "a"},
+	} {
+		got := walk(t, order, 2, func(p Params) Page[item] {
+			page, err := MongoFind(ctx, coll, nil, p, fields, itemKey)
+			if err != nil {
+				t.Fatalf("MongoFind: %v", err)
+			}
+			return page
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("%s pages = %v, want %v", order, got, want)
+		}
+	}
+}
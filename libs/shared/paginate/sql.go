@@ -0,0 +1,45 @@
+package paginate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQLWhere returns the conditions on p's created range and cursor, to be
+// ANDed into a WHERE clause, with their arguments appended to args. The
+// placeholders continue from len(args). Without conditions it returns TRUE.
+func (p Params) SQLWhere(f Fields, args []any) (string, []any) {
+	var conds []string
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if !p.CreatedAfter.IsZero() {
+		conds = append(conds, f.CreatedAt+" > "+arg(p.CreatedAfter))
+	}
+	if !p.CreatedBefore.IsZero() {
+		conds = append(conds, f.CreatedAt+" < "+arg(p.CreatedBefore))
+	}
+	if p.After != nil {
+		op := "<"
+		if p.Ascending {
+			op = ">"
+		}
+		conds = append(conds, fmt.Sprintf("(%s, %s) %s (%s, %s)",
+			f.CreatedAt, f.ID, op, arg(p.After.CreatedAt), arg(p.After.ID)))
+	}
+	if len(conds) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// SQLOrder returns the ORDER BY and LIMIT clauses of p, fetching the one
+// extra row NewPage expects
+func (p Params) SQLOrder(f Fields) string {
+	dir := "DESC"
+	if p.Ascending {
+		dir = "ASC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", f.CreatedAt, dir, f.ID, dir, p.Limit+1)
+}
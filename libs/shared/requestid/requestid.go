@@ -0,0 +1,111 @@
+// Package requestid correlates one client request across services. The
+// gateway accepts the caller's X-Request-ID (or generates one), every
+// service reads it into the request context and echoes it in the response,
+// and Transport passes it on to outbound calls.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header is the HTTP header that carries the request ID
+const Header = "X-Request-ID"
+
+// maxLen bounds IDs accepted from clients so they can't bloat logs
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a random 128-bit request ID in hex
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("requestid: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// WithID returns a copy of ctx carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// fromHeader returns the incoming request ID if it is usable, otherwise a
+// fresh one
+func fromHeader(h http.Header) string {
+	if id := h.Get(Header); valid(id) {
+		return id
+	}
+	return New()
+}
+
+// valid accepts non-empty printable ASCII up to maxLen
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Gin puts the request ID into the request context and the response header.
+// The header is also rewritten on the request so handlers that forward it
+// see the same value.
+func Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := fromHeader(c.Request.Header)
+		c.Request.Header.Set(Header, id)
+		c.Request = c.Request.WithContext(WithID(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Middleware is the net/http equivalent of Gin
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := fromHeader(r.Header)
+		r.Header.Set(Header, id)
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// Transport wraps base (http.DefaultTransport if nil) so outbound requests
+// carry the request ID from their context
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base: base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) == id {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,140 @@
+// Package server runs a service's HTTP handler (gin or a plain mux) behind
+// an http.Server with sane timeouts, and drains it on SIGINT/SIGTERM before
+// running the service's shutdown hooks.
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+)
+
+// Config holds the listener address and server limits
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// ShutdownTimeout bounds how long in-flight requests and shutdown hooks
+	// get once a signal arrives
+	ShutdownTimeout time.Duration
+}
+
+// ConfigFromEnv builds a Config from PORT and the HTTP_* variables, falling
+// back to defaultPort and conservative limits
+func ConfigFromEnv(defaultPort string) Config {
+	return Config{
+		Addr:              ":" + shared.GetEnv("PORT", defaultPort),
+		ReadTimeout:       shared.GetEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: shared.GetEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      shared.GetEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       shared.GetEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		MaxHeaderBytes:    shared.GetEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+		ShutdownTimeout:   shared.GetEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 20*time.Second),
+	}
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Server wraps an http.Server with graceful shutdown
+type Server struct {
+	cfg  Config
+	http *http.Server
+
+	mu    sync.Mutex
+	hooks []hook
+}
+
+// New returns a Server that serves handler with the limits in cfg
+func New(cfg Config, handler http.Handler) *Server {
+	return &Server{
+		cfg: cfg,
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		},
+	}
+}
+
+// OnShutdown registers fn to run after the server has stopped accepting
+// requests and drained in-flight ones. Hooks run in reverse registration
+// order, so register the database before anything that depends on it.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook{name: name, fn: fn})
+}
+
+// Run listens on the configured address and serves until ctx is cancelled
+// or the process receives SIGINT or SIGTERM, then shuts down gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is like Run but uses an existing listener
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.http.Serve(ln)
+	}()
+	log.Printf("[server] Listening on %s", ln.Addr())
+
+	select {
+	case err := <-errc:
+		// The listener failed before we were asked to stop
+		s.runHooks(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("[server] Shutting down, draining for up to %s", s.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := s.http.Shutdown(shutdownCtx)
+	if serveErr := <-errc; serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+	return errors.Join(err, s.runHooks(shutdownCtx))
+}
+
+func (s *Server) runHooks(ctx context.Context) error {
+	s.mu.Lock()
+	hooks := append([]hook(nil), s.hooks...)
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if err := h.fn(ctx); err != nil {
+			log.Printf("[server] Shutdown hook %s failed: %v", h.name, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -6,19 +6,29 @@ import (
 	"errors"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"context"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Version returns the version the running binary was built as
+//
+// Deprecated: use buildinfo.Get, which also reports the commit, build time
+// and dirty flag.
 func Version() string {
-	return "v0.1.0"
+	return buildinfo.Get().Version
 }
 
 // GenerateID returns a random hex string of length 16
+//
+// Deprecated: use ids.New, which returns typed, time-sortable IDs and
+// reports failures of the random source instead of returning "".
 func GenerateID() string {
 	b := make([]byte, 8)
 	_, err := rand.Read(b)
@@ -36,6 +46,30 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
+// GetEnvDuration parses the environment variable as a time.Duration ("5s",
+// "250ms"), returning fallback if it is unset or malformed
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("invalid duration %s=%q, using %s", key, v, fallback)
+	}
+	return fallback
+}
+
+// GetEnvInt parses the environment variable as an int, returning fallback if
+// it is unset or malformed
+func GetEnvInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("invalid integer %s=%q, using %d", key, v, fallback)
+	}
+	return fallback
+}
+
 // Logger is a simple wrapper for log.Println
 func Logger(msg string, args ...interface{}) {
 	log.Printf(msg, args...)
@@ -48,12 +82,13 @@ var (
 
 type JWTClaims struct {
 	jwt.RegisteredClaims
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
 }
 
-// GenerateJWT creates a new JWT token for the given user
-func GenerateJWT(userID, username string) (string, error) {
+// GenerateJWT creates a new JWT token for the given user and their roles
+func GenerateJWT(userID, username string, roles ...string) (string, error) {
 	secret := GetEnv("JWT_SECRET", "your-256-bit-secret")
 	claims := JWTClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -62,6 +97,7 @@ func GenerateJWT(userID, username string) (string, error) {
 		},
 		UserID:   userID,
 		Username: username,
+		Roles:    roles,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -95,7 +131,8 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 func GetMongoCollection(dbURL, dbName, collectionName string) (*mongo.Collection, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbURL))
+	opts := options.Client().ApplyURI(dbURL).SetMonitor(tracing.MongoMonitor())
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,250 @@
+// Package testcluster runs the gateway, auth, cart, catalog, orders and
+// payments services in one process, each on its own random port with an in-memory
+// store, so end-to-end flows can be tested without Docker or databases:
+//
+//	c := testcluster.Start(t)
+//	widget := c.AddProduct(t, "WID-1", "Widget", price, 10)
+//	token, err := c.AuthClient().Register(ctx, authclient.Credentials{...})
+//	order, err := c.OrdersClient(clients.WithToken(token)).Create(ctx, ...)
+//
+// The clients go through the gateway, as real clients do; the stores are
+// exposed for assertions on what the services persisted.
+package testcluster
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/authclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/cartclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/ordersclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/paymentsclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/services/api-gateway/gateway"
+	"github.com/obakengphikiso/go-monorepo/services/auth/authservice"
+	"github.com/obakengphikiso/go-monorepo/services/cart/cartservice"
+	"github.com/obakengphikiso/go-monorepo/services/catalog/catalogservice"
+	"github.com/obakengphikiso/go-monorepo/services/orders/ordersservice"
+	"github.com/obakengphikiso/go-monorepo/services/payments/paymentsservice"
+)
+
+// Cluster is a running set of services
+type Cluster struct {
+	// GatewayURL is the public entry point. The other URLs reach the
+	// services directly, which in production only the gateway can.
+	GatewayURL  string
+	AuthURL     string
+	CatalogURL  string
+	OrdersURL   string
+	CartURL     string
+	PaymentsURL string
+
+	// Identity is shared by the gateway, which signs assertions with it, and
+	// the services, which verify them
+	Identity identity.Config
+
+	Users     authservice.UserStore
+	Products  catalogservice.ProductStore
+	Inventory catalogservice.InventoryStore
+	Coupons   catalogservice.CouponStore
+	Orders    ordersservice.OrderStore
+	Carts     cartservice.CartStore
+	Checkouts cartservice.CheckoutStore
+	Payments  paymentsservice.PaymentStore
+
+	servers    []*httptest.Server
+	stopRunner context.CancelFunc
+}
+
+// Start runs every service and the gateway in front of them. The cluster is
+// closed when the test and its subtests finish.
+func Start(tb testing.TB) *Cluster {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		tb.Fatalf("testcluster: generate identity secret: %v", err)
+	}
+	c := &Cluster{
+		Identity:  identity.Config{Secret: secret, TTL: 30 * time.Second},
+		Users:     authservice.NewMemoryStore(),
+		Products:  catalogservice.NewMemoryStore(),
+		Inventory: catalogservice.NewMemoryInventoryStore(),
+		Coupons:   catalogservice.NewMemoryCouponStore(),
+		Orders:    ordersservice.NewMemoryStore(),
+		Carts:     cartservice.NewMemoryStore(),
+		Checkouts: cartservice.NewMemoryCheckoutStore(),
+		Payments:  paymentsservice.NewMemoryStore(),
+	}
+	tb.Cleanup(c.Close)
+
+	c.AuthURL = c.serve(authservice.NewServer(authservice.Deps{
+		Users: c.Users,
+	}))
+	c.CatalogURL = c.serve(catalogservice.NewServer(catalogservice.Deps{
+		Store:     c.Products,
+		Inventory: c.Inventory,
+		Coupons:   c.Coupons,
+		Identity:  c.Identity,
+	}))
+	c.OrdersURL = c.serve(ordersservice.NewServer(ordersservice.Deps{
+		Store:    c.Orders,
+		Identity: c.Identity,
+		Catalog:  ordersservice.NewCatalogClient(c.CatalogURL, c.Identity),
+	}))
+	c.PaymentsURL = c.serve(paymentsservice.NewServer(paymentsservice.Deps{
+		Store:    c.Payments,
+		Identity: c.Identity,
+	}))
+	cart := cartservice.NewServer(cartservice.Deps{
+		Store:     c.Carts,
+		Checkouts: c.Checkouts,
+		Identity:  c.Identity,
+		Catalog:   catalogclient.New(c.CatalogURL),
+		Orders:    cartservice.NewOrdersClient(c.OrdersURL, c.Identity),
+		Payments:  cartservice.NewPaymentsClient(c.PaymentsURL, c.Identity),
+		// Poll often so a completed payment confirms its order promptly
+		PollInterval: 50 * time.Millisecond,
+	})
+	c.CartURL = c.serve(cart)
+	var runCtx context.Context
+	runCtx, c.stopRunner = context.WithCancel(context.Background())
+	go cart.RunCheckouts(runCtx)
+	c.GatewayURL = c.serve(gateway.NewServer(gateway.Deps{
+		AuthBackends:    []string{c.AuthURL},
+		OrderBackends:   []string{c.OrdersURL},
+		PaymentBackends: []string{c.PaymentsURL},
+		CatalogBackends: []string{c.CatalogURL},
+		CartBackends:    []string{c.CartURL},
+		Identity:        c.Identity,
+	}))
+	return c
+}
+
+func (c *Cluster) serve(h http.Handler) string {
+	srv := httptest.NewServer(h)
+	c.servers = append(c.servers, srv)
+	return srv.URL
+}
+
+// Close stops the checkout runner and every server, the gateway first
+func (c *Cluster) Close() {
+	if c.stopRunner != nil {
+		c.stopRunner()
+	}
+	for i := len(c.servers) - 1; i >= 0; i-- {
+		c.servers[i].Close()
+	}
+	c.servers = nil
+}
+
+// AddProduct puts an active product with onHand in stock in the catalog, for
+// orders to be placed against
+func (c *Cluster) AddProduct(tb testing.TB, sku, name string, price money.Money, onHand int) catalogservice.Product {
+	tb.Helper()
+	id, err := ids.New(ids.Product)
+	if err != nil {
+		tb.Fatalf("testcluster: generate product ID: %v", err)
+	}
+	now := time.Now()
+	p := catalogservice.Product{
+		ID:        id,
+		SKU:       sku,
+		Name:      name,
+		Price:     price,
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := c.Products.Create(context.Background(), &p); err != nil {
+		tb.Fatalf("testcluster: add product %s: %v", sku, err)
+	}
+	c.SetStock(tb, p.ID, onHand)
+	return p
+}
+
+// SetStock records onHand of a product in stock, leaving its holds as they
+// are
+func (c *Cluster) SetStock(tb testing.TB, productID string, onHand int) {
+	tb.Helper()
+	if _, err := c.Inventory.SetOnHand(context.Background(), productID, onHand); err != nil {
+		tb.Fatalf("testcluster: set stock of %s: %v", productID, err)
+	}
+}
+
+// AddCoupon puts an active coupon in the catalog. Set exactly one of
+// percentOff and amountOff.
+func (c *Cluster) AddCoupon(tb testing.TB, code string, percentOff int, amountOff *money.Money) catalogservice.Coupon {
+	tb.Helper()
+	coupon := catalogservice.Coupon{
+		Code:       code,
+		PercentOff: percentOff,
+		AmountOff:  amountOff,
+		Active:     true,
+		UpdatedAt:  time.Now(),
+	}
+	if err := c.Coupons.Put(context.Background(), &coupon); err != nil {
+		tb.Fatalf("testcluster: add coupon %s: %v", code, err)
+	}
+	return coupon
+}
+
+// GrantRoles replaces the roles of the registered user with username. Tokens
+// carry roles, so the user has to log in again to use them.
+func (c *Cluster) GrantRoles(tb testing.TB, username string, roles ...string) {
+	tb.Helper()
+	ctx := context.Background()
+	user, err := c.Users.GetByUsername(ctx, username)
+	if err != nil {
+		tb.Fatalf("testcluster: find user %s: %v", username, err)
+	}
+	if err := c.Users.SetRoles(ctx, user.ID, roles); err != nil {
+		tb.Fatalf("testcluster: grant %v to %s: %v", roles, username, err)
+	}
+}
+
+// AuthClient returns a client for the auth endpoints, through the gateway
+func (c *Cluster) AuthClient(opts ...clients.Option) *authclient.Client {
+	return authclient.New(c.GatewayURL, opts...)
+}
+
+// CatalogClient returns a client for the catalog endpoints, through the
+// gateway
+func (c *Cluster) CatalogClient(opts ...clients.Option) *catalogclient.Client {
+	return catalogclient.New(c.GatewayURL, opts...)
+}
+
+// CartClient returns a client for the cart endpoints, through the gateway.
+// Pass the user's token with clients.WithToken.
+func (c *Cluster) CartClient(opts ...clients.Option) *cartclient.Client {
+	return cartclient.New(c.GatewayURL, opts...)
+}
+
+// OrdersClient returns a client for the orders endpoints, through the
+// gateway. Pass the user's token with clients.WithToken.
+func (c *Cluster) OrdersClient(opts ...clients.Option) *ordersclient.Client {
+	return ordersclient.New(c.GatewayURL, opts...)
+}
+
+// OperatorClient returns a client for the operator order endpoints,
+// through the gateway. Pass the token of a user granted
+// identity.RoleOperator with clients.WithToken.
+func (c *Cluster) OperatorClient(opts ...clients.Option) *ordersclient.Operator {
+	return ordersclient.NewOperator(c.GatewayURL, opts...)
+}
+
+// PaymentsClient returns a client for the payments endpoints, through the
+// gateway. Pass the user's token with clients.WithToken.
+func (c *Cluster) PaymentsClient(opts ...clients.Option) *paymentsclient.Client {
+	return paymentsclient.New(c.GatewayURL, opts...)
+}
@@ -0,0 +1,301 @@
+package testcluster_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/authclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/cartclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/ordersclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/paymentsclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/testcluster"
+)
+
+// register signs a new user up and returns their token
+func register(t *testing.T, c *testcluster.Cluster, username string) string {
+	t.Helper()
+	token, err := c.AuthClient().Register(context.Background(), authclient.Credentials{Username: username, Password: "s3cret-pass"})
+	if err != nil {
+		t.Fatalf("register %s: %v", username, err)
+	}
+	return token
+}
+
+// operator registers a user with the operator role and returns their token
+func operator(t *testing.T, c *testcluster.Cluster) string {
+	t.Helper()
+	register(t, c, "ops")
+	c.GrantRoles(t, "ops", identity.RoleOperator)
+	token, err := c.AuthClient().Login(context.Background(), "ops", "s3cret-pass")
+	if err != nil {
+		t.Fatalf("log operator in: %v", err)
+	}
+	return token
+}
+
+// checkOut puts quantity of the product in the user's cart and checks it
+// out, returning the checkout waiting for its payment
+func checkOut(t *testing.T, c *testcluster.Cluster, token, productID string, quantity int) *cartclient.Checkout {
+	t.Helper()
+	ctx := context.Background()
+	cart := c.CartClient(clients.WithToken(token))
+	if _, err := cart.AddItem(ctx, productID, quantity); err != nil {
+		t.Fatalf("add to cart: %v", err)
+	}
+	chk, err := cart.Checkout(ctx, "test checkout")
+	if err != nil {
+		t.Fatalf("check out: %v", err)
+	}
+	if chk.Status != cartclient.CheckoutRunning || chk.PaymentID == "" {
+		t.Fatalf("checkout is %s at %s with payment %q, want it awaiting a payment", chk.Status, chk.Step, chk.PaymentID)
+	}
+	return chk
+}
+
+// awaitCheckout polls the checkout until it has finished
+func awaitCheckout(t *testing.T, c *testcluster.Cluster, token, id string) *cartclient.Checkout {
+	t.Helper()
+	cart := c.CartClient(clients.WithToken(token))
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		chk, err := cart.GetCheckout(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get checkout: %v", err)
+		}
+		if chk.Status != cartclient.CheckoutRunning {
+			return chk
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkout still running at %s: %s", chk.Step, chk.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCheckoutAndPay(t *testing.T) {
+	ctx := context.Background()
+	c := testcluster.Start(t)
+	price, err := money.New(10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	widget := c.AddProduct(t, "WID-1", "Widget", price, 5)
+	token := register(t, c, "alice")
+
+	chk := checkOut(t, c, token, widget.ID, 2)
+	want, _ := price.Mul(2)
+	if chk.Amount == nil || *chk.Amount != want {
+		t.Fatalf("checkout amount = %v, want %v", chk.Amount, want)
+	}
+	cart, err := c.CartClient(clients.WithToken(token)).Get(ctx)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	if len(cart.Items) != 0 {
+		t.Errorf("cart has %d items after checkout, want it emptied", len(cart.Items))
+	}
+
+	// Settling payments is for staff and services, not customers
+	payments := c.PaymentsClient(clients.WithToken(operator(t, c)))
+	if err := payments.Update(ctx, chk.PaymentID, paymentsclient.PaymentRequest{Amount: want, Status: paymentsclient.StatusCompleted}); err != nil {
+		t.Fatalf("complete payment: %v", err)
+	}
+
+	chk = awaitCheckout(t, c, token, chk.ID)
+	if chk.Status != cartclient.CheckoutCompleted {
+		t.Fatalf("checkout %s: %s, want completed", chk.Status, chk.Error)
+	}
+	order, err := c.OrdersClient(clients.WithToken(token)).Get(ctx, chk.OrderID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if order.Status != ordersclient.StatusConfirmed || order.Amount != want {
+		t.Errorf("order is %s for %v, want confirmed for %v", order.Status, order.Amount, want)
+	}
+	stock, err := c.CatalogClient().Stock(ctx, widget.ID)
+	if err != nil {
+		t.Fatalf("get stock: %v", err)
+	}
+	if stock.Reserved != 2 || stock.Available != 3 {
+		t.Errorf("stock = %+v, want 2 held for the order and 3 available", stock)
+	}
+}
+
+func TestOnlyOrdersReservesStock(t *testing.T) {
+	c := testcluster.Start(t)
+	price, err := money.New(10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	widget := c.AddProduct(t, "WID-1", "Widget", price, 5)
+	items := []catalogclient.ReservationItem{{ProductID: widget.ID, Quantity: 5}}
+
+	// Even staff asserted the way the gateway would can't hold stock
+	staff, err := c.Identity.Sign(identity.Identity{UserID: "usr_ops", Roles: []string{identity.RoleOperator}}, "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string][]clients.Option{
+		"no identity": nil,
+		"operator":    {clients.WithHeader(identity.Header, staff)},
+	} {
+		err := catalogclient.New(c.CatalogURL, opts...).Reserve(context.Background(), "ord_1", items)
+		if status := clients.StatusCode(err); status != http.StatusUnauthorized && status != http.StatusForbidden {
+			t.Errorf("%s: Reserve err = %v, want it refused", name, err)
+		}
+	}
+	stock, err := c.CatalogClient().Stock(context.Background(), widget.ID)
+	if err != nil {
+		t.Fatalf("get stock: %v", err)
+	}
+	if stock.Available != 5 {
+		t.Errorf("stock = %+v, want all 5 available", stock)
+	}
+}
+
+// assertCompensated checks that the checkout failed and cancelled its order,
+// giving back the stock it held
+func assertCompensated(t *testing.T, c *testcluster.Cluster, token string, chk *cartclient.Checkout, productID string) {
+	t.Helper()
+	ctx := context.Background()
+	if chk.Status != cartclient.CheckoutFailed {
+		t.Fatalf("checkout %s at %s, want failed", chk.Status, chk.Step)
+	}
+	order, err := c.OrdersClient(clients.WithToken(token)).Get(ctx, chk.OrderID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if order.Status != ordersclient.StatusCancelled {
+		t.Errorf("order is %s, want cancelled", order.Status)
+	}
+	stock, err := c.CatalogClient().Stock(ctx, productID)
+	if err != nil {
+		t.Fatalf("get stock: %v", err)
+	}
+	if stock.Reserved != 0 {
+		t.Errorf("stock = %+v, want nothing held for the cancelled order", stock)
+	}
+}
+
+func TestMismatchedPaymentIsRefunded(t *testing.T) {
+	ctx := context.Background()
+	c := testcluster.Start(t)
+	price, err := money.New(10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	widget := c.AddProduct(t, "WID-1", "Widget", price, 5)
+	token := register(t, c, "alice")
+	chk := checkOut(t, c, token, widget.ID, 2)
+
+	// A customer can't settle their own payment, for any amount
+	cheap, err := money.New(100, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := paymentsclient.PaymentRequest{Amount: cheap, Status: paymentsclient.StatusCompleted}
+	err = c.PaymentsClient(clients.WithToken(token)).Update(ctx, chk.PaymentID, tampered)
+	if clients.StatusCode(err) != http.StatusForbidden {
+		t.Fatalf("customer completing payment: err = %v, want 403", err)
+	}
+
+	// Nor is a payment completed for less than the order taken as paying
+	// for it
+	payments := c.PaymentsClient(clients.WithToken(operator(t, c)))
+	if err := payments.Update(ctx, chk.PaymentID, tampered); err != nil {
+		t.Fatalf("complete payment: %v", err)
+	}
+	chk = awaitCheckout(t, c, token, chk.ID)
+	assertCompensated(t, c, token, chk, widget.ID)
+	payment, err := payments.Get(ctx, chk.PaymentID)
+	if err != nil {
+		t.Fatalf("get payment: %v", err)
+	}
+	if payment.Status != paymentsclient.StatusRefunded {
+		t.Errorf("payment is %s, want refunded", payment.Status)
+	}
+}
+
+func TestDeletedPaymentFailsCheckout(t *testing.T) {
+	ctx := context.Background()
+	c := testcluster.Start(t)
+	price, err := money.New(10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	widget := c.AddProduct(t, "WID-1", "Widget", price, 5)
+	token := register(t, c, "alice")
+	chk := checkOut(t, c, token, widget.ID, 2)
+
+	err = c.PaymentsClient(clients.WithToken(token)).Delete(ctx, chk.PaymentID)
+	if clients.StatusCode(err) != http.StatusForbidden {
+		t.Fatalf("customer deleting payment: err = %v, want 403", err)
+	}
+	if err := c.PaymentsClient(clients.WithToken(operator(t, c))).Delete(ctx, chk.PaymentID); err != nil {
+		t.Fatalf("delete payment: %v", err)
+	}
+	// The checkout gives up rather than waiting for it forever
+	assertCompensated(t, c, token, awaitCheckout(t, c, token, chk.ID), widget.ID)
+}
+
+// asService returns options asserting the named service's identity to
+// audience, as the service's own clients do
+func asService(t *testing.T, c *testcluster.Cluster, name, audience string) clients.Option {
+	t.Helper()
+	h := make(http.Header)
+	if err := c.Identity.SetHeaders(h, identity.Service(name), audience); err != nil {
+		t.Fatal(err)
+	}
+	return clients.WithHeaders(h)
+}
+
+func TestOnlyCartOrStaffTakeOrderPayments(t *testing.T) {
+	ctx := context.Background()
+	c := testcluster.Start(t)
+	price, err := money.New(10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	widget := c.AddProduct(t, "WID-1", "Widget", price, 5)
+	chk := checkOut(t, c, register(t, c, "alice"), widget.ID, 1)
+
+	// Another customer can't take a payment for alice's order, though they
+	// can still make one of their own
+	bob := c.PaymentsClient(clients.WithToken(register(t, c, "bob")))
+	_, err = bob.Create(ctx, paymentsclient.PaymentRequest{Amount: price, OrderID: chk.OrderID})
+	if clients.StatusCode(err) != http.StatusForbidden {
+		t.Errorf("customer paying another's order: err = %v, want 403", err)
+	}
+	if _, err := bob.Create(ctx, paymentsclient.PaymentRequest{Amount: price}); err != nil {
+		t.Errorf("customer payment without an order: %v", err)
+	}
+
+	// The cart's own identity takes the order's payment, getting back the
+	// one its checkout made
+	cart := paymentsclient.New(c.PaymentsURL, asService(t, c, "cart", "payments"))
+	payment, err := cart.Create(ctx, paymentsclient.PaymentRequest{Amount: price, OrderID: chk.OrderID})
+	if err != nil || payment.ID != chk.PaymentID {
+		t.Errorf("cart paying the order = %+v, %v; want payment %s", payment, err, chk.PaymentID)
+	}
+
+	// It may read orders and move them along, but nothing else staff can
+	// do, and other services can't stand in for it
+	cartOrders := ordersclient.NewOperator(c.OrdersURL, asService(t, c, "cart", "orders"))
+	if _, err := cartOrders.Get(ctx, chk.OrderID); err != nil {
+		t.Errorf("cart reading the order: %v", err)
+	}
+	if _, err := cartOrders.History(ctx, chk.OrderID); clients.StatusCode(err) != http.StatusForbidden {
+		t.Errorf("cart reading the order's history: err = %v, want 403", err)
+	}
+	ordersOwn := ordersclient.NewOperator(c.OrdersURL, asService(t, c, "orders", "orders"))
+	err = ordersOwn.UpdateStatus(ctx, chk.OrderID, ordersclient.StatusCancelled, "not the cart")
+	if clients.StatusCode(err) != http.StatusForbidden {
+		t.Errorf("orders service changing the status: err = %v, want 403", err)
+	}
+}
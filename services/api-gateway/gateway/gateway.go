@@ -0,0 +1,286 @@
+// Package gateway is the API gateway: it authenticates clients and proxies
+// their requests to the auth, cart, catalog, orders and payments services.
+// The api-gateway binary points it at the Compose hostnames; testcluster
+// points it at in-process servers.
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/httpclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+// Deps are what the gateway needs to serve requests
+type Deps struct {
+	// Service discovery: static lists of backend addresses
+	AuthBackends    []string
+	OrderBackends   []string
+	PaymentBackends []string
+	CatalogBackends []string
+	CartBackends    []string
+	// Identity signs the assertions forwarded to backends
+	Identity identity.Config
+	// Upstream proxies to the backends. nil means a client from
+	// httpclient.ConfigFromEnv("api-gateway"), with deadlines, retries of
+	// idempotent requests and a circuit breaker per backend instance.
+	Upstream *http.Client
+	// Health serves the probe endpoints. Readiness of the first instance of
+	// every backend is added to it; nil means a Health with no other checks.
+	Health *health.Health
+	// Spec is the OpenAPI document served at /swagger.yaml
+	Spec []byte
+}
+
+// Server is the gateway's HTTP handler
+type Server struct {
+	deps     Deps
+	upstream *http.Client
+	checks   *health.Health
+	probes   *http.Client
+
+	orderIdx   uint32
+	paymentIdx uint32
+	authIdx    uint32
+	catalogIdx uint32
+	cartIdx    uint32
+
+	mux     *http.ServeMux
+	handler http.Handler
+}
+
+// NewServer registers the gateway's routes
+func NewServer(deps Deps) *Server {
+	s := &Server{deps: deps, upstream: deps.Upstream}
+	if s.upstream == nil {
+		s.upstream = httpclient.New(httpclient.ConfigFromEnv("api-gateway"))
+	}
+	checks := deps.Health
+	if checks == nil {
+		checks = health.New(2 * time.Second)
+	}
+	checks.SetBuild(buildinfo.Get())
+	s.checks = checks
+
+	// Readiness probes get one attempt each; the check's timeout applies
+	probeCfg := httpclient.ConfigFromEnv("api-gateway-health")
+	probeCfg.MaxAttempts = 1
+	s.probes = httpclient.New(probeCfg)
+
+	// The gateway is ready when one instance of every backend is
+	for _, b := range []struct {
+		name     string
+		backends []string
+	}{
+		{"orders", deps.OrderBackends},
+		{"payments", deps.PaymentBackends},
+		{"auth", deps.AuthBackends},
+		{"catalog", deps.CatalogBackends},
+		{"cart", deps.CartBackends},
+	} {
+		if len(b.backends) > 0 {
+			checks.AddReadiness(health.HTTP(b.name, b.backends[0]+"/readyz", s.probes))
+		}
+	}
+
+	mux := http.NewServeMux()
+	for _, path := range health.Paths {
+		if path == "/health" {
+			// Reports the backends' builds as well
+			mux.HandleFunc(path, s.handleHealth)
+			continue
+		}
+		mux.Handle(path, checks)
+	}
+	mux.Handle(metrics.Path, metrics.Handler())
+	mux.Handle(buildinfo.Path, buildinfo.Handler())
+
+	// Auth endpoints
+	mux.HandleFunc("/auth/register", s.proxy("auth", deps.AuthBackends, &s.authIdx))
+	mux.HandleFunc("/auth/login", s.proxy("auth", deps.AuthBackends, &s.authIdx))
+	mux.HandleFunc("/auth/validate", s.proxy("auth", deps.AuthBackends, &s.authIdx))
+
+	// Protected endpoints. The collection paths are registered on their own
+	// so ServeMux doesn't redirect them to the trailing-slash subtree.
+	mux.HandleFunc("/orders", s.proxy("orders", deps.OrderBackends, &s.orderIdx))
+	mux.HandleFunc("/orders/", s.proxy("orders", deps.OrderBackends, &s.orderIdx))
+	mux.HandleFunc("/operator/orders", s.proxy("orders", deps.OrderBackends, &s.orderIdx))
+	mux.HandleFunc("/operator/orders/", s.proxy("orders", deps.OrderBackends, &s.orderIdx))
+	mux.HandleFunc("/payments", s.proxy("payments", deps.PaymentBackends, &s.paymentIdx))
+	mux.HandleFunc("/payments/", s.proxy("payments", deps.PaymentBackends, &s.paymentIdx))
+	mux.HandleFunc("/products", s.proxy("catalog", deps.CatalogBackends, &s.catalogIdx))
+	mux.HandleFunc("/products/", s.proxy("catalog", deps.CatalogBackends, &s.catalogIdx))
+	mux.HandleFunc("/coupons/", s.proxy("catalog", deps.CatalogBackends, &s.catalogIdx))
+	mux.HandleFunc("/cart", s.proxy("cart", deps.CartBackends, &s.cartIdx))
+	mux.HandleFunc("/cart/", s.proxy("cart", deps.CartBackends, &s.cartIdx))
+
+	mux.HandleFunc("/swagger.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(deps.Spec)
+	})
+
+	mux.HandleFunc("/swagger", func(w http.ResponseWriter, r *http.Request) {
+		html := `<!DOCTYPE html><html><head><title>Swagger UI</title><link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist/swagger-ui.css" /></head><body><div id="swagger-ui"></div><script src="https://unpkg.com/swagger-ui-dist/swagger-ui-bundle.js"></script><script>window.onload = function() { window.ui = SwaggerUIBundle({ url: '/swagger.yaml', dom_id: '#swagger-ui' }); };</script></body></html>`
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(html))
+	})
+
+	s.mux = mux
+	s.handler = requestid.Middleware(deadline.Middleware(tracing.Middleware("api-gateway", metrics.Middleware("api-gateway", mux))))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Handler reports which route serves r, so openapi.CheckRouted can compare
+// the routes with swagger.yaml
+func (s *Server) Handler(r *http.Request) (http.Handler, string) {
+	return s.mux.Handler(r)
+}
+
+func pickBackend(backends []string, idx *uint32) string {
+	n := uint32(len(backends))
+	if n == 0 {
+		return ""
+	}
+	i := atomic.AddUint32(idx, 1)
+	return backends[i%n]
+}
+
+// authMiddleware verifies the client's JWT and forwards the user to backend
+// as a signed identity assertion
+func (s *Server) authMiddleware(backend string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Identity headers are only ever set by the gateway
+		r.Header.Del(identity.Header)
+		r.Header.Del(identity.UserIDHeader)
+		r.Header.Del(identity.UsernameHeader)
+		r.Header.Del(identity.RolesHeader)
+		r.Header.Del("X-Authenticated")
+
+		// Skip auth for health checks, swagger docs, auth endpoints and
+		// reading the catalog
+		if isHealthPath(r.URL.Path) ||
+			r.URL.Path == "/swagger" ||
+			r.URL.Path == "/swagger.yaml" ||
+			r.URL.Path == "/auth/login" ||
+			r.URL.Path == "/auth/register" ||
+			isCatalogRead(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			apierror.Write(w, r, http.StatusUnauthorized, "Authorization header is required")
+			return
+		}
+
+		// Remove "Bearer " prefix if present
+		if len(token) > 7 && token[:7] == "Bearer " {
+			token = token[7:]
+		}
+
+		// Validate token
+		claims, err := shared.ValidateJWT(token)
+		if err != nil {
+			apierror.Write(w, r, http.StatusUnauthorized, "Invalid token: "+err.Error())
+			return
+		}
+
+		// Add user info to request headers for downstream services. The
+		// plain headers are only trusted by services on a trusted network.
+		user := identity.Identity{UserID: claims.UserID, Username: claims.Username, Roles: claims.Roles}
+		if err := s.deps.Identity.SetHeaders(r.Header, user, backend); err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, "gateway error")
+			return
+		}
+		r.Header.Set("X-Authenticated", "true")
+
+		// Preserve the original Authorization header for any services that might need it
+		next.ServeHTTP(w, r)
+	}
+}
+
+func isHealthPath(path string) bool {
+	for _, p := range health.Paths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func isCatalogRead(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.URL.Path == "/products" || strings.HasPrefix(r.URL.Path, "/products/") ||
+		strings.HasPrefix(r.URL.Path, "/coupons/")
+}
+
+var requestIDHeader = http.CanonicalHeaderKey(requestid.Header)
+
+func (s *Server) proxy(backend string, backends []string, idx *uint32) http.HandlerFunc {
+	return s.authMiddleware(backend, func(w http.ResponseWriter, r *http.Request) {
+		target := pickBackend(backends, idx)
+		if target == "" {
+			apierror.Write(w, r, http.StatusServiceUnavailable, "no backend available")
+			return
+		}
+		url := target + r.URL.Path
+		if r.URL.RawQuery != "" {
+			url += "?" + r.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, url, r.Body)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, "gateway error")
+			return
+		}
+		// No service dedupes on a client's idempotency key yet, so passing it
+		// on would let the retries below run a POST twice
+		r.Header.Del(httpclient.IdempotencyKeyHeader)
+		req.Header = r.Header
+		backendPicks.WithLabelValues(backend, target).Inc()
+		start := time.Now()
+		resp, err := s.upstream.Do(req)
+		upstreamDuration.WithLabelValues(backend).Observe(time.Since(start).Seconds())
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			apierror.Write(w, r, http.StatusServiceUnavailable, "service unavailable")
+			return
+		} else if err != nil {
+			badGateway.WithLabelValues(backend).Inc()
+			apierror.Write(w, r, http.StatusBadGateway, "service unavailable")
+			return
+		}
+		defer resp.Body.Close()
+		upstreamResponses.WithLabelValues(backend, strconv.Itoa(resp.StatusCode)).Inc()
+		for k, v := range resp.Header {
+			if k == requestIDHeader {
+				// already set by requestid.Middleware
+				continue
+			}
+			for _, vv := range v {
+				w.Header().Add(k, vv)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+)
+
+// buildTimeout bounds the requests for the backends' builds
+const buildTimeout = 2 * time.Second
+
+// backendBuild is one backend instance's answer to /version
+type backendBuild struct {
+	URL   string          `json:"url"`
+	Build *buildinfo.Info `json:"build,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// healthReport is the gateway's /health body: its own report plus the build
+// of every backend instance. VersionSkew is set when the gateway and the
+// instances that answered aren't all running the same build.
+type healthReport struct {
+	health.Report
+	Backends    map[string][]backendBuild `json:"backends"`
+	VersionSkew bool                      `json:"version_skew"`
+}
+
+// handleHealth serves /health, adding the backends' builds to the report.
+// A backend that can't be asked for its version is reported but doesn't
+// fail the check; readiness covers that.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+
+	var (
+		report healthReport
+		wg     sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		report.Report = s.checks.Check(ctx)
+	}()
+	report.Backends = s.backendBuilds(ctx)
+	wg.Wait()
+
+	self := buildinfo.Get()
+	for _, instances := range report.Backends {
+		for _, b := range instances {
+			if b.Build != nil && (b.Build.Version != self.Version || b.Build.Commit != self.Commit || b.Build.Dirty != self.Dirty) {
+				report.VersionSkew = true
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// backendBuilds asks every instance of every backend for its build
+func (s *Server) backendBuilds(ctx context.Context) map[string][]backendBuild {
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	backends := map[string][]string{
+		"auth":     s.deps.AuthBackends,
+		"orders":   s.deps.OrderBackends,
+		"payments": s.deps.PaymentBackends,
+		"catalog":  s.deps.CatalogBackends,
+		"cart":     s.deps.CartBackends,
+	}
+	builds := make(map[string][]backendBuild, len(backends))
+	var wg sync.WaitGroup
+	for name, urls := range backends {
+		builds[name] = make([]backendBuild, len(urls))
+		for i, url := range urls {
+			wg.Add(1)
+			go func(b *backendBuild) {
+				defer wg.Done()
+				b.URL = url
+				info, err := s.fetchBuild(ctx, url)
+				if err != nil {
+					b.Error = err.Error()
+					return
+				}
+				b.Build = info
+			}(&builds[name][i])
+		}
+	}
+	wg.Wait()
+	return builds
+}
+
+func (s *Server) fetchBuild(ctx context.Context, backend string) (*buildinfo.Info, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend+buildinfo.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.probes.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", buildinfo.Path, resp.StatusCode)
+	}
+	var info buildinfo.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,26 @@
+package gateway
+
+import "github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+
+var (
+	backendPicks = metrics.NewCounterVec(
+		"gateway_backend_picks_total",
+		"Backend instances chosen by pickBackend.",
+		"backend", "target",
+	)
+	upstreamDuration = metrics.NewHistogramVec(
+		"gateway_upstream_duration_seconds",
+		"Time from sending the proxied request to receiving response headers.",
+		"backend",
+	)
+	upstreamResponses = metrics.NewCounterVec(
+		"gateway_upstream_responses_total",
+		"Responses received from backends, by status code.",
+		"backend", "code",
+	)
+	badGateway = metrics.NewCounterVec(
+		"gateway_bad_gateway_total",
+		"Requests answered with 502 because the backend could not be reached.",
+		"backend",
+	)
+)
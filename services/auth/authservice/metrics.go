@@ -0,0 +1,15 @@
+package authservice
+
+import "github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+
+var (
+	registrations = metrics.NewCounter(
+		"auth_registrations_total",
+		"Users registered.",
+	)
+	loginFailures = metrics.NewCounterVec(
+		"auth_login_failures_total",
+		"Failed logins, by reason (unknown_user, bad_password, locked).",
+		"reason",
+	)
+)
@@ -0,0 +1,56 @@
+package authservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrUserNotFound is returned when no user matches the given ID or
+	// username
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUsernameTaken is returned when another user has the username
+	ErrUsernameTaken = errors.New("username already exists")
+)
+
+// UserUpdate changes a user's name or username; empty fields are left as
+// they are
+type UserUpdate struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// userKey is a user's position in listings
+func userKey(u User) paginate.Key {
+	return paginate.Key{CreatedAt: u.Created, ID: u.ID}
+}
+
+// UserStore is the persistence boundary for users
+type UserStore interface {
+	// List returns one page of users
+	List(ctx context.Context, page paginate.Params) (paginate.Page[User], error)
+	Get(ctx context.Context, id string) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	// Create inserts user, returning ErrUsernameTaken if the username is in
+	// use
+	Create(ctx context.Context, user *User) error
+	Update(ctx context.Context, id string, update UserUpdate) error
+	Delete(ctx context.Context, id string) error
+	// SetRoles replaces the user's roles
+	SetRoles(ctx context.Context, id string, roles []string) error
+	// RecordFailedLogin counts a failed login at the given time towards the
+	// lockout
+	RecordFailedLogin(ctx context.Context, id string, at time.Time) error
+	// ResetLoginAttempts clears the failed login count after a successful
+	// login at the given time
+	ResetLoginAttempts(ctx context.Context, id string, at time.Time) error
+}
+
+// NewMongoStore stores users in coll
+func NewMongoStore(coll *mongo.Collection) UserStore {
+	return &mongoUserStore{coll: coll}
+}
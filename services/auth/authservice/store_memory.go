@@ -0,0 +1,133 @@
+package authservice
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+// memoryUserStore keeps users in a map, for tests and local runs without a
+// database
+type memoryUserStore struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() UserStore {
+	return &memoryUserStore{users: make(map[string]User)}
+}
+
+func (s *memoryUserStore) List(ctx context.Context, page paginate.Params) (paginate.Page[User], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return paginate.Slice(slices.Collect(maps.Values(s.users)), page, userKey), nil
+}
+
+func (s *memoryUserStore) Get(ctx context.Context, id string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
+
+func (s *memoryUserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.byUsername(username); ok {
+		return &u, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *memoryUserStore) byUsername(username string) (User, bool) {
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *memoryUserStore) Create(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, taken := s.byUsername(user.Username); taken {
+		return ErrUsernameTaken
+	}
+	u := *user
+	u.Password = ""
+	s.users[u.ID] = u
+	return nil
+}
+
+func (s *memoryUserStore) Update(ctx context.Context, id string, update UserUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if update.Name != "" {
+		u.Name = update.Name
+	}
+	if update.Username != "" && update.Username != u.Username {
+		if _, taken := s.byUsername(update.Username); taken {
+			return ErrUsernameTaken
+		}
+		u.Username = update.Username
+	}
+	s.users[id] = u
+	return nil
+}
+
+func (s *memoryUserStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *memoryUserStore) SetRoles(ctx context.Context, id string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.Roles = slices.Clone(roles)
+	s.users[id] = u
+	return nil
+}
+
+func (s *memoryUserStore) RecordFailedLogin(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.LoginAttempts++
+		u.LastAttempt = at
+		s.users[id] = u
+	}
+	return nil
+}
+
+func (s *memoryUserStore) ResetLoginAttempts(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.LoginAttempts = 0
+		u.LastAttempt = at
+		s.users[id] = u
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package authservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoUserStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoUserStore) List(ctx context.Context, page paginate.Params) (paginate.Page[User], error) {
+	fields := paginate.Fields{CreatedAt: "created", ID: "_id"}
+	return paginate.MongoFind(ctx, s.coll, bson.D{}, page, fields, userKey)
+}
+
+func (s *mongoUserStore) Get(ctx context.Context, id string) (*User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *mongoUserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.findOne(ctx, bson.M{"username": username})
+}
+
+func (s *mongoUserStore) findOne(ctx context.Context, filter bson.M) (*User, error) {
+	var user User
+	err := s.coll.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *mongoUserStore) Create(ctx context.Context, user *User) error {
+	_, err := s.coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+func (s *mongoUserStore) Update(ctx context.Context, id string, update UserUpdate) error {
+	set := bson.M{}
+	if update.Name != "" {
+		set["name"] = update.Name
+	}
+	if update.Username != "" {
+		set["username"] = update.Username
+	}
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	} else if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) Delete(ctx context.Context, id string) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) SetRoles(ctx context.Context, id string, roles []string) error {
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"roles": roles}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) RecordFailedLogin(ctx context.Context, id string, at time.Time) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"login_attempts": 1},
+		"$set": bson.M{"last_attempt": at},
+	})
+	return err
+}
+
+func (s *mongoUserStore) ResetLoginAttempts(ctx context.Context, id string, at time.Time) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"login_attempts": 0,
+			"last_attempt":   at,
+		},
+	})
+	return err
+}
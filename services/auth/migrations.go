@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations evolve the auth database. Append new entries with the next
+// version; never edit one that has shipped.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "unique index on username",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "username_1")
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "index users by created and _id for keyset pagination",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().DropOne(ctx, "created_-1__id_-1")
+			return err
+		},
+	},
+}
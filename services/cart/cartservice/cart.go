@@ -0,0 +1,448 @@
+// Package cartservice is the shopping cart API: each user's cart of
+// products and an optional coupon, priced from the catalog and turned into
+// an order at checkout. The cart binary wires it to MongoDB; testcluster
+// runs it in-process on an in-memory store.
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+const (
+	// defaultTTL is how long an untouched cart is kept
+	defaultTTL = 7 * 24 * time.Hour
+	// maxItems bounds the distinct products in a cart
+	maxItems = catalogclient.MaxLookup
+	// maxQuantity bounds the quantity of one product
+	maxQuantity = 1000
+	// maxSaveAttempts bounds the retries when another request saves the
+	// cart between reading and saving it
+	maxSaveAttempts = 3
+)
+
+// CartItem is a quantity of one product in a cart
+type CartItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+}
+
+// Cart is a user's cart. It holds no prices: they are looked up from the
+// catalog each time the cart is shown, and again by the orders service at
+// checkout.
+type Cart struct {
+	UserID string     `bson:"_id"`
+	Items  []CartItem `bson:"items"`
+	Coupon string     `bson:"coupon,omitempty"`
+	// Version counts saves, for compare-and-set updates
+	Version int `bson:"version"`
+	// CheckoutID is the checkout that last locked the cart. The lock holds
+	// until that checkout has placed its order or failed.
+	CheckoutID string    `bson:"checkout_id,omitempty"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+	// ExpiresAt is when an abandoned cart is deleted; every change pushes
+	// it back
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Catalog prices carts and checks coupons. *catalogclient.Client
+// implements it.
+type Catalog interface {
+	// Lookup returns the products with the given IDs, leaving out unknown ones
+	Lookup(ctx context.Context, ids []string) ([]catalogclient.Product, error)
+	Coupon(ctx context.Context, code string) (*catalogclient.Coupon, error)
+}
+
+// Deps are what the cart service needs to serve requests
+type Deps struct {
+	Store CartStore
+	// Checkouts keeps the state of each checkout
+	Checkouts CheckoutStore
+	// Identity verifies the assertions the gateway signs for each request
+	Identity identity.Config
+	Catalog  Catalog
+	// Orders places the order at checkout and confirms or cancels it
+	Orders Orders
+	// Payments takes the payment for the order
+	Payments Payments
+	// PaymentTimeout is how long a checkout waits for its payment before
+	// cancelling the order; zero means 10 minutes
+	PaymentTimeout time.Duration
+	// PollInterval is how often RunCheckouts looks at pending payments and
+	// retries failed steps; zero means 5s
+	PollInterval time.Duration
+	// TTL is how long a cart is kept after its last change; zero means 7
+	// days
+	TTL time.Duration
+	// Health serves the probe endpoints. The store's readiness is added to
+	// it; nil means a Health with no other checks.
+	Health *health.Health
+	// Timeouts bound each operation by its operationId in openapi.yaml; the
+	// zero value allows 5s for everything
+	Timeouts deadline.Timeouts
+}
+
+// Server is the cart HTTP API
+type Server struct {
+	store          CartStore
+	checkouts      CheckoutStore
+	catalog        Catalog
+	orders         Orders
+	payments       Payments
+	ttl            time.Duration
+	paymentTimeout time.Duration
+	pollInterval   time.Duration
+	timeouts       deadline.Timeouts
+	router         *gin.Engine
+}
+
+// NewServer registers the service's routes
+func NewServer(deps Deps) *Server {
+	checks := deps.Health
+	if checks == nil {
+		checks = health.New(2 * time.Second)
+	}
+	checks.SetBuild(buildinfo.Get())
+	s := &Server{
+		store:          deps.Store,
+		checkouts:      deps.Checkouts,
+		catalog:        deps.Catalog,
+		orders:         deps.Orders,
+		payments:       deps.Payments,
+		ttl:            deps.TTL,
+		paymentTimeout: deps.PaymentTimeout,
+		pollInterval:   deps.PollInterval,
+		timeouts:       deps.Timeouts,
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultTTL
+	}
+	if s.paymentTimeout <= 0 {
+		s.paymentTimeout = defaultPaymentTimeout
+	}
+	if s.pollInterval <= 0 {
+		s.pollInterval = defaultPollInterval
+	}
+	if s.store != nil {
+		checks.AddReadiness(health.Func("database", s.store.Ping))
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery(), requestid.Gin(), deadline.Gin(), tracing.Gin("cart"), logging.Gin(), metrics.Gin("cart"))
+	r.GET(metrics.Path, gin.WrapH(metrics.Handler()))
+	r.GET(buildinfo.Path, gin.WrapH(buildinfo.Handler()))
+
+	for _, path := range health.Paths {
+		r.GET(path, gin.WrapH(checks))
+	}
+
+	// The cart belongs to the user asserted by the gateway
+	cart := r.Group("/cart", identity.Gin(deps.Identity, "cart"))
+	{
+		cart.GET("", s.handleGetCart)
+		cart.DELETE("", s.handleClearCart)
+		cart.POST("/items", s.handleAddCartItem)
+		cart.PUT("/items/:product_id", s.handleUpdateCartItem)
+		cart.DELETE("/items/:product_id", s.handleRemoveCartItem)
+		cart.PUT("/coupon", s.handleApplyCoupon)
+		cart.DELETE("/coupon", s.handleRemoveCoupon)
+		cart.POST("/checkout", s.handleCheckout)
+		cart.GET("/checkouts/:id", s.handleGetCheckout)
+	}
+
+	s.router = r
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Routes lists the registered routes, for comparison with openapi.yaml
+func (s *Server) Routes() []openapi.Route {
+	return openapi.GinRoutes(s.router)
+}
+
+// cartError is a change to the cart that the client has to fix, answered
+// with status
+type cartError struct {
+	status int
+	msg    string
+}
+
+func (e *cartError) Error() string {
+	return e.msg
+}
+
+var errCheckoutInProgress = &cartError{http.StatusConflict, "checkout in progress; try again shortly"}
+
+// update applies change to the user's cart, or to a new empty one, and
+// saves it with a compare-and-set on its version, retrying if another
+// request saved it first. Each save keeps the cart for another TTL.
+func (s *Server) update(ctx context.Context, userID string, change func(*Cart) error) (*Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := s.store.Get(ctx, userID)
+		if errors.Is(err, ErrCartNotFound) {
+			cart = &Cart{UserID: userID}
+		} else if err != nil {
+			return nil, err
+		}
+		if cart.CheckoutID != "" {
+			locked, err := s.lockedBy(ctx, cart)
+			if err != nil {
+				return nil, err
+			}
+			if locked {
+				return nil, errCheckoutInProgress
+			}
+			cart.CheckoutID = ""
+		}
+		now := time.Now()
+		if err := change(cart); err != nil {
+			return nil, err
+		}
+		cart.UpdatedAt = now
+		cart.ExpiresAt = now.Add(s.ttl)
+		err = s.store.Save(ctx, cart)
+		if errors.Is(err, ErrCartChanged) && attempt < maxSaveAttempts {
+			continue
+		}
+		return cart, err
+	}
+}
+
+// updated answers a change made with s.update with the priced cart
+func (s *Server) updated(ctx context.Context, c *gin.Context, cart *Cart, err error) {
+	var cerr *cartError
+	switch {
+	case errors.As(err, &cerr):
+		apierror.Gin(c, cerr.status, cerr.msg)
+	case errors.Is(err, ErrCartChanged):
+		apierror.Gin(c, http.StatusConflict, "cart changed concurrently; retry")
+	case err != nil:
+		apierror.Gin(c, http.StatusInternalServerError, "failed to update cart")
+	default:
+		s.respondSummary(ctx, c, cart)
+	}
+}
+
+// respondSummary answers with cart priced from the catalog
+func (s *Server) respondSummary(ctx context.Context, c *gin.Context, cart *Cart) {
+	summary, err := s.summarize(ctx, cart)
+	var cerr *cartError
+	if errors.As(err, &cerr) {
+		apierror.Gin(c, cerr.status, cerr.msg)
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// getUserID returns the caller's user ID as established by identity.Gin
+func getUserID(c *gin.Context) string {
+	id, _ := identity.FromContext(c.Request.Context())
+	return id.UserID
+}
+
+func (s *Server) handleGetCart(c *gin.Context) {
+	userID := getUserID(c)
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getCart")
+	defer cancel()
+
+	cart, err := s.store.Get(ctx, userID)
+	if errors.Is(err, ErrCartNotFound) {
+		cart = &Cart{UserID: userID}
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch cart")
+		return
+	}
+	s.respondSummary(ctx, c, cart)
+}
+
+func (s *Server) handleClearCart(c *gin.Context) {
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "clearCart")
+	defer cancel()
+
+	_, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		cart.Items = nil
+		cart.Coupon = ""
+		return nil
+	})
+	if err != nil {
+		s.updated(ctx, c, nil, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkProduct returns a *cartError unless id is a product that can be
+// ordered
+func (s *Server) checkProduct(ctx context.Context, id string) error {
+	if ids.Validate(ids.Product, id) != nil {
+		return &cartError{http.StatusBadRequest, fmt.Sprintf("unknown product %q", id)}
+	}
+	products, err := s.catalog.Lookup(ctx, []string{id})
+	if err != nil {
+		return fmt.Errorf("looking up product: %w", err)
+	}
+	if len(products) == 0 {
+		return &cartError{http.StatusBadRequest, fmt.Sprintf("unknown product %q", id)}
+	}
+	if !products[0].Active {
+		return &cartError{http.StatusBadRequest, fmt.Sprintf("product %q is no longer available", id)}
+	}
+	return nil
+}
+
+func (s *Server) handleAddCartItem(c *gin.Context) {
+	var req struct {
+		ProductID string `json:"product_id" binding:"required"`
+		Quantity  int    `json:"quantity" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "addCartItem")
+	defer cancel()
+
+	var cerr *cartError
+	if err := s.checkProduct(ctx, req.ProductID); errors.As(err, &cerr) {
+		apierror.Gin(c, cerr.status, cerr.msg)
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+
+	// Adding a product already in the cart adds to its quantity
+	cart, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		i := slices.IndexFunc(cart.Items, func(item CartItem) bool { return item.ProductID == req.ProductID })
+		if i < 0 {
+			if len(cart.Items) >= maxItems {
+				return &cartError{http.StatusConflict, fmt.Sprintf("a cart holds at most %d products", maxItems)}
+			}
+			cart.Items = append(cart.Items, CartItem{ProductID: req.ProductID})
+			i = len(cart.Items) - 1
+		}
+		if cart.Items[i].Quantity+req.Quantity > maxQuantity {
+			return &cartError{http.StatusBadRequest, fmt.Sprintf("at most %d of a product", maxQuantity)}
+		}
+		cart.Items[i].Quantity += req.Quantity
+		return nil
+	})
+	s.updated(ctx, c, cart, err)
+}
+
+func (s *Server) handleUpdateCartItem(c *gin.Context) {
+	productID := c.Param("product_id")
+	var req struct {
+		Quantity int `json:"quantity" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Quantity > maxQuantity {
+		apierror.Gin(c, http.StatusBadRequest, fmt.Sprintf("at most %d of a product", maxQuantity))
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "updateCartItem")
+	defer cancel()
+
+	cart, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		i := slices.IndexFunc(cart.Items, func(item CartItem) bool { return item.ProductID == productID })
+		if i < 0 {
+			return &cartError{http.StatusNotFound, "product not in cart"}
+		}
+		cart.Items[i].Quantity = req.Quantity
+		return nil
+	})
+	s.updated(ctx, c, cart, err)
+}
+
+func (s *Server) handleRemoveCartItem(c *gin.Context) {
+	productID := c.Param("product_id")
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "removeCartItem")
+	defer cancel()
+
+	cart, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		n := len(cart.Items)
+		cart.Items = slices.DeleteFunc(cart.Items, func(item CartItem) bool { return item.ProductID == productID })
+		if len(cart.Items) == n {
+			return &cartError{http.StatusNotFound, "product not in cart"}
+		}
+		return nil
+	})
+	s.updated(ctx, c, cart, err)
+}
+
+func (s *Server) handleApplyCoupon(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	code := strings.ToUpper(req.Code)
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "applyCoupon")
+	defer cancel()
+
+	coupon, err := s.catalog.Coupon(ctx, code)
+	if status := clients.StatusCode(err); status == http.StatusNotFound || status == http.StatusBadRequest {
+		apierror.Gin(c, http.StatusBadRequest, fmt.Sprintf("unknown coupon %q", code))
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+	if !coupon.Valid(time.Now()) {
+		apierror.Gin(c, http.StatusBadRequest, fmt.Sprintf("coupon %q is no longer valid", code))
+		return
+	}
+
+	cart, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		cart.Coupon = code
+		return nil
+	})
+	s.updated(ctx, c, cart, err)
+}
+
+func (s *Server) handleRemoveCoupon(c *gin.Context) {
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "removeCoupon")
+	defer cancel()
+
+	cart, err := s.update(ctx, getUserID(c), func(cart *Cart) error {
+		cart.Coupon = ""
+		return nil
+	})
+	s.updated(ctx, c, cart, err)
+}
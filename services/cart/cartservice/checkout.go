@@ -0,0 +1,515 @@
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/ordersclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/paymentsclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+const (
+	// defaultPaymentTimeout is how long a checkout waits for its payment.
+	// It is shorter than the catalog's hold TTL so the stock is still held
+	// when a late payment confirms the order.
+	defaultPaymentTimeout = 10 * time.Minute
+	// defaultPollInterval is how often due checkouts are looked at
+	defaultPollInterval = 5 * time.Second
+	// checkoutLease is how long the process taking a checkout's steps has it
+	// to itself. If the process dies the checkout is resumed once it passes.
+	checkoutLease = time.Minute
+	// stepTimeout bounds one run of a checkout's steps in the background
+	stepTimeout = 30 * time.Second
+	// maxRetryDelay caps the backoff between attempts at a failing step
+	maxRetryDelay = 5 * time.Minute
+	// maxStepsPerRun bounds the steps one run takes, in case a step keeps
+	// finding it has to look again
+	maxStepsPerRun = 16
+)
+
+// CheckoutStatus is how far a checkout has got
+type CheckoutStatus string
+
+const (
+	// CheckoutRunning checkouts have steps left to take
+	CheckoutRunning CheckoutStatus = "running"
+	// CheckoutCompleted checkouts placed an order, took its payment and
+	// confirmed it
+	CheckoutCompleted CheckoutStatus = "completed"
+	// CheckoutFailed checkouts placed no order, or cancelled the one they
+	// placed and refunded any payment for it
+	CheckoutFailed CheckoutStatus = "failed"
+)
+
+// The steps of a checkout. Each is safe to repeat, so a step interrupted by
+// a crash is simply taken again. A successful checkout places the order,
+// creates its payment, waits for the payment and confirms the order. Once
+// the order is placed, a failure compensates: a completed payment is
+// refunded and the order is cancelled, which releases its stock.
+const (
+	stepOrder        = "order"
+	stepPayment      = "payment"
+	stepAwaitPayment = "await_payment"
+	stepConfirm      = "confirm"
+	stepRefund       = "refund"
+	stepCompensate   = "compensate"
+)
+
+// Checkout turns a cart into a paid order. Its state is saved after every
+// step, so it can be resumed by any cart process.
+type Checkout struct {
+	ID       string `json:"id" bson:"_id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	Username string `json:"-" bson:"username"`
+	// Items, Coupon and Description are the cart as it was checked out
+	Items       []CartItem     `json:"items" bson:"items"`
+	Coupon      string         `json:"coupon,omitempty" bson:"coupon,omitempty"`
+	Description string         `json:"description,omitempty" bson:"description,omitempty"`
+	Status      CheckoutStatus `json:"status" bson:"status"`
+	// Step is the next step of a running checkout
+	Step      string `json:"step,omitempty" bson:"step,omitempty"`
+	OrderID   string `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	PaymentID string `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
+	// Amount is what the order costs, and so what the payment is for
+	Amount *money.Money `json:"amount,omitempty" bson:"amount,omitempty"`
+	// PaymentDue is when an unpaid order is given up on
+	PaymentDue *time.Time `json:"payment_due,omitempty" bson:"payment_due,omitempty"`
+	// Error says why a checkout failed or is compensating
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// CartVersion is the version of the cart that was checked out, which is
+	// emptied once the order is placed
+	CartVersion int `json:"-" bson:"cart_version"`
+	// Attempts counts failures of the current step in a row
+	Attempts int `json:"-" bson:"attempts"`
+	// NextRunAt is when a running checkout is next due
+	NextRunAt time.Time `json:"-" bson:"next_run_at"`
+	// Version counts saves, for compare-and-set updates
+	Version   int       `json:"-" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+
+	// refused is the orders service's refusal of the order, for the
+	// response to the checkout request that got it
+	refused *clients.Error
+}
+
+// compensate gives up on the order for reason, undoing what was done
+func (chk *Checkout) compensate(reason string) {
+	chk.Error = reason
+	chk.Step = stepCompensate
+}
+
+// finish ends the checkout with status
+func (chk *Checkout) finish(status CheckoutStatus) {
+	chk.Status = status
+	chk.Step = ""
+	checkouts.WithLabelValues(string(status)).Inc()
+}
+
+// refusal returns err as a *clients.Error if the service refused the
+// request, which repeating it won't change
+func refusal(err error) *clients.Error {
+	var cerr *clients.Error
+	if !errors.As(err, &cerr) || cerr.Status >= http.StatusInternalServerError ||
+		cerr.Status == http.StatusRequestTimeout || cerr.Status == http.StatusTooManyRequests {
+		return nil
+	}
+	return cerr
+}
+
+// lockedBy reports whether the checkout that locked cart still has it to
+// itself, which it does until the order is placed
+func (s *Server) lockedBy(ctx context.Context, cart *Cart) (bool, error) {
+	chk, err := s.checkouts.Get(ctx, cart.CheckoutID, cart.UserID)
+	if errors.Is(err, ErrCheckoutNotFound) {
+		// The checkout never got going
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return chk.Status == CheckoutRunning && chk.Step == stepOrder, nil
+}
+
+// advance takes chk's steps, saving it after each, until it finishes, has
+// to wait for its payment or a step fails. It returns the step's error;
+// the step is retried once chk is next due.
+func (s *Server) advance(ctx context.Context, chk *Checkout) error {
+	for n := 0; chk.Status == CheckoutRunning && n < maxStepsPerRun; n++ {
+		wait, err := s.step(ctx, chk)
+		now := time.Now()
+		switch {
+		case err != nil:
+			chk.Attempts++
+			chk.NextRunAt = now.Add(retryDelay(chk.Attempts))
+		case wait > 0:
+			chk.Attempts = 0
+			chk.NextRunAt = now.Add(wait)
+		default:
+			// Carry on at once, keeping the lease
+			chk.Attempts = 0
+			chk.NextRunAt = now.Add(checkoutLease)
+		}
+		chk.UpdatedAt = now
+		if serr := s.checkouts.Save(context.WithoutCancel(ctx), chk); serr != nil {
+			return fmt.Errorf("saving checkout: %w", serr)
+		}
+		if err != nil {
+			return fmt.Errorf("checkout step %s: %w", chk.Step, err)
+		}
+		if wait > 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// retryDelay is the backoff before the given attempt at a failing step
+func retryDelay(attempts int) time.Duration {
+	delay := time.Second << min(attempts-1, 16)
+	return min(delay, maxRetryDelay)
+}
+
+// step takes chk's current step. It returns how long to wait before the
+// next one, if the checkout can't go on yet.
+func (s *Server) step(ctx context.Context, chk *Checkout) (time.Duration, error) {
+	switch chk.Step {
+	case stepOrder:
+		return 0, s.placeOrder(ctx, chk)
+	case stepPayment:
+		return 0, s.createPayment(ctx, chk)
+	case stepAwaitPayment:
+		return s.awaitPayment(ctx, chk)
+	case stepConfirm:
+		return 0, s.confirmOrder(ctx, chk)
+	case stepRefund:
+		return 0, s.refundPayment(ctx, chk)
+	case stepCompensate:
+		return 0, s.cancelOrder(ctx, chk)
+	}
+	return 0, fmt.Errorf("unknown step %q", chk.Step)
+}
+
+// placeOrder places the order on the user's behalf and empties the cart.
+// The order is keyed by the checkout, so placing it again returns it.
+func (s *Server) placeOrder(ctx context.Context, chk *Checkout) error {
+	user := identity.Identity{UserID: chk.UserID, Username: chk.Username}
+	req := ordersclient.CreateOrderRequest{Coupon: chk.Coupon, Description: chk.Description, CheckoutID: chk.ID}
+	for _, item := range chk.Items {
+		req.Items = append(req.Items, ordersclient.LineItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	order, err := s.orders.Create(ctx, user, req)
+	if cerr := refusal(err); cerr != nil {
+		// The order was refused, e.g. for an unavailable product. Nothing
+		// was done, and the cart is unlocked so it can be fixed.
+		chk.Error = cerr.Detail
+		chk.refused = cerr
+		chk.finish(CheckoutFailed)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	checkouts.WithLabelValues("ordered").Inc()
+	chk.OrderID = order.ID
+	chk.Amount = &order.Amount
+	chk.Step = stepPayment
+
+	err = s.store.Delete(ctx, chk.UserID, chk.CartVersion)
+	if err != nil && !errors.Is(err, ErrCartChanged) {
+		logging.Printf(ctx, "Failed to empty cart of %s after order %s: %v", chk.UserID, order.ID, err)
+	}
+	return nil
+}
+
+// createPayment creates a pending payment for the order's exact amount.
+// The payment is keyed by the order, so creating it again returns it.
+func (s *Server) createPayment(ctx context.Context, chk *Checkout) error {
+	payment, err := s.payments.Create(ctx, paymentsclient.PaymentRequest{Amount: *chk.Amount, OrderID: chk.OrderID})
+	if cerr := refusal(err); cerr != nil {
+		chk.compensate("payment refused: " + cerr.Detail)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	chk.PaymentID = payment.ID
+	due := time.Now().Add(s.paymentTimeout)
+	chk.PaymentDue = &due
+	chk.Step = stepAwaitPayment
+	return nil
+}
+
+// awaitPayment looks at the payment until it is settled. A payment still
+// pending when it is due is cancelled, so it can't complete once the order
+// is gone. A completed payment only pays for the order if it is for the
+// order's amount; one for anything else is refunded.
+func (s *Server) awaitPayment(ctx context.Context, chk *Checkout) (time.Duration, error) {
+	payment, err := s.payments.Get(ctx, chk.PaymentID)
+	if clients.StatusCode(err) == http.StatusNotFound {
+		// Deleted, so it will never be settled
+		chk.compensate("payment deleted")
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	switch payment.Status {
+	case paymentsclient.StatusCompleted:
+		if payment.Amount != *chk.Amount {
+			chk.Error = fmt.Sprintf("payment of %s doesn't match the order's %s", payment.Amount, *chk.Amount)
+			chk.Step = stepRefund
+			return 0, nil
+		}
+		chk.Step = stepConfirm
+		return 0, nil
+	case paymentsclient.StatusPending:
+		if time.Now().Before(*chk.PaymentDue) {
+			return s.pollInterval, nil
+		}
+		err := s.payments.Update(ctx, payment.ID, paymentsclient.PaymentRequest{
+			Amount: payment.Amount,
+			Status: paymentsclient.StatusCancelled,
+		})
+		if clients.StatusCode(err) == http.StatusConflict {
+			// It was settled in the meantime; look again
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		chk.compensate("payment timed out")
+		return 0, nil
+	default:
+		chk.compensate("payment " + payment.Status)
+		return 0, nil
+	}
+}
+
+// confirmOrder moves the paid order to paid and then confirmed. Paying
+// confirms its stock holds; if they expired and the stock has gone since,
+// or the customer cancelled the order, the payment is refunded instead.
+func (s *Server) confirmOrder(ctx context.Context, chk *Checkout) error {
+	order, err := s.orders.Get(ctx, chk.OrderID)
+	if err != nil {
+		return err
+	}
+	var next string
+	switch order.Status {
+	case ordersclient.StatusPending:
+		next = ordersclient.StatusPaid
+	case ordersclient.StatusPaid:
+		next = ordersclient.StatusConfirmed
+	case ordersclient.StatusCancelled:
+		chk.Error = "order was cancelled"
+		chk.Step = stepRefund
+		return nil
+	default:
+		chk.finish(CheckoutCompleted)
+		return nil
+	}
+
+	err = s.orders.UpdateStatus(ctx, order.ID, next, "payment "+chk.PaymentID+" completed")
+	if cerr := refusal(err); cerr != nil && cerr.Status == http.StatusConflict {
+		// Either the status moved on, which the next look settles, or the
+		// order can't be paid for
+		again, err := s.orders.Get(ctx, chk.OrderID)
+		if err != nil {
+			return err
+		}
+		if again.Status == order.Status {
+			chk.Error = cerr.Detail
+			chk.Step = stepRefund
+		}
+		return nil
+	}
+	return err
+}
+
+// refundPayment refunds the completed payment for an order that won't be
+// filled
+func (s *Server) refundPayment(ctx context.Context, chk *Checkout) error {
+	payment, err := s.payments.Get(ctx, chk.PaymentID)
+	if clients.StatusCode(err) == http.StatusNotFound {
+		// Deleted, so there is nothing left to refund
+		chk.Step = stepCompensate
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if payment.Status == paymentsclient.StatusCompleted {
+		err := s.payments.Update(ctx, payment.ID, paymentsclient.PaymentRequest{
+			Amount: payment.Amount,
+			Status: paymentsclient.StatusRefunded,
+		})
+		if clients.StatusCode(err) == http.StatusConflict {
+			// Its status changed in the meantime; look again
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	chk.Step = stepCompensate
+	return nil
+}
+
+// cancelOrder cancels the order, which releases its stock, and fails the
+// checkout
+func (s *Server) cancelOrder(ctx context.Context, chk *Checkout) error {
+	order, err := s.orders.Get(ctx, chk.OrderID)
+	if err != nil {
+		return err
+	}
+	switch order.Status {
+	case ordersclient.StatusCancelled:
+	case ordersclient.StatusShipped, ordersclient.StatusDelivered:
+		// Only staff can sort this out now
+		logging.Printf(ctx, "Checkout %s can't cancel order %s, which is %s: %s", chk.ID, order.ID, order.Status, chk.Error)
+	default:
+		err := s.orders.UpdateStatus(ctx, order.ID, ordersclient.StatusCancelled, chk.Error)
+		if clients.StatusCode(err) == http.StatusConflict {
+			// Its status changed in the meantime; look again
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	chk.finish(CheckoutFailed)
+	return nil
+}
+
+// RunCheckouts takes the steps of checkouts that are due every poll
+// interval until ctx is done. That polls pending payments, retries failed
+// steps and resumes the checkouts of a process that died once their lease
+// runs out.
+func (s *Server) RunCheckouts(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDueCheckouts(ctx)
+		}
+	}
+}
+
+// runDueCheckouts advances every checkout that is due
+func (s *Server) runDueCheckouts(ctx context.Context) {
+	for ctx.Err() == nil {
+		chk, err := s.checkouts.Claim(ctx, time.Now(), checkoutLease)
+		if errors.Is(err, ErrCheckoutNotFound) {
+			return
+		} else if err != nil {
+			log.Printf("[checkout] Claiming due checkouts failed: %v", err)
+			return
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, stepTimeout)
+		if err := s.advance(stepCtx, chk); err != nil {
+			log.Printf("[checkout] Checkout %s: %v", chk.ID, err)
+		}
+		cancel()
+	}
+}
+
+// handleCheckout starts a checkout of the cart and takes its steps until it
+// waits for the payment. It answers 201 with the checkout, or 202 if a step
+// failed and will be retried in the background.
+func (s *Server) handleCheckout(c *gin.Context) {
+	user, _ := identity.FromContext(c.Request.Context())
+
+	// The body, and the description in it, are optional
+	var body struct {
+		Description string `json:"description"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "checkoutCart")
+	defer cancel()
+
+	id, err := ids.New(ids.Checkout)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to generate checkout ID")
+		return
+	}
+
+	// Lock the cart so it can't change, or be checked out twice, until the
+	// order is placed
+	cart, err := s.update(ctx, user.UserID, func(cart *Cart) error {
+		if len(cart.Items) == 0 {
+			return &cartError{http.StatusBadRequest, "cart is empty"}
+		}
+		cart.CheckoutID = id
+		return nil
+	})
+	if err != nil {
+		s.updated(ctx, c, nil, err)
+		return
+	}
+
+	now := time.Now()
+	chk := &Checkout{
+		ID:          id,
+		UserID:      user.UserID,
+		Username:    user.Username,
+		Items:       cart.Items,
+		Coupon:      cart.Coupon,
+		Description: body.Description,
+		Status:      CheckoutRunning,
+		Step:        stepOrder,
+		CartVersion: cart.Version,
+		// Leased to this request; the runner takes over if it dies
+		NextRunAt: now.Add(checkoutLease),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.checkouts.Create(ctx, chk); err != nil {
+		// The cart's lock points at no checkout, so it is already lifted
+		apierror.Gin(c, http.StatusInternalServerError, "failed to start checkout")
+		return
+	}
+
+	if err := s.advance(ctx, chk); err != nil {
+		logging.Printf(ctx, "Checkout %s: %v", chk.ID, err)
+		c.JSON(http.StatusAccepted, chk)
+		return
+	}
+	if chk.refused != nil {
+		apierror.Gin(c, chk.refused.Status, chk.refused.Detail)
+		return
+	}
+	c.JSON(http.StatusCreated, chk)
+}
+
+func (s *Server) handleGetCheckout(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Checkout, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid checkout ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getCheckout")
+	defer cancel()
+
+	chk, err := s.checkouts.Get(ctx, id, getUserID(c))
+	if errors.Is(err, ErrCheckoutNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "checkout not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch checkout")
+		return
+	}
+	c.JSON(http.StatusOK, chk)
+}
@@ -0,0 +1,79 @@
+package cartservice
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryCheckoutStore keeps checkouts in a map, for tests and local runs
+// without a database
+type memoryCheckoutStore struct {
+	mu        sync.Mutex
+	checkouts map[string]Checkout
+}
+
+// NewMemoryCheckoutStore returns an empty in-memory store
+func NewMemoryCheckoutStore() CheckoutStore {
+	return &memoryCheckoutStore{checkouts: make(map[string]Checkout)}
+}
+
+// copyCheckout returns chk with its own copy of the items
+func copyCheckout(chk Checkout) Checkout {
+	chk.Items = slices.Clone(chk.Items)
+	chk.refused = nil
+	return chk
+}
+
+func (s *memoryCheckoutStore) Get(ctx context.Context, id, userID string) (*Checkout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chk, ok := s.checkouts[id]
+	if !ok || chk.UserID != userID {
+		return nil, ErrCheckoutNotFound
+	}
+	chk = copyCheckout(chk)
+	return &chk, nil
+}
+
+func (s *memoryCheckoutStore) Create(ctx context.Context, chk *Checkout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chk.Version = 1
+	s.checkouts[chk.ID] = copyCheckout(*chk)
+	return nil
+}
+
+func (s *memoryCheckoutStore) Save(ctx context.Context, chk *Checkout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.checkouts[chk.ID]; !ok || stored.Version != chk.Version {
+		return ErrCheckoutChanged
+	}
+	chk.Version++
+	s.checkouts[chk.ID] = copyCheckout(*chk)
+	return nil
+}
+
+func (s *memoryCheckoutStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Checkout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due *Checkout
+	for _, chk := range s.checkouts {
+		if chk.Status != CheckoutRunning || chk.NextRunAt.After(now) {
+			continue
+		}
+		if due == nil || chk.NextRunAt.Before(due.NextRunAt) {
+			due = &chk
+		}
+	}
+	if due == nil {
+		return nil, ErrCheckoutNotFound
+	}
+	due.NextRunAt = now.Add(lease)
+	due.Version++
+	s.checkouts[due.ID] = copyCheckout(*due)
+	claimed := copyCheckout(*due)
+	return &claimed, nil
+}
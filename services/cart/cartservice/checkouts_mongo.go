@@ -0,0 +1,66 @@
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoCheckoutStore claims due checkouts with one atomic find-and-update,
+// so two cart processes never take the same checkout's steps
+type mongoCheckoutStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoCheckoutStore) Get(ctx context.Context, id, userID string) (*Checkout, error) {
+	var chk Checkout
+	err := s.coll.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&chk)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCheckoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &chk, nil
+}
+
+func (s *mongoCheckoutStore) Create(ctx context.Context, chk *Checkout) error {
+	chk.Version = 1
+	_, err := s.coll.InsertOne(ctx, chk)
+	return err
+}
+
+func (s *mongoCheckoutStore) Save(ctx context.Context, chk *Checkout) error {
+	chk.Version++
+	res, err := s.coll.ReplaceOne(ctx, bson.M{"_id": chk.ID, "version": chk.Version - 1}, chk)
+	if err == nil && res.MatchedCount == 0 {
+		err = ErrCheckoutChanged
+	}
+	if err != nil {
+		chk.Version--
+	}
+	return err
+}
+
+func (s *mongoCheckoutStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Checkout, error) {
+	var chk Checkout
+	err := s.coll.FindOneAndUpdate(ctx,
+		bson.M{"status": CheckoutRunning, "next_run_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"next_run_at": now.Add(lease)},
+			"$inc": bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&chk)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCheckoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &chk, nil
+}
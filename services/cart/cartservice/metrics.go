@@ -0,0 +1,9 @@
+package cartservice
+
+import "github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+
+var checkouts = metrics.NewCounterVec(
+	"cart_checkouts_total",
+	"Cart checkouts, by result.",
+	"result",
+)
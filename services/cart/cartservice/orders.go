@@ -0,0 +1,74 @@
+package cartservice
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/ordersclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+)
+
+// checkoutAccount is who checkouts confirm and cancel orders and settle
+// payments as. Orders and payments let the cart service's own identity do
+// that alongside operators.
+var checkoutAccount = identity.Service("cart")
+
+// Orders places orders on behalf of a user and moves them along their
+// lifecycle as checkoutAccount
+type Orders interface {
+	Create(ctx context.Context, user identity.Identity, req ordersclient.CreateOrderRequest) (*ordersclient.Order, error)
+	// Get returns any user's order
+	Get(ctx context.Context, id string) (*ordersclient.Order, error)
+	// UpdateStatus moves any user's order to status
+	UpdateStatus(ctx context.Context, id, status, reason string) error
+}
+
+// OrdersClient calls the orders service directly, asserting the user's
+// identity the way the gateway does
+type OrdersClient struct {
+	baseURL  string
+	identity identity.Config
+	opts     []clients.Option
+}
+
+// NewOrdersClient returns an OrdersClient for the orders service at baseURL.
+// cfg signs the assertions; without a secret only the plain headers are
+// sent, which orders trusts on a trusted network.
+func NewOrdersClient(baseURL string, cfg identity.Config, opts ...clients.Option) *OrdersClient {
+	return &OrdersClient{baseURL: baseURL, identity: cfg, opts: opts}
+}
+
+func (o *OrdersClient) Create(ctx context.Context, user identity.Identity, req ordersclient.CreateOrderRequest) (*ordersclient.Order, error) {
+	opts, err := asserting(o.identity, user, "orders", o.opts)
+	if err != nil {
+		return nil, err
+	}
+	return ordersclient.New(o.baseURL, opts...).Create(ctx, req)
+}
+
+func (o *OrdersClient) Get(ctx context.Context, id string) (*ordersclient.Order, error) {
+	opts, err := asserting(o.identity, checkoutAccount, "orders", o.opts)
+	if err != nil {
+		return nil, err
+	}
+	return ordersclient.NewOperator(o.baseURL, opts...).Get(ctx, id)
+}
+
+func (o *OrdersClient) UpdateStatus(ctx context.Context, id, status, reason string) error {
+	opts, err := asserting(o.identity, checkoutAccount, "orders", o.opts)
+	if err != nil {
+		return err
+	}
+	return ordersclient.NewOperator(o.baseURL, opts...).UpdateStatus(ctx, id, status, reason)
+}
+
+// asserting returns opts with the headers that make a request on behalf of
+// user to audience
+func asserting(cfg identity.Config, user identity.Identity, audience string, opts []clients.Option) ([]clients.Option, error) {
+	h := make(http.Header)
+	if err := cfg.SetHeaders(h, user, audience); err != nil {
+		return nil, err
+	}
+	return append([]clients.Option{clients.WithHeaders(h)}, opts...), nil
+}
@@ -0,0 +1,66 @@
+package cartservice
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/paymentsclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+)
+
+// Payments takes the payment for a checkout's order, as checkoutAccount
+type Payments interface {
+	// Create creates a pending payment, or returns the one the order
+	// already has
+	Create(ctx context.Context, req paymentsclient.PaymentRequest) (*paymentsclient.Payment, error)
+	Get(ctx context.Context, id string) (*paymentsclient.Payment, error)
+	// Update replaces a payment's amount and status; a move its lifecycle
+	// doesn't allow fails with 409
+	Update(ctx context.Context, id string, req paymentsclient.PaymentRequest) error
+}
+
+// PaymentsClient calls the payments service directly, asserting
+// checkoutAccount's identity the way the gateway would
+type PaymentsClient struct {
+	baseURL  string
+	identity identity.Config
+	opts     []clients.Option
+}
+
+// NewPaymentsClient returns a PaymentsClient for the payments service at
+// baseURL. cfg signs the assertions, as for NewOrdersClient.
+func NewPaymentsClient(baseURL string, cfg identity.Config, opts ...clients.Option) *PaymentsClient {
+	return &PaymentsClient{baseURL: baseURL, identity: cfg, opts: opts}
+}
+
+func (p *PaymentsClient) client() (*paymentsclient.Client, error) {
+	opts, err := asserting(p.identity, checkoutAccount, "payments", p.opts)
+	if err != nil {
+		return nil, err
+	}
+	return paymentsclient.New(p.baseURL, opts...), nil
+}
+
+func (p *PaymentsClient) Create(ctx context.Context, req paymentsclient.PaymentRequest) (*paymentsclient.Payment, error) {
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.Create(ctx, req)
+}
+
+func (p *PaymentsClient) Get(ctx context.Context, id string) (*paymentsclient.Payment, error) {
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, id)
+}
+
+func (p *PaymentsClient) Update(ctx context.Context, id string, req paymentsclient.PaymentRequest) error {
+	c, err := p.client()
+	if err != nil {
+		return err
+	}
+	return c.Update(ctx, id, req)
+}
@@ -0,0 +1,61 @@
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrCartNotFound is returned when a user has no cart, or it has expired
+	ErrCartNotFound = errors.New("cart not found")
+	// ErrCartChanged is returned by CartStore.Save and Delete when the cart
+	// was saved by someone else since it was read
+	ErrCartChanged = errors.New("cart changed concurrently")
+	// ErrCheckoutNotFound is returned when a user has no checkout with the
+	// given ID, and by CheckoutStore.Claim when none is due
+	ErrCheckoutNotFound = errors.New("checkout not found")
+	// ErrCheckoutChanged is returned by CheckoutStore.Save when the
+	// checkout was saved by someone else since it was read
+	ErrCheckoutChanged = errors.New("checkout changed concurrently")
+)
+
+// CartStore is the persistence boundary for carts
+type CartStore interface {
+	// Get returns the user's cart unless it has expired
+	Get(ctx context.Context, userID string) (*Cart, error)
+	// Save writes cart if the stored one is still at cart.Version, or if
+	// there is none and cart.Version is 0, and then increments
+	// cart.Version. Otherwise it returns ErrCartChanged.
+	Save(ctx context.Context, cart *Cart) error
+	// Delete removes the user's cart if it is still at version
+	Delete(ctx context.Context, userID string, version int) error
+	Ping(ctx context.Context) error
+}
+
+// CheckoutStore is the persistence boundary for checkouts
+type CheckoutStore interface {
+	// Get returns the user's checkout with id
+	Get(ctx context.Context, id, userID string) (*Checkout, error)
+	// Create stores a new checkout at version 1
+	Create(ctx context.Context, chk *Checkout) error
+	// Save writes chk if the stored one is still at chk.Version, and then
+	// increments chk.Version. Otherwise it returns ErrCheckoutChanged.
+	Save(ctx context.Context, chk *Checkout) error
+	// Claim leases the running checkout that has been due the longest, one
+	// whose NextRunAt is not after now, by saving it with NextRunAt pushed
+	// to now plus lease. It returns ErrCheckoutNotFound if none is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*Checkout, error)
+}
+
+// NewMongoStore stores carts in coll, keyed by user ID
+func NewMongoStore(coll *mongo.Collection) CartStore {
+	return &mongoCartStore{coll: coll}
+}
+
+// NewMongoCheckoutStore stores checkouts in coll
+func NewMongoCheckoutStore(coll *mongo.Collection) CheckoutStore {
+	return &mongoCheckoutStore{coll: coll}
+}
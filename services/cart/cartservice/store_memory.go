@@ -0,0 +1,68 @@
+package cartservice
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryCartStore keeps carts in a map, for tests and local runs without a
+// database. Expired carts are dropped when they are next read.
+type memoryCartStore struct {
+	mu    sync.Mutex
+	carts map[string]Cart
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() CartStore {
+	return &memoryCartStore{carts: make(map[string]Cart)}
+}
+
+// live returns the user's cart unless it has expired
+func (s *memoryCartStore) live(userID string) (Cart, bool) {
+	c, ok := s.carts[userID]
+	if ok && !c.ExpiresAt.After(time.Now()) {
+		delete(s.carts, userID)
+		return Cart{}, false
+	}
+	return c, ok
+}
+
+func (s *memoryCartStore) Get(ctx context.Context, userID string) (*Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.live(userID)
+	if !ok {
+		return nil, ErrCartNotFound
+	}
+	c.Items = slices.Clone(c.Items)
+	return &c, nil
+}
+
+func (s *memoryCartStore) Save(ctx context.Context, cart *Cart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.live(cart.UserID); ok && c.Version != cart.Version || !ok && cart.Version != 0 {
+		return ErrCartChanged
+	}
+	cart.Version++
+	saved := *cart
+	saved.Items = slices.Clone(cart.Items)
+	s.carts[cart.UserID] = saved
+	return nil
+}
+
+func (s *memoryCartStore) Delete(ctx context.Context, userID string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.live(userID); !ok || c.Version != version {
+		return ErrCartChanged
+	}
+	delete(s.carts, userID)
+	return nil
+}
+
+func (s *memoryCartStore) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoCartStore relies on a TTL index on expires_at to delete abandoned
+// carts. The index runs about once a minute, so reads also skip carts that
+// have expired but are still there.
+type mongoCartStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoCartStore) Get(ctx context.Context, userID string) (*Cart, error) {
+	var c Cart
+	err := s.coll.FindOne(ctx, bson.M{"_id": userID, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCartNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *mongoCartStore) Save(ctx context.Context, cart *Cart) error {
+	filter := bson.M{"_id": cart.UserID, "version": cart.Version}
+	opts := options.Replace()
+	if cart.Version == 0 {
+		// A new cart may replace an expired one; a live one makes the
+		// upsert collide on _id
+		filter = bson.M{"_id": cart.UserID, "expires_at": bson.M{"$lte": time.Now()}}
+		opts.SetUpsert(true)
+	}
+	cart.Version++
+	res, err := s.coll.ReplaceOne(ctx, filter, cart, opts)
+	if mongo.IsDuplicateKeyError(err) || err == nil && res.MatchedCount == 0 && res.UpsertedCount == 0 {
+		err = ErrCartChanged
+	}
+	if err != nil {
+		cart.Version--
+	}
+	return err
+}
+
+func (s *mongoCartStore) Delete(ctx context.Context, userID string, version int) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": userID, "version": version})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrCartChanged
+	}
+	return nil
+}
+
+func (s *mongoCartStore) Ping(ctx context.Context) error {
+	return s.coll.Database().Client().Ping(ctx, nil)
+}
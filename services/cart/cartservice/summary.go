@@ -0,0 +1,130 @@
+package cartservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// SummaryLine is a cart item priced from the catalog
+type SummaryLine struct {
+	ProductID string      `json:"product_id"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	LineTotal money.Money `json:"line_total"`
+	// Available is false for products that have been deactivated or
+	// removed from the catalog. They count towards no total, and checkout
+	// fails until they are taken out of the cart.
+	Available bool `json:"available"`
+}
+
+// Summary is a cart priced at the catalog's current prices. The order
+// placed at checkout is priced again by the orders service, so it can
+// differ if prices change in between. An empty cart has no totals.
+type Summary struct {
+	Items  []SummaryLine `json:"items"`
+	Coupon string        `json:"coupon,omitempty"`
+	// CouponError says why the coupon takes nothing off, if it doesn't
+	CouponError string      `json:"coupon_error,omitempty"`
+	Subtotal    money.Money `json:"subtotal"`
+	Discount    money.Money `json:"discount"`
+	Total       money.Money `json:"total"`
+	UpdatedAt   time.Time   `json:"updated_at,omitzero"`
+	ExpiresAt   time.Time   `json:"expires_at,omitzero"`
+}
+
+// summarize prices cart from the catalog. A cart mixing currencies is
+// reported with a *cartError.
+func (s *Server) summarize(ctx context.Context, cart *Cart) (*Summary, error) {
+	summary := &Summary{
+		Items:     make([]SummaryLine, len(cart.Items)),
+		Coupon:    cart.Coupon,
+		UpdatedAt: cart.UpdatedAt,
+		ExpiresAt: cart.ExpiresAt,
+	}
+	if len(cart.Items) == 0 {
+		return summary, nil
+	}
+
+	productIDs := make([]string, len(cart.Items))
+	for i, item := range cart.Items {
+		productIDs[i] = item.ProductID
+	}
+	products, err := s.catalog.Lookup(ctx, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("looking up products: %w", err)
+	}
+	byID := make(map[string]catalogclient.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	for i, item := range cart.Items {
+		line := SummaryLine{ProductID: item.ProductID, Quantity: item.Quantity}
+		if p, ok := byID[item.ProductID]; ok {
+			line.Name = p.Name
+			line.UnitPrice = p.Price
+			line.Available = p.Active
+			if line.LineTotal, err = p.Price.Mul(int64(item.Quantity)); err != nil {
+				return nil, err
+			}
+		}
+		summary.Items[i] = line
+		if !line.Available {
+			continue
+		}
+		if summary.Subtotal.Currency() == "" {
+			summary.Subtotal = line.LineTotal
+			continue
+		}
+		summary.Subtotal, err = summary.Subtotal.Add(line.LineTotal)
+		if errors.Is(err, money.ErrCurrencyMismatch) {
+			return nil, &cartError{http.StatusConflict, "all items must be priced in the same currency"}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if summary.Subtotal.Currency() == "" {
+		// Nothing in the cart can be ordered
+		return summary, nil
+	}
+
+	summary.Discount, summary.CouponError, err = s.discount(ctx, cart.Coupon, summary.Subtotal)
+	if err != nil {
+		return nil, err
+	}
+	if summary.Total, err = summary.Subtotal.Sub(summary.Discount); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// discount returns what the coupon with code takes off subtotal or, if it
+// takes nothing off, why not
+func (s *Server) discount(ctx context.Context, code string, subtotal money.Money) (money.Money, string, error) {
+	none, err := money.Zero(subtotal.Currency())
+	if err != nil || code == "" {
+		return none, "", err
+	}
+	coupon, err := s.catalog.Coupon(ctx, code)
+	if status := clients.StatusCode(err); status == http.StatusNotFound || status == http.StatusBadRequest {
+		return none, "unknown coupon", nil
+	} else if err != nil {
+		return money.Money{}, "", fmt.Errorf("looking up coupon: %w", err)
+	}
+	if !coupon.Valid(time.Now()) {
+		return none, "coupon is no longer valid", nil
+	}
+	discount, err := coupon.Discount(subtotal)
+	if errors.Is(err, catalogclient.ErrCouponCurrency) {
+		return none, "coupon can't be used for " + subtotal.Currency(), nil
+	}
+	return discount, "", err
+}
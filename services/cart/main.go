@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/httpclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/server"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+	"github.com/obakengphikiso/go-monorepo/services/cart/cartservice"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+func main() {
+	ctx := context.Background()
+	if len(os.Args) > 1 && os.Args[1] == "speccheck" {
+		// Compare the routes with openapi.yaml; needs no database
+		gin.SetMode(gin.ReleaseMode)
+		routes := cartservice.NewServer(cartservice.Deps{}).Routes()
+		if err := openapi.Check(openAPISpec, routes, os.Stdout, openapi.Operational...); err != nil {
+			log.Fatalf("Spec check failed: %v", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, "cart")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	dbURL := shared.GetEnv("CART_DB_URL", "mongodb://mongo:27017")
+	carts, err := shared.GetMongoCollection(dbURL, "cart", "carts")
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	db := carts.Database()
+
+	migrator, err := migrate.New(db, migrations...)
+	if err != nil {
+		log.Fatalf("Invalid migrations: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(ctx, migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if err := migrate.RequireCurrent(ctx, migrator); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	idCfg, err := identity.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid identity config: %v", err)
+	}
+
+	checks := health.New(2 * time.Second)
+	checks.AddStartup(health.Func("migrations", func(ctx context.Context) error {
+		return migrate.RequireCurrent(ctx, migrator)
+	}))
+
+	hc := clients.WithHTTPClient(httpclient.New(httpclient.ConfigFromEnv("cart")))
+	api := cartservice.NewServer(cartservice.Deps{
+		Store:          cartservice.NewMongoStore(carts),
+		Checkouts:      cartservice.NewMongoCheckoutStore(db.Collection("checkouts")),
+		Identity:       idCfg,
+		Catalog:        catalogclient.New(shared.GetEnv("CATALOG_URL", "http://catalog:8080"), hc),
+		Orders:         cartservice.NewOrdersClient(shared.GetEnv("ORDERS_URL", "http://orders:8080"), idCfg, hc),
+		Payments:       cartservice.NewPaymentsClient(shared.GetEnv("PAYMENTS_URL", "http://payments:8080"), idCfg, hc),
+		TTL:            shared.GetEnvDuration("CART_TTL", 7*24*time.Hour),
+		PaymentTimeout: shared.GetEnvDuration("CHECKOUT_PAYMENT_TIMEOUT", 10*time.Minute),
+		PollInterval:   shared.GetEnvDuration("CHECKOUT_POLL_INTERVAL", 5*time.Second),
+		Health:         checks,
+		Timeouts:       deadline.TimeoutsFromEnv(),
+	})
+
+	// Checkouts left running by a restart are resumed from here
+	runCtx, stopRunner := context.WithCancel(ctx)
+	go api.RunCheckouts(runCtx)
+
+	srv := server.New(server.ConfigFromEnv("8080"), api)
+	srv.OnShutdown("tracer", shutdownTracing)
+	srv.OnShutdown("mongo", db.Client().Disconnect)
+	srv.OnShutdown("checkout runner", func(context.Context) error {
+		stopRunner()
+		return nil
+	})
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations evolve the cart database. Append new entries with the next
+// version; never edit one that has shipped.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "TTL index deleting carts once expires_at passes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("carts").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("carts").Indexes().DropOne(ctx, "expires_at_1")
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "index checkouts by status and next_run_at for the checkout runner",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("checkouts").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_run_at", Value: 1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("checkouts").Indexes().DropOne(ctx, "status_1_next_run_at_1")
+			return err
+		},
+	},
+}
@@ -0,0 +1,303 @@
+// Package catalogservice is the product catalog API: what can be ordered and
+// at what price. The catalog binary wires it to MongoDB; testcluster runs it
+// in-process on an in-memory store.
+package catalogservice
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// Product is something that can be ordered. Inactive products stay in the
+// catalog, so past orders can still be looked up, but can't be ordered.
+type Product struct {
+	ID          string      `json:"id" bson:"_id"`
+	SKU         string      `json:"sku" bson:"sku"`
+	Name        string      `json:"name" bson:"name"`
+	Description string      `json:"description" bson:"description"`
+	Price       money.Money `json:"price" bson:"price"`
+	Active      bool        `json:"active" bson:"active"`
+	CreatedAt   time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" bson:"updated_at"`
+}
+
+// Deps are what the catalog service needs to serve requests
+type Deps struct {
+	Store ProductStore
+	// Inventory tracks stock and the holds orders place on it
+	Inventory InventoryStore
+	Coupons   CouponStore
+	// HoldTTL is how long a reservation holds stock before it is confirmed;
+	// zero means 15 minutes
+	HoldTTL time.Duration
+	// Identity verifies the assertions the gateway signs for changes to the
+	// catalog. Reading it needs no identity.
+	Identity identity.Config
+	// Health serves the probe endpoints. The store's readiness is added to
+	// it; nil means a Health with no other checks.
+	Health *health.Health
+	// Timeouts bound each operation by its operationId in openapi.yaml; the
+	// zero value allows 5s for everything
+	Timeouts deadline.Timeouts
+}
+
+// Server is the catalog HTTP API
+type Server struct {
+	store     ProductStore
+	inventory InventoryStore
+	coupons   CouponStore
+	holdTTL   time.Duration
+	timeouts  deadline.Timeouts
+	router    *gin.Engine
+}
+
+// NewServer registers the service's routes
+func NewServer(deps Deps) *Server {
+	checks := deps.Health
+	if checks == nil {
+		checks = health.New(2 * time.Second)
+	}
+	checks.SetBuild(buildinfo.Get())
+	s := &Server{
+		store:     deps.Store,
+		inventory: deps.Inventory,
+		coupons:   deps.Coupons,
+		holdTTL:   deps.HoldTTL,
+		timeouts:  deps.Timeouts,
+	}
+	if s.holdTTL <= 0 {
+		s.holdTTL = defaultHoldTTL
+	}
+	if s.store != nil {
+		checks.AddReadiness(health.Func("database", s.store.Ping))
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery(), requestid.Gin(), deadline.Gin(), tracing.Gin("catalog"), logging.Gin(), metrics.Gin("catalog"))
+	r.GET(metrics.Path, gin.WrapH(metrics.Handler()))
+	r.GET(buildinfo.Path, gin.WrapH(buildinfo.Handler()))
+
+	for _, path := range health.Paths {
+		r.GET(path, gin.WrapH(checks))
+	}
+
+	r.GET("/products", s.handleListProducts)
+	r.GET("/products/:id", s.handleGetProduct)
+	r.GET("/products/:id/stock", s.handleGetStock)
+	r.GET("/coupons/:code", s.handleGetCoupon)
+
+	// Changes need an operator identity asserted by the gateway
+	admin := r.Group("", identity.Gin(deps.Identity, "catalog"), identity.RequireRole(identity.RoleOperator))
+	{
+		admin.POST("/products", s.handleCreateProduct)
+		admin.PATCH("/products/:id", s.handleUpdateProduct)
+		admin.PUT("/products/:id/stock", s.handleSetStock)
+		admin.PUT("/coupons/:code", s.handlePutCoupon)
+	}
+
+	// Reservations are made by the orders service on the internal network;
+	// the gateway doesn't route them, and nothing else may make them
+	reservations := r.Group("/reservations", identity.Gin(deps.Identity, "catalog"), identity.RequireService("orders"))
+	{
+		reservations.PUT("/:order_id", s.handleReserve)
+		reservations.DELETE("/:order_id", s.handleReleaseReservation)
+		reservations.POST("/:order_id/confirm", s.handleConfirmReservation)
+		reservations.POST("/:order_id/commit", s.handleCommitReservation)
+	}
+
+	s.router = r
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Routes lists the registered routes, for comparison with openapi.yaml
+func (s *Server) Routes() []openapi.Route {
+	return openapi.GinRoutes(s.router)
+}
+
+func (s *Server) handleListProducts(c *gin.Context) {
+	filter := ProductFilter{Limit: defaultLimit}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			apierror.Gin(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			apierror.Gin(c, http.StatusBadRequest, "active must be true or false")
+			return
+		}
+		filter.ActiveOnly = active
+	}
+	if v := c.Query("ids"); v != "" {
+		filter.IDs = strings.Split(v, ",")
+		if len(filter.IDs) > maxLimit {
+			apierror.Gin(c, http.StatusBadRequest, "at most "+strconv.Itoa(maxLimit)+" ids")
+			return
+		}
+		for _, id := range filter.IDs {
+			if err := ids.Validate(ids.Product, id); err != nil {
+				apierror.Gin(c, http.StatusBadRequest, "invalid product ID "+strconv.Quote(id))
+				return
+			}
+		}
+		// Every requested product fits on the page
+		filter.Limit = len(filter.IDs)
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "listProducts")
+	defer cancel()
+
+	products, err := s.store.List(ctx, filter)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch products")
+		return
+	}
+	if products == nil {
+		products = []Product{}
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+func (s *Server) handleGetProduct(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Product, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid product ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getProduct")
+	defer cancel()
+
+	product, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrProductNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "product not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch product")
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+func (s *Server) handleCreateProduct(c *gin.Context) {
+	var req struct {
+		SKU         string      `json:"sku" binding:"required"`
+		Name        string      `json:"name" binding:"required"`
+		Description string      `json:"description"`
+		Price       money.Money `json:"price"`
+		Active      *bool       `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validatePrice(req.Price); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := ids.New(ids.Product)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to generate product ID")
+		return
+	}
+	now := time.Now()
+	product := Product{
+		ID:          id,
+		SKU:         req.SKU,
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "createProduct")
+	defer cancel()
+
+	if err := s.store.Create(ctx, &product); errors.Is(err, ErrSKUTaken) {
+		apierror.Gin(c, http.StatusConflict, "sku already exists")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to create product")
+		return
+	}
+	c.JSON(http.StatusCreated, product)
+}
+
+func (s *Server) handleUpdateProduct(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Product, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid product ID")
+		return
+	}
+	var update ProductUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if update.Name != nil && *update.Name == "" {
+		apierror.Gin(c, http.StatusBadRequest, "name must not be empty")
+		return
+	}
+	if update.Price != nil {
+		if err := validatePrice(*update.Price); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "updateProduct")
+	defer cancel()
+
+	product, err := s.store.Update(ctx, id, update)
+	if errors.Is(err, ErrProductNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "product not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to update product")
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+func validatePrice(price money.Money) error {
+	if price.Currency() == "" {
+		return errors.New("price is required")
+	}
+	if price.IsNegative() {
+		return errors.New("price must not be negative")
+	}
+	return nil
+}
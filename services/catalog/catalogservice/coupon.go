@@ -0,0 +1,111 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// ErrCouponNotFound is returned when no coupon has the given code
+var ErrCouponNotFound = errors.New("coupon not found")
+
+// couponCode is what a code may contain once upper-cased
+var couponCode = regexp.MustCompile(`^[A-Z0-9_-]{1,32}$`)
+
+// Coupon takes either a percentage or a fixed amount off an order's
+// subtotal. The orders service applies it when the order is placed.
+type Coupon struct {
+	Code       string       `json:"code" bson:"_id"`
+	PercentOff int          `json:"percent_off,omitempty" bson:"percent_off,omitempty"`
+	AmountOff  *money.Money `json:"amount_off,omitempty" bson:"amount_off,omitempty"`
+	Active     bool         `json:"active" bson:"active"`
+	// ExpiresAt, if set, is when the coupon stops being accepted
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// CouponStore is the persistence boundary for coupons
+type CouponStore interface {
+	// Get returns the coupon with code, which must be upper case
+	Get(ctx context.Context, code string) (*Coupon, error)
+	// Put creates or replaces a coupon
+	Put(ctx context.Context, coupon *Coupon) error
+}
+
+// normalizeCode upper-cases code, reporting false if it isn't a valid code
+func normalizeCode(code string) (string, bool) {
+	code = strings.ToUpper(code)
+	return code, couponCode.MatchString(code)
+}
+
+func (s *Server) handleGetCoupon(c *gin.Context) {
+	code, ok := normalizeCode(c.Param("code"))
+	if !ok {
+		apierror.Gin(c, http.StatusBadRequest, "invalid coupon code")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getCoupon")
+	defer cancel()
+
+	coupon, err := s.coupons.Get(ctx, code)
+	if errors.Is(err, ErrCouponNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "coupon not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch coupon")
+		return
+	}
+	c.JSON(http.StatusOK, coupon)
+}
+
+func (s *Server) handlePutCoupon(c *gin.Context) {
+	code, ok := normalizeCode(c.Param("code"))
+	if !ok {
+		apierror.Gin(c, http.StatusBadRequest, "coupon codes are 1 to 32 letters, digits, - or _")
+		return
+	}
+	var req struct {
+		PercentOff int          `json:"percent_off" binding:"min=0,max=100"`
+		AmountOff  *money.Money `json:"amount_off"`
+		Active     *bool        `json:"active"`
+		ExpiresAt  *time.Time   `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (req.PercentOff > 0) == (req.AmountOff != nil) {
+		apierror.Gin(c, http.StatusBadRequest, "set exactly one of percent_off and amount_off")
+		return
+	}
+	if req.AmountOff != nil && (req.AmountOff.Currency() == "" || !req.AmountOff.IsPositive()) {
+		apierror.Gin(c, http.StatusBadRequest, "amount_off must be positive")
+		return
+	}
+
+	coupon := Coupon{
+		Code:       code,
+		PercentOff: req.PercentOff,
+		AmountOff:  req.AmountOff,
+		Active:     req.Active == nil || *req.Active,
+		ExpiresAt:  req.ExpiresAt,
+		UpdatedAt:  time.Now(),
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "putCoupon")
+	defer cancel()
+
+	if err := s.coupons.Put(ctx, &coupon); err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to save coupon")
+		return
+	}
+	c.JSON(http.StatusOK, coupon)
+}
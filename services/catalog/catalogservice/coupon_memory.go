@@ -0,0 +1,35 @@
+package catalogservice
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryCouponStore keeps coupons in a map, for tests and local runs
+// without a database
+type memoryCouponStore struct {
+	mu      sync.Mutex
+	coupons map[string]Coupon
+}
+
+// NewMemoryCouponStore returns an empty in-memory store
+func NewMemoryCouponStore() CouponStore {
+	return &memoryCouponStore{coupons: make(map[string]Coupon)}
+}
+
+func (s *memoryCouponStore) Get(ctx context.Context, code string) (*Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.coupons[code]
+	if !ok {
+		return nil, ErrCouponNotFound
+	}
+	return &c, nil
+}
+
+func (s *memoryCouponStore) Put(ctx context.Context, coupon *Coupon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.coupons[coupon.Code] = *coupon
+	return nil
+}
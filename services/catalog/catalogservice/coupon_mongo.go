@@ -0,0 +1,35 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCouponStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoCouponStore stores coupons in coll, keyed by code
+func NewMongoCouponStore(coll *mongo.Collection) CouponStore {
+	return &mongoCouponStore{coll: coll}
+}
+
+func (s *mongoCouponStore) Get(ctx context.Context, code string) (*Coupon, error) {
+	var c Coupon
+	err := s.coll.FindOne(ctx, bson.M{"_id": code}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCouponNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *mongoCouponStore) Put(ctx context.Context, coupon *Coupon) error {
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": coupon.Code}, coupon, options.Replace().SetUpsert(true))
+	return err
+}
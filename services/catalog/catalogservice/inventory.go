@@ -0,0 +1,274 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+)
+
+// defaultHoldTTL is how long an unconfirmed reservation holds stock
+const defaultHoldTTL = 15 * time.Minute
+
+// Stock is a product's inventory. Reserved counts only holds that haven't
+// expired; Available is what can still be reserved.
+type Stock struct {
+	ProductID string `json:"product_id"`
+	OnHand    int    `json:"on_hand"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+// ReservationItem is a quantity of one product held for an order
+type ReservationItem struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// StockError reports a reservation that would oversell a product
+type StockError struct {
+	ProductID string
+	Requested int
+	Available int
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("only %d of product %s available, %d requested", e.Available, e.ProductID, e.Requested)
+}
+
+// InventoryStore tracks on-hand stock and the holds reservations place on
+// it. Each product's stock and holds change atomically, so concurrent
+// reservations can't take more than is on hand. Holds are keyed by order ID
+// and every operation is idempotent, so callers can safely retry.
+type InventoryStore interface {
+	// Stock returns a product's inventory; a product never stocked has none
+	Stock(ctx context.Context, productID string) (*Stock, error)
+	// SetOnHand records a stock count for a product
+	SetOnHand(ctx context.Context, productID string, onHand int) (*Stock, error)
+	// Reserve holds items for an order until expiresAt. Either every item is
+	// held or, with a *StockError, none is.
+	Reserve(ctx context.Context, orderID string, items []ReservationItem, expiresAt time.Time) error
+	// Confirm makes an order's holds permanent, placing again any that have
+	// expired. On a *StockError the order's holds are released.
+	Confirm(ctx context.Context, orderID string, items []ReservationItem) error
+	// Commit takes an order's held stock off hand, for when it ships
+	Commit(ctx context.Context, orderID string) error
+	// Release drops an order's holds
+	Release(ctx context.Context, orderID string) error
+	// ExpireHolds removes holds that expired by now, returning the number of
+	// products that had any
+	ExpireHolds(ctx context.Context, now time.Time) (int, error)
+}
+
+// mergeItems sums the quantities of lines for the same product, keeping the
+// order they first appear in
+func mergeItems(items []ReservationItem) []ReservationItem {
+	var merged []ReservationItem
+	index := make(map[string]int, len(items))
+	for _, item := range items {
+		if i, ok := index[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// SweepHolds removes expired holds from store every interval until ctx is
+// done. Expired holds already stop counting against stock; sweeping keeps
+// them from piling up.
+func SweepHolds(ctx context.Context, store InventoryStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := store.ExpireHolds(ctx, now)
+			if err != nil {
+				log.Printf("[inventory] Expiring holds failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[inventory] Expired holds on %d products", n)
+			}
+		}
+	}
+}
+
+// stockProblem is the body of a reservation refused for lack of stock
+type stockProblem struct {
+	apierror.Problem
+	ProductID string `json:"product_id"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// reservationFailed answers a reservation the store refused
+func reservationFailed(c *gin.Context, err error, msg string) {
+	var serr *StockError
+	if errors.As(err, &serr) {
+		apierror.GinBody(c, http.StatusConflict, stockProblem{
+			Problem:   apierror.New(c.Request.Context(), http.StatusConflict, serr.Error()),
+			ProductID: serr.ProductID,
+			Requested: serr.Requested,
+			Available: serr.Available,
+		})
+		return
+	}
+	apierror.Gin(c, http.StatusInternalServerError, msg)
+}
+
+func (s *Server) handleGetStock(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Product, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid product ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getStock")
+	defer cancel()
+
+	if _, err := s.store.Get(ctx, id); errors.Is(err, ErrProductNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "product not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch product")
+		return
+	}
+	stock, err := s.inventory.Stock(ctx, id)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch stock")
+		return
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+func (s *Server) handleSetStock(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Product, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid product ID")
+		return
+	}
+	var req struct {
+		OnHand *int `json:"on_hand" binding:"required,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "setStock")
+	defer cancel()
+
+	if _, err := s.store.Get(ctx, id); errors.Is(err, ErrProductNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "product not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch product")
+		return
+	}
+	stock, err := s.inventory.SetOnHand(ctx, id, *req.OnHand)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to update stock")
+		return
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+// bindReservation validates the order ID in the path and the items in the
+// body, answering the request itself if either is bad
+func bindReservation(c *gin.Context) (string, []ReservationItem, bool) {
+	orderID := c.Param("order_id")
+	if err := ids.Validate(ids.Order, orderID); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return "", nil, false
+	}
+	var req struct {
+		Items []ReservationItem `json:"items" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return "", nil, false
+	}
+	for _, item := range req.Items {
+		if err := ids.Validate(ids.Product, item.ProductID); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, fmt.Sprintf("invalid product ID %q", item.ProductID))
+			return "", nil, false
+		}
+	}
+	return orderID, mergeItems(req.Items), true
+}
+
+func (s *Server) handleReserve(c *gin.Context) {
+	orderID, items, ok := bindReservation(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "reserveStock")
+	defer cancel()
+
+	if err := s.inventory.Reserve(ctx, orderID, items, time.Now().Add(s.holdTTL)); err != nil {
+		reservationFailed(c, err, "failed to reserve stock")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleConfirmReservation(c *gin.Context) {
+	orderID, items, ok := bindReservation(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "confirmReservation")
+	defer cancel()
+
+	if err := s.inventory.Confirm(ctx, orderID, items); err != nil {
+		reservationFailed(c, err, "failed to confirm reservation")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleCommitReservation(c *gin.Context) {
+	orderID := c.Param("order_id")
+	if err := ids.Validate(ids.Order, orderID); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "commitReservation")
+	defer cancel()
+
+	if err := s.inventory.Commit(ctx, orderID); err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to commit reservation")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleReleaseReservation(c *gin.Context) {
+	orderID := c.Param("order_id")
+	if err := ids.Validate(ids.Order, orderID); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "releaseReservation")
+	defer cancel()
+
+	if err := s.inventory.Release(ctx, orderID); err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to release reservation")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,175 @@
+package catalogservice
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryHold is stock held for an order; a zero expiresAt never expires
+type memoryHold struct {
+	orderID   string
+	quantity  int
+	expiresAt time.Time
+}
+
+func (h memoryHold) live(now time.Time) bool {
+	return h.expiresAt.IsZero() || h.expiresAt.After(now)
+}
+
+type memoryStock struct {
+	onHand int
+	holds  []memoryHold
+}
+
+func (s *memoryStock) reserved(now time.Time) int {
+	n := 0
+	for _, h := range s.holds {
+		if h.live(now) {
+			n += h.quantity
+		}
+	}
+	return n
+}
+
+// memoryInventoryStore keeps stock in a map behind one lock, for tests and
+// local runs without a database
+type memoryInventoryStore struct {
+	mu    sync.Mutex
+	stock map[string]*memoryStock
+}
+
+// NewMemoryInventoryStore returns an in-memory store with nothing in stock
+func NewMemoryInventoryStore() InventoryStore {
+	return &memoryInventoryStore{stock: make(map[string]*memoryStock)}
+}
+
+// get returns productID's stock, adding an empty entry if it has none
+func (s *memoryInventoryStore) get(productID string) *memoryStock {
+	st, ok := s.stock[productID]
+	if !ok {
+		st = &memoryStock{}
+		s.stock[productID] = st
+	}
+	return st
+}
+
+func (s *memoryInventoryStore) snapshot(productID string, now time.Time) *Stock {
+	st := s.get(productID)
+	reserved := st.reserved(now)
+	return &Stock{
+		ProductID: productID,
+		OnHand:    st.onHand,
+		Reserved:  reserved,
+		Available: max(st.onHand-reserved, 0),
+	}
+}
+
+func (s *memoryInventoryStore) Stock(ctx context.Context, productID string) (*Stock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot(productID, time.Now()), nil
+}
+
+func (s *memoryInventoryStore) SetOnHand(ctx context.Context, productID string, onHand int) (*Stock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(productID).onHand = onHand
+	return s.snapshot(productID, time.Now()), nil
+}
+
+// hold places one item's hold, or makes the order's live hold on it last
+// until expiresAt
+func (s *memoryInventoryStore) hold(orderID string, item ReservationItem, expiresAt, now time.Time) error {
+	st := s.get(item.ProductID)
+	for i, h := range st.holds {
+		if h.orderID == orderID && h.live(now) {
+			if expiresAt.IsZero() {
+				st.holds[i].expiresAt = expiresAt
+			}
+			return nil
+		}
+	}
+	st.holds = slices.DeleteFunc(st.holds, func(h memoryHold) bool { return h.orderID == orderID })
+	if available := st.onHand - st.reserved(now); available < item.Quantity {
+		return &StockError{ProductID: item.ProductID, Requested: item.Quantity, Available: max(available, 0)}
+	}
+	st.holds = append(st.holds, memoryHold{orderID: orderID, quantity: item.Quantity, expiresAt: expiresAt})
+	return nil
+}
+
+// place holds every item or none. Failing partway puts the products' holds
+// back as they were, undoing only what this call placed or confirmed.
+func (s *memoryInventoryStore) place(orderID string, items []ReservationItem, expiresAt time.Time) error {
+	now := time.Now()
+	saved := make(map[string][]memoryHold, len(items))
+	for _, item := range items {
+		if _, ok := saved[item.ProductID]; !ok {
+			saved[item.ProductID] = slices.Clone(s.get(item.ProductID).holds)
+		}
+	}
+	for _, item := range items {
+		if err := s.hold(orderID, item, expiresAt, now); err != nil {
+			for productID, holds := range saved {
+				s.stock[productID].holds = holds
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryInventoryStore) Reserve(ctx context.Context, orderID string, items []ReservationItem, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.place(orderID, items, expiresAt)
+}
+
+func (s *memoryInventoryStore) Confirm(ctx context.Context, orderID string, items []ReservationItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.place(orderID, items, time.Time{})
+}
+
+func (s *memoryInventoryStore) Commit(ctx context.Context, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.stock {
+		st.holds = slices.DeleteFunc(st.holds, func(h memoryHold) bool {
+			if h.orderID != orderID {
+				return false
+			}
+			st.onHand -= h.quantity
+			return true
+		})
+	}
+	return nil
+}
+
+func (s *memoryInventoryStore) release(orderID string) {
+	for _, st := range s.stock {
+		st.holds = slices.DeleteFunc(st.holds, func(h memoryHold) bool { return h.orderID == orderID })
+	}
+}
+
+func (s *memoryInventoryStore) Release(ctx context.Context, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release(orderID)
+	return nil
+}
+
+func (s *memoryInventoryStore) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, st := range s.stock {
+		before := len(st.holds)
+		st.holds = slices.DeleteFunc(st.holds, func(h memoryHold) bool { return !h.live(now) })
+		if len(st.holds) < before {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,212 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoHold is stock held for an order. Holds without expires_at have been
+// confirmed and last until committed or released.
+type mongoHold struct {
+	OrderID   string     `bson:"order_id"`
+	Quantity  int        `bson:"quantity"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+// mongoStock is one product's inventory document. Keeping the holds in it
+// lets a single conditional update check what is available and take it.
+type mongoStock struct {
+	ProductID string      `bson:"_id"`
+	OnHand    int         `bson:"on_hand"`
+	Holds     []mongoHold `bson:"holds"`
+}
+
+func (d *mongoStock) stock(now time.Time) *Stock {
+	reserved := 0
+	for _, h := range d.Holds {
+		if h.ExpiresAt == nil || h.ExpiresAt.After(now) {
+			reserved += h.Quantity
+		}
+	}
+	return &Stock{
+		ProductID: d.ProductID,
+		OnHand:    d.OnHand,
+		Reserved:  reserved,
+		Available: max(d.OnHand-reserved, 0),
+	}
+}
+
+// never stands in for the expiry of confirmed holds in comparisons
+var never = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// liveReserved is an aggregation expression summing the holds that haven't
+// expired by now
+func liveReserved(now time.Time) bson.M {
+	return bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$holds", bson.A{}}},
+			"cond":  bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$$this.expires_at", never}}, now}},
+		}},
+		"in": "$$this.quantity",
+	}}}
+}
+
+// liveHold matches a product with a hold for orderID that hasn't expired
+func liveHold(productID, orderID string, now time.Time) bson.M {
+	return bson.M{"_id": productID, "holds": bson.M{"$elemMatch": bson.M{
+		"order_id": orderID,
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": now}},
+		},
+	}}}
+}
+
+type mongoInventoryStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoInventoryStore keeps one document of stock and holds per product
+// in coll
+func NewMongoInventoryStore(coll *mongo.Collection) InventoryStore {
+	return &mongoInventoryStore{coll: coll}
+}
+
+func (s *mongoInventoryStore) Stock(ctx context.Context, productID string) (*Stock, error) {
+	d := mongoStock{ProductID: productID}
+	err := s.coll.FindOne(ctx, bson.M{"_id": productID}).Decode(&d)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return d.stock(time.Now()), nil
+}
+
+func (s *mongoInventoryStore) SetOnHand(ctx context.Context, productID string, onHand int) (*Stock, error) {
+	var d mongoStock
+	err := s.coll.FindOneAndUpdate(ctx, bson.M{"_id": productID},
+		bson.M{"$set": bson.M{"on_hand": onHand}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&d)
+	if err != nil {
+		return nil, err
+	}
+	return d.stock(time.Now()), nil
+}
+
+// held reports whether the order has a live hold on the item's product,
+// taking away the hold's expiry if expiresAt is nil
+func (s *mongoInventoryStore) held(ctx context.Context, orderID string, item ReservationItem, expiresAt *time.Time, now time.Time) (bool, error) {
+	if expiresAt == nil {
+		res, err := s.coll.UpdateOne(ctx, liveHold(item.ProductID, orderID, now),
+			bson.M{"$unset": bson.M{"holds.$.expires_at": ""}})
+		if err != nil {
+			return false, err
+		}
+		return res.MatchedCount > 0, nil
+	}
+	n, err := s.coll.CountDocuments(ctx, liveHold(item.ProductID, orderID, now))
+	return n > 0, err
+}
+
+// hold places one item's hold until expiresAt, or for good if it is nil. A
+// live hold the order already has is kept, losing its expiry if expiresAt
+// is nil.
+func (s *mongoInventoryStore) hold(ctx context.Context, orderID string, item ReservationItem, expiresAt *time.Time) error {
+	now := time.Now()
+	if ok, err := s.held(ctx, orderID, item, expiresAt, now); err != nil || ok {
+		return err
+	}
+
+	// Drop an expired hold left for the order before placing a new one
+	if _, err := s.coll.UpdateOne(ctx, bson.M{"_id": item.ProductID},
+		bson.M{"$pull": bson.M{"holds": bson.M{"order_id": orderID, "expires_at": bson.M{"$lte": now}}}}); err != nil {
+		return err
+	}
+	res, err := s.coll.UpdateOne(ctx, bson.M{
+		"_id":            item.ProductID,
+		"holds.order_id": bson.M{"$ne": orderID},
+		"$expr": bson.M{"$gte": bson.A{
+			bson.M{"$subtract": bson.A{"$on_hand", liveReserved(now)}},
+			item.Quantity,
+		}},
+	}, bson.M{"$push": bson.M{"holds": mongoHold{OrderID: orderID, Quantity: item.Quantity, ExpiresAt: expiresAt}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	// Another call for the same order may have placed the hold since it was
+	// looked for
+	if ok, err := s.held(ctx, orderID, item, expiresAt, now); err != nil || ok {
+		return err
+	}
+
+	stock, err := s.Stock(ctx, item.ProductID)
+	if err != nil {
+		return err
+	}
+	return &StockError{ProductID: item.ProductID, Requested: item.Quantity, Available: stock.Available}
+}
+
+// place holds every item or none. It runs in a transaction, so failing
+// partway undoes only what this call placed or confirmed, leaving the
+// order's earlier holds and those of concurrent calls alone.
+func (s *mongoInventoryStore) place(ctx context.Context, orderID string, items []ReservationItem, expiresAt *time.Time) error {
+	sess, err := s.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+	_, err = sess.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		for _, item := range items {
+			if err := s.hold(ctx, orderID, item, expiresAt); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (s *mongoInventoryStore) Reserve(ctx context.Context, orderID string, items []ReservationItem, expiresAt time.Time) error {
+	return s.place(ctx, orderID, items, &expiresAt)
+}
+
+func (s *mongoInventoryStore) Confirm(ctx context.Context, orderID string, items []ReservationItem) error {
+	return s.place(ctx, orderID, items, nil)
+}
+
+func (s *mongoInventoryStore) Commit(ctx context.Context, orderID string) error {
+	isOrder := bson.M{"$eq": bson.A{"$$this.order_id", orderID}}
+	_, err := s.coll.UpdateMany(ctx, bson.M{"holds.order_id": orderID}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"on_hand": bson.M{"$subtract": bson.A{"$on_hand", bson.M{"$sum": bson.M{"$map": bson.M{
+				"input": bson.M{"$filter": bson.M{"input": "$holds", "cond": isOrder}},
+				"in":    "$$this.quantity",
+			}}}}},
+			"holds": bson.M{"$filter": bson.M{"input": "$holds", "cond": bson.M{"$not": bson.A{isOrder}}}},
+		}}},
+	})
+	return err
+}
+
+func (s *mongoInventoryStore) Release(ctx context.Context, orderID string) error {
+	_, err := s.coll.UpdateMany(ctx, bson.M{"holds.order_id": orderID},
+		bson.M{"$pull": bson.M{"holds": bson.M{"order_id": orderID}}})
+	return err
+}
+
+func (s *mongoInventoryStore) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	expired := bson.M{"$lte": now}
+	res, err := s.coll.UpdateMany(ctx, bson.M{"holds.expires_at": expired},
+		bson.M{"$pull": bson.M{"holds": bson.M{"expires_at": expired}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
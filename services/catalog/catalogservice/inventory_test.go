@@ -0,0 +1,182 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+)
+
+// reserveInParallel places one reservation per element of orders at once,
+// for orders with IDs starting with prefix, and returns how many succeeded.
+// Every failure must be a *StockError.
+func reserveInParallel(t *testing.T, store InventoryStore, prefix string, orders [][]ReservationItem) int {
+	t.Helper()
+	expiresAt := time.Now().Add(time.Hour)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i, items := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Reserve(context.Background(), fmt.Sprintf("%s_%d", prefix, i), items, expiresAt)
+			var stockErr *StockError
+			switch {
+			case err == nil:
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			case !errors.As(err, &stockErr):
+				t.Errorf("Reserve: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return reserved
+}
+
+// stockOf returns the product's stock, failing the test on an error
+func stockOf(t *testing.T, store InventoryStore, productID string) *Stock {
+	t.Helper()
+	stock, err := store.Stock(context.Background(), productID)
+	if err != nil {
+		t.Fatalf("Stock(%s): %v", productID, err)
+	}
+	return stock
+}
+
+// testNoOversell races more reservations than there is stock for
+func testNoOversell(t *testing.T, store InventoryStore) {
+	ctx := context.Background()
+	for _, id := range []string{"prd_a", "prd_b"} {
+		if _, err := store.SetOnHand(ctx, id, 10); err != nil {
+			t.Fatalf("SetOnHand(%s): %v", id, err)
+		}
+	}
+
+	t.Run("one product", func(t *testing.T) {
+		orders := make([][]ReservationItem, 40)
+		for i := range orders {
+			orders[i] = []ReservationItem{{ProductID: "prd_a", Quantity: 1}}
+		}
+		if n := reserveInParallel(t, store, "ord_one", orders); n != 10 {
+			t.Errorf("%d reservations of one each succeeded, want the 10 on hand", n)
+		}
+		if stock := stockOf(t, store, "prd_a"); stock.Reserved != 10 || stock.Available != 0 {
+			t.Errorf("stock = %+v, want all 10 reserved", stock)
+		}
+	})
+
+	t.Run("several products", func(t *testing.T) {
+		// Half the orders hold the products in the opposite order, so partly
+		// placed reservations race each other and are rolled back
+		orders := make([][]ReservationItem, 40)
+		for i := range orders {
+			orders[i] = []ReservationItem{{ProductID: "prd_b", Quantity: 1}, {ProductID: "prd_a", Quantity: 1}}
+			if i%2 == 0 {
+				orders[i][0], orders[i][1] = orders[i][1], orders[i][0]
+			}
+		}
+		// prd_a is already sold out, so every order must fail whole
+		if n := reserveInParallel(t, store, "ord_soldout", orders); n != 0 {
+			t.Errorf("%d reservations succeeded with prd_a sold out, want none", n)
+		}
+		if stock := stockOf(t, store, "prd_b"); stock.Reserved != 0 || stock.Available != 10 {
+			t.Errorf("stock = %+v, want nothing held by the failed orders", stock)
+		}
+
+		if _, err := store.SetOnHand(ctx, "prd_a", 20); err != nil {
+			t.Fatalf("SetOnHand: %v", err)
+		}
+		// Placing an order's holds is all or nothing, so failed orders can't
+		// keep stock from the others and exactly 10 get both products
+		if n := reserveInParallel(t, store, "ord_several", orders); n != 10 {
+			t.Errorf("%d reservations succeeded, want the 10 there is stock for", n)
+		}
+		if stock := stockOf(t, store, "prd_a"); stock.Reserved != 20 || stock.Available != 0 {
+			t.Errorf("prd_a stock = %+v, want all 20 reserved", stock)
+		}
+		if stock := stockOf(t, store, "prd_b"); stock.Reserved != 10 || stock.Available != 0 {
+			t.Errorf("prd_b stock = %+v, want all 10 reserved", stock)
+		}
+	})
+
+	t.Run("one order", func(t *testing.T) {
+		// A retried request races the original for the same order; neither
+		// may fail or undo the hold the other placed
+		if _, err := store.SetOnHand(ctx, "prd_c", 5); err != nil {
+			t.Fatalf("SetOnHand: %v", err)
+		}
+		items := []ReservationItem{{ProductID: "prd_c", Quantity: 2}}
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := store.Reserve(ctx, "ord_retried", items, time.Now().Add(time.Hour)); err != nil {
+					t.Errorf("Reserve: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if stock := stockOf(t, store, "prd_c"); stock.Reserved != 2 {
+			t.Errorf("stock = %+v, want the order's one hold of 2", stock)
+		}
+	})
+}
+
+func testFailedConfirmKeepsHolds(t *testing.T, store InventoryStore) {
+	ctx := context.Background()
+	for id, onHand := range map[string]int{"prd_d": 10, "prd_e": 1} {
+		if _, err := store.SetOnHand(ctx, id, onHand); err != nil {
+			t.Fatalf("SetOnHand(%s): %v", id, err)
+		}
+	}
+	if err := store.Reserve(ctx, "ord_held", []ReservationItem{{ProductID: "prd_d", Quantity: 3}}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	// Confirming more than there is of prd_e fails, and must leave the hold
+	// the order placed before alone
+	items := []ReservationItem{{ProductID: "prd_d", Quantity: 3}, {ProductID: "prd_e", Quantity: 2}}
+	var stockErr *StockError
+	if err := store.Confirm(ctx, "ord_held", items); !errors.As(err, &stockErr) {
+		t.Fatalf("Confirm err = %v, want a *StockError", err)
+	}
+	if stock := stockOf(t, store, "prd_d"); stock.Reserved != 3 {
+		t.Errorf("prd_d stock = %+v, want the earlier hold of 3 kept", stock)
+	}
+	if stock := stockOf(t, store, "prd_e"); stock.Reserved != 0 {
+		t.Errorf("prd_e stock = %+v, want nothing held", stock)
+	}
+	// The hold still expires, since the confirmation didn't happen
+	if _, err := store.ExpireHolds(ctx, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("ExpireHolds: %v", err)
+	}
+	if stock := stockOf(t, store, "prd_d"); stock.Reserved != 0 {
+		t.Errorf("prd_d stock = %+v after expiry, want the hold gone", stock)
+	}
+}
+
+func TestMemoryInventoryNoOversell(t *testing.T) {
+	testNoOversell(t, NewMemoryInventoryStore())
+}
+
+func TestMongoInventoryNoOversell(t *testing.T) {
+	testNoOversell(t, NewMongoInventoryStore(dbtest.Mongo(t).Collection("inventory")))
+}
+
+func TestMemoryInventoryFailedConfirmKeepsHolds(t *testing.T) {
+	testFailedConfirmKeepsHolds(t, NewMemoryInventoryStore())
+}
+
+func TestMongoInventoryFailedConfirmKeepsHolds(t *testing.T) {
+	testFailedConfirmKeepsHolds(t, NewMongoInventoryStore(dbtest.Mongo(t).Collection("inventory")))
+}
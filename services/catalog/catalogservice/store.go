@@ -0,0 +1,49 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrProductNotFound is returned when no product has the given ID
+	ErrProductNotFound = errors.New("product not found")
+	// ErrSKUTaken is returned when another product has the SKU
+	ErrSKUTaken = errors.New("sku already exists")
+)
+
+// ProductFilter narrows the products returned by ProductStore.List
+type ProductFilter struct {
+	// IDs, if set, limits the listing to those products
+	IDs        []string
+	ActiveOnly bool
+	Limit      int
+}
+
+// ProductUpdate changes a product; nil fields are left as they are
+type ProductUpdate struct {
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Price       *money.Money `json:"price"`
+	Active      *bool        `json:"active"`
+}
+
+// ProductStore is the persistence boundary for the catalog
+type ProductStore interface {
+	// List returns the matching products ordered by SKU
+	List(ctx context.Context, filter ProductFilter) ([]Product, error)
+	Get(ctx context.Context, id string) (*Product, error)
+	// Create inserts product, returning ErrSKUTaken if the SKU is in use
+	Create(ctx context.Context, product *Product) error
+	// Update applies update and returns the product as updated
+	Update(ctx context.Context, id string, update ProductUpdate) (*Product, error)
+	Ping(ctx context.Context) error
+}
+
+// NewMongoStore stores products in coll
+func NewMongoStore(coll *mongo.Collection) ProductStore {
+	return &mongoProductStore{coll: coll}
+}
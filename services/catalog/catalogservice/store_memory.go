@@ -0,0 +1,90 @@
+package catalogservice
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryProductStore keeps products in a map, for tests and local runs
+// without a database
+type memoryProductStore struct {
+	mu       sync.Mutex
+	products map[string]Product
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() ProductStore {
+	return &memoryProductStore{products: make(map[string]Product)}
+}
+
+func (s *memoryProductStore) List(ctx context.Context, filter ProductFilter) ([]Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var products []Product
+	for _, p := range s.products {
+		if filter.IDs != nil && !slices.Contains(filter.IDs, p.ID) || filter.ActiveOnly && !p.Active {
+			continue
+		}
+		products = append(products, p)
+	}
+	slices.SortFunc(products, func(a, b Product) int {
+		return strings.Compare(a.SKU, b.SKU)
+	})
+	if filter.Limit > 0 && len(products) > filter.Limit {
+		products = products[:filter.Limit]
+	}
+	return products, nil
+}
+
+func (s *memoryProductStore) Get(ctx context.Context, id string) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	return &p, nil
+}
+
+func (s *memoryProductStore) Create(ctx context.Context, product *Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.products {
+		if p.SKU == product.SKU {
+			return ErrSKUTaken
+		}
+	}
+	s.products[product.ID] = *product
+	return nil
+}
+
+func (s *memoryProductStore) Update(ctx context.Context, id string, update ProductUpdate) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	if update.Name != nil {
+		p.Name = *update.Name
+	}
+	if update.Description != nil {
+		p.Description = *update.Description
+	}
+	if update.Price != nil {
+		p.Price = *update.Price
+	}
+	if update.Active != nil {
+		p.Active = *update.Active
+	}
+	p.UpdatedAt = time.Now()
+	s.products[id] = p
+	return &p, nil
+}
+
+func (s *memoryProductStore) Ping(ctx context.Context) error {
+	return nil
+}
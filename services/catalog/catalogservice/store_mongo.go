@@ -0,0 +1,86 @@
+package catalogservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoProductStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoProductStore) List(ctx context.Context, filter ProductFilter) ([]Product, error) {
+	query := bson.M{}
+	if filter.IDs != nil {
+		query["_id"] = bson.M{"$in": filter.IDs}
+	}
+	if filter.ActiveOnly {
+		query["active"] = true
+	}
+	opts := options.Find().
+		SetLimit(int64(filter.Limit)).
+		SetSort(bson.D{{Key: "sku", Value: 1}})
+
+	cursor, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var products []Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (s *mongoProductStore) Get(ctx context.Context, id string) (*Product, error) {
+	var p Product
+	err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrProductNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *mongoProductStore) Create(ctx context.Context, product *Product) error {
+	_, err := s.coll.InsertOne(ctx, product)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrSKUTaken
+	}
+	return err
+}
+
+func (s *mongoProductStore) Update(ctx context.Context, id string, update ProductUpdate) (*Product, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if update.Price != nil {
+		set["price"] = *update.Price
+	}
+	if update.Active != nil {
+		set["active"] = *update.Active
+	}
+	var p Product
+	err := s.coll.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrProductNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *mongoProductStore) Ping(ctx context.Context) error {
+	return s.coll.Database().Client().Ping(ctx, nil)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/server"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+	"github.com/obakengphikiso/go-monorepo/services/catalog/catalogservice"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+func main() {
+	ctx := context.Background()
+	if len(os.Args) > 1 && os.Args[1] == "speccheck" {
+		// Compare the routes with openapi.yaml; needs no database
+		gin.SetMode(gin.ReleaseMode)
+		routes := catalogservice.NewServer(catalogservice.Deps{}).Routes()
+		if err := openapi.Check(openAPISpec, routes, os.Stdout, openapi.Operational...); err != nil {
+			log.Fatalf("Spec check failed: %v", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, "catalog")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	dbURL := shared.GetEnv("CATALOG_DB_URL", "mongodb://mongo:27017")
+	products, err := shared.GetMongoCollection(dbURL, "catalog", "products")
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	db := products.Database()
+
+	migrator, err := migrate.New(db, migrations...)
+	if err != nil {
+		log.Fatalf("Invalid migrations: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(ctx, migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if err := migrate.RequireCurrent(ctx, migrator); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	idCfg, err := identity.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid identity config: %v", err)
+	}
+
+	checks := health.New(2 * time.Second)
+	checks.AddStartup(health.Func("migrations", func(ctx context.Context) error {
+		return migrate.RequireCurrent(ctx, migrator)
+	}))
+
+	inventory := catalogservice.NewMongoInventoryStore(db.Collection("inventory"))
+	api := catalogservice.NewServer(catalogservice.Deps{
+		Store:     catalogservice.NewMongoStore(products),
+		Inventory: inventory,
+		Coupons:   catalogservice.NewMongoCouponStore(db.Collection("coupons")),
+		HoldTTL:   shared.GetEnvDuration("INVENTORY_HOLD_TTL", 15*time.Minute),
+		Identity:  idCfg,
+		Health:    checks,
+		Timeouts:  deadline.TimeoutsFromEnv(),
+	})
+
+	sweepCtx, stopSweep := context.WithCancel(ctx)
+	go catalogservice.SweepHolds(sweepCtx, inventory, shared.GetEnvDuration("INVENTORY_SWEEP_INTERVAL", time.Minute))
+
+	srv := server.New(server.ConfigFromEnv("8080"), api)
+	srv.OnShutdown("tracer", shutdownTracing)
+	srv.OnShutdown("mongo", db.Client().Disconnect)
+	srv.OnShutdown("hold sweeper", func(context.Context) error {
+		stopSweep()
+		return nil
+	})
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
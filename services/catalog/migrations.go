@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations evolve the catalog database. Append new entries with the next
+// version; never edit one that has shipped.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "unique index on sku",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("products").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "sku", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("products").Indexes().DropOne(ctx, "sku_1")
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "indexes on inventory holds by order and expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("inventory").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "holds.order_id", Value: 1}}},
+				{Keys: bson.D{{Key: "holds.expires_at", Value: 1}}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"holds.order_id_1", "holds.expires_at_1"} {
+				if _, err := db.Collection("inventory").Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
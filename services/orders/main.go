@@ -2,346 +2,117 @@ package main
 
 import (
 	"context"
-	"fmt"
+	_ "embed"
 	"log"
-	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/obakengphikiso/go-monorepo/libs/shared"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/events"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/httpclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/server"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+	"github.com/obakengphikiso/go-monorepo/services/orders/ordersservice"
 )
 
-type OrderStatus string
+//go:embed openapi.yaml
+var openAPISpec []byte
 
-const (
-	StatusPending   OrderStatus = "pending"
-	StatusConfirmed OrderStatus = "confirmed"
-	StatusShipped   OrderStatus = "shipped"
-	StatusDelivered OrderStatus = "delivered"
-	StatusCancelled OrderStatus = "cancelled"
-)
-
-type Order struct {
-	ID          string      `json:"id" bson:"_id"`
-	UserID      string      `json:"user_id" bson:"user_id"`
-	Amount      float64     `json:"amount" binding:"required" bson:"amount"`
-	Status      OrderStatus `json:"status" bson:"status"`
-	Items       []OrderItem `json:"items" binding:"required" bson:"items"`
-	CreatedAt   time.Time   `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at" bson:"updated_at"`
-	Description string      `json:"description" bson:"description"`
-}
-
-type OrderItem struct {
-	ProductID   string  `json:"product_id" binding:"required" bson:"product_id"`
-	Quantity    int     `json:"quantity" binding:"required,min=1" bson:"quantity"`
-	UnitPrice   float64 `json:"unit_price" binding:"required,min=0" bson:"unit_price"`
-	Description string  `json:"description" bson:"description"`
-}
-
-var (
-	db               *mongo.Database
-	ordersCollection *mongo.Collection
-)
-
-func connectDB() error {
-	// Use shared.GetMongoCollection for orders
-	dbURL := shared.GetEnv("ORDERS_DB_URL", "mongodb://mongo:27017")
-	coll, err := shared.GetMongoCollection(dbURL, "orders", "orders")
-	if err != nil {
-		return err
-	}
-	db = coll.Database()
-	ordersCollection = coll
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	// Create indexes
-	_, err = ordersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{
-			Keys: bson.D{{Key: "user_id", Value: 1}},
-		},
-		{
-			Keys: bson.D{{Key: "status", Value: 1}},
-		},
-		{
-			Keys: bson.D{{Key: "created_at", Value: -1}},
-		},
-	})
-	return err
-}
-
-func getUserIDFromHeader(c *gin.Context) string {
-	return c.GetHeader("X-User-ID")
-}
-
-func handleGetOrders(c *gin.Context) {
-	userID := getUserIDFromHeader(c)
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Parse query parameters
-	status := c.Query("status")
-	limit := 10 // Default limit
-	if limitStr := c.Query("limit"); limitStr != "" {
-		fmt.Sscanf(limitStr, "%d", &limit)
-		if limit <= 0 {
-			limit = 10
+func main() {
+	ctx := context.Background()
+	if len(os.Args) > 1 && os.Args[1] == "speccheck" {
+		// Compare the routes with openapi.yaml; needs no database
+		gin.SetMode(gin.ReleaseMode)
+		routes := ordersservice.NewServer(ordersservice.Deps{}).Routes()
+		if err := openapi.Check(openAPISpec, routes, os.Stdout, openapi.Operational...); err != nil {
+			log.Fatalf("Spec check failed: %v", err)
 		}
-	}
-
-	query := bson.M{"user_id": userID}
-	if status != "" {
-		query["status"] = status
-	}
-
-	// Set up options for pagination and sorting
-	options := options.Find().
-		SetLimit(int64(limit)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}})
-
-	cursor, err := ordersCollection.Find(ctx, query, options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
-		return
-	}
-
-	var orders []Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
-}
-
-func handleGetOrder(c *gin.Context) {
-	id := c.Param("id")
-	userID := getUserIDFromHeader(c)
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	var order Order
-	err := ordersCollection.FindOne(ctx, bson.M{
-		"_id":     id,
-		"user_id": userID,
-	}).Decode(&order)
-
-	if err == mongo.ErrNoDocuments {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order"})
-		return
-	}
-
-	c.JSON(http.StatusOK, order)
-}
-
-func handleCreateOrder(c *gin.Context) {
-	userID := getUserIDFromHeader(c)
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
-		return
-	}
-
-	var order Order
-	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	order.ID = shared.GenerateID()
-	order.UserID = userID
-	order.Status = StatusPending
-	order.CreatedAt = time.Now()
-	order.UpdatedAt = time.Now()
-
-	// Calculate total amount from items
-	var total float64
-	for _, item := range order.Items {
-		total += item.UnitPrice * float64(item.Quantity)
-	}
-	order.Amount = total
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	_, err := ordersCollection.InsertOne(ctx, order)
+	shutdownTracing, err := tracing.Init(ctx, "orders")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create order"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, order)
-}
-
-func handleUpdateOrderStatus(c *gin.Context) {
-	id := c.Param("id")
-	userID := getUserIDFromHeader(c)
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
-		return
-	}
-
-	var update struct {
-		Status OrderStatus `json:"status" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&update); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
 
-	// Validate status transition
-	if !isValidStatus(update.Status) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := ordersCollection.UpdateOne(
-		ctx,
-		bson.M{
-			"_id":     id,
-			"user_id": userID,
-		},
-		bson.M{
-			"$set": bson.M{
-				"status":     update.Status,
-				"updated_at": time.Now(),
-			},
-		},
-	)
-
+	store, migrator, err := openOrderStore(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
-		return
+		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.RunCommand(ctx, migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "order status updated successfully"})
-}
-
-func handleCancelOrder(c *gin.Context) {
-	id := c.Param("id")
-	userID := getUserIDFromHeader(c)
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
-		return
+	if err := migrate.RequireCurrent(ctx, migrator); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Only allow cancellation of pending orders
-	result, err := ordersCollection.UpdateOne(
-		ctx,
-		bson.M{
-			"_id":     id,
-			"user_id": userID,
-			"status":  StatusPending,
-		},
-		bson.M{
-			"$set": bson.M{
-				"status":     StatusCancelled,
-				"updated_at": time.Now(),
-			},
-		},
-	)
-
+	idCfg, err := identity.ConfigFromEnv()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel order"})
-		return
+		log.Fatalf("Invalid identity config: %v", err)
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found or cannot be cancelled"})
-		return
-	}
+	checks := health.New(2 * time.Second)
+	checks.AddStartup(health.Func("migrations", func(ctx context.Context) error {
+		return migrate.RequireCurrent(ctx, migrator)
+	}))
 
-	c.JSON(http.StatusOK, gin.H{"message": "order cancelled successfully"})
-}
-
-func isValidStatus(status OrderStatus) bool {
-	validStatuses := []OrderStatus{
-		StatusPending,
-		StatusConfirmed,
-		StatusShipped,
-		StatusDelivered,
-		StatusCancelled,
-	}
+	catalog := ordersservice.NewCatalogClient(shared.GetEnv("CATALOG_URL", "http://catalog:8080"), idCfg,
+		clients.WithHTTPClient(httpclient.New(httpclient.ConfigFromEnv("orders"))))
 
-	for _, s := range validStatuses {
-		if status == s {
-			return true
-		}
-	}
-	return false
-}
-
-func healthCheck(c *gin.Context) {
-	var status string
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	api := ordersservice.NewServer(ordersservice.Deps{
+		Store:    store,
+		Identity: idCfg,
+		Health:   checks,
+		Catalog:  catalog,
+		Timeouts: deadline.TimeoutsFromEnv(),
+	})
 
-	// Check MongoDB connection
-	err := db.Client().Ping(ctx, nil)
+	bus, err := events.Open(ctx, events.ConfigFromEnv())
 	if err != nil {
-		status = "unhealthy"
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status":  status,
-			"message": "database connection failed",
-		})
-		return
-	}
-
-	status = "healthy"
-	c.JSON(http.StatusOK, gin.H{
-		"status":  status,
-		"version": shared.Version(),
+		log.Fatalf("Failed to connect to event bus: %v", err)
+	}
+	publisher := outbox.LogPublisher("orders")
+	if bus != nil {
+		publisher = events.OutboxPublisher(bus, "orders")
+	}
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	relay := outbox.NewRelay(store.Outbox(), publisher, shared.GetEnvDuration("OUTBOX_RELAY_INTERVAL", time.Second))
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
+	srv := server.New(server.ConfigFromEnv("8080"), api)
+	srv.OnShutdown("tracer", shutdownTracing)
+	srv.OnShutdown("orders store", store.Close)
+	if bus != nil {
+		srv.OnShutdown("event bus", func(context.Context) error { return bus.Close() })
+	}
+	// Runs before the bus and store close, so the relay's last publish has
+	// finished with them
+	srv.OnShutdown("outbox relay", func(ctx context.Context) error {
+		stopRelay()
+		select {
+		case <-relayDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	})
-}
-
-func main() {
-	if err := connectDB(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
-	r := gin.Default()
-
-	// Health check endpoint
-	r.GET("/health", healthCheck)
-
-	// Order endpoints - no auth middleware needed
-	orders := r.Group("/orders")
-	{
-		orders.GET("", handleGetOrders)
-		orders.POST("", handleCreateOrder)
-		orders.GET("/:id", handleGetOrder)
-		orders.PUT("/:id/status", handleUpdateOrderStatus)
-		orders.POST("/:id/cancel", handleCancelOrder)
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalf("Server error: %v", err)
 	}
-
-	port := shared.GetEnv("PORT", "8080")
-	r.Run(":" + port)
 }
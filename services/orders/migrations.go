@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/services/orders/ordersservice"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigrations evolve the orders database when ORDERS_STORE=mongo. The
+// Postgres schema lives in migrations/*.sql instead.
+var mongoMigrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "index orders by user_id, status and created_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("orders").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "user_id", Value: 1}},
+				},
+				{
+					Keys: bson.D{{Key: "status", Value: 1}},
+				},
+				{
+					Keys: bson.D{{Key: "created_at", Value: -1}},
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"user_id_1", "status_1", "created_at_-1"} {
+				if _, err := db.Collection("orders").Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "store amounts and unit prices as money",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Legacy orders have no currency and are read as money.DefaultCurrency
+			return rewriteOrders(ctx, db, bson.M{"amount": bson.M{"$type": "number"}},
+				func(doc bson.Raw) (bson.M, error) {
+					set := bson.M{}
+					amount, err := money.FromFloat(lookupFloat(doc, "amount"), money.DefaultCurrency)
+					if err != nil {
+						return nil, err
+					}
+					set["amount"] = amount
+					items, _ := doc.Lookup("items").ArrayOK()
+					values, _ := items.Values()
+					for i, item := range values {
+						price, err := money.FromFloat(lookupFloat(item.Document(), "unit_price"), amount.Currency())
+						if err != nil {
+							return nil, err
+						}
+						set["items."+strconv.Itoa(i)+".unit_price"] = price
+					}
+					return set, nil
+				})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return rewriteOrders(ctx, db, bson.M{"amount": bson.M{"$type": "object"}},
+				func(doc bson.Raw) (bson.M, error) {
+					var order ordersservice.Order
+					if err := bson.Unmarshal(doc, &order); err != nil {
+						return nil, err
+					}
+					set := bson.M{}
+					amount, err := strconv.ParseFloat(order.Amount.Decimal(), 64)
+					if err != nil {
+						return nil, err
+					}
+					set["amount"] = amount
+					for i, item := range order.Items {
+						price, err := strconv.ParseFloat(item.UnitPrice.Decimal(), 64)
+						if err != nil {
+							return nil, err
+						}
+						set["items."+strconv.Itoa(i)+".unit_price"] = price
+					}
+					return set, nil
+				})
+		},
+	},
+	{
+		Version:     3,
+		Description: "keep a status history on each order",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Orders created before this only have their creation and, if
+			// they have moved on since, their last change, whose author isn't
+			// known
+			err := rewriteOrders(ctx, db, bson.M{"history": bson.M{"$exists": false}},
+				func(doc bson.Raw) (bson.M, error) {
+					var order ordersservice.Order
+					if err := bson.Unmarshal(doc, &order); err != nil {
+						return nil, err
+					}
+					history := []ordersservice.StatusChange{{
+						To:    ordersservice.StatusPending,
+						Actor: order.UserID,
+						At:    order.CreatedAt,
+					}}
+					if order.Status != ordersservice.StatusPending {
+						history = append(history, ordersservice.StatusChange{
+							From:   ordersservice.StatusPending,
+							To:     order.Status,
+							Reason: "recorded before history was kept",
+							At:     order.UpdatedAt,
+						})
+					}
+					return bson.M{"history": history}, nil
+				})
+			if err != nil {
+				return err
+			}
+			// For SLA reports: when orders reached each status
+			_, err = db.Collection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "history.to", Value: 1}, {Key: "history.at", Value: 1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			coll := db.Collection("orders")
+			if _, err := coll.Indexes().DropOne(ctx, "history.to_1_history.at_1"); err != nil {
+				return err
+			}
+			_, err := coll.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"history": ""}})
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "index a user's orders by created_at and _id for keyset pagination",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("orders").Indexes().DropOne(ctx, "user_id_1_created_at_-1__id_-1")
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "index every customer's orders by created_at and _id, and by product, for operators",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("orders").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "items.product_id", Value: 1}}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"created_at_-1__id_-1", "items.product_id_1"} {
+				if _, err := db.Collection("orders").Indexes().DropOne(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     6,
+		Description: "unique index on the checkout that placed an order",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Partial, so orders placed without a checkout don't collide
+			_, err := db.Collection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "checkout_id", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"checkout_id": bson.M{"$type": "string"}}),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("orders").Indexes().DropOne(ctx, "checkout_id_1")
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "outbox of order events, indexed by publication",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Transactions can't create collections on older servers
+			for _, name := range []string{"outbox", "outbox_sequences", "outbox_lease"} {
+				if err := db.CreateCollection(ctx, name); err != nil {
+					return err
+				}
+			}
+			_, err := db.Collection("outbox").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}},
+				{
+					Keys:    bson.D{{Key: "aggregate_type", Value: 1}, {Key: "aggregate_id", Value: 1}, {Key: "sequence", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"outbox", "outbox_sequences", "outbox_lease"} {
+				if err := db.Collection(name).Drop(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// rewriteOrders applies the $set built by convert to every order matching
+// filter, in batches
+func rewriteOrders(ctx context.Context, db *mongo.Database, filter bson.M, convert func(bson.Raw) (bson.M, error)) error {
+	coll := db.Collection("orders")
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		set, err := convert(cursor.Current)
+		if err != nil {
+			return fmt.Errorf("order %v: %w", cursor.Current.Lookup("_id"), err)
+		}
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": cursor.Current.Lookup("_id")}).
+			SetUpdate(bson.M{"$set": set}))
+		if len(batch) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// lookupFloat reads a legacy numeric field, whichever BSON number type it
+// was stored as
+func lookupFloat(doc bson.Raw, key string) float64 {
+	v := doc.Lookup(key)
+	if f, ok := v.DoubleOK(); ok {
+		return f
+	}
+	if n, ok := v.AsInt64OK(); ok {
+		return float64(n)
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+CREATE TABLE orders (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL,
+    amount      NUMERIC(18, 2) NOT NULL CHECK (amount >= 0),
+    status      TEXT NOT NULL CHECK (status IN ('pending', 'confirmed', 'shipped', 'delivered', 'cancelled')),
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX orders_user_id_created_at_idx ON orders (user_id, created_at DESC);
+CREATE INDEX orders_status_idx ON orders (status);
+
+CREATE TABLE order_items (
+    order_id    TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    position    INTEGER NOT NULL,
+    product_id  TEXT NOT NULL,
+    quantity    INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price  NUMERIC(18, 2) NOT NULL CHECK (unit_price >= 0),
+    description TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (order_id, position)
+);
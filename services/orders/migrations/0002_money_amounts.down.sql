@@ -0,0 +1,15 @@
+-- Only exact for two-decimal currencies; the currency itself is dropped
+ALTER TABLE order_items ADD COLUMN unit_price NUMERIC(18, 2);
+UPDATE order_items SET unit_price = unit_price_minor / 100.0;
+ALTER TABLE order_items
+    ALTER COLUMN unit_price SET NOT NULL,
+    ADD CONSTRAINT order_items_unit_price_check CHECK (unit_price >= 0),
+    DROP COLUMN unit_price_minor;
+
+ALTER TABLE orders ADD COLUMN amount NUMERIC(18, 2);
+UPDATE orders SET amount = amount_minor / 100.0;
+ALTER TABLE orders
+    ALTER COLUMN amount SET NOT NULL,
+    ADD CONSTRAINT orders_amount_check CHECK (amount >= 0),
+    DROP COLUMN amount_minor,
+    DROP COLUMN currency;
@@ -0,0 +1,19 @@
+-- Amounts become integer minor units plus a currency. Orders written before
+-- this had no currency and are taken to be USD (money.DefaultCurrency).
+ALTER TABLE orders
+    ADD COLUMN amount_minor BIGINT,
+    ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+UPDATE orders SET amount_minor = round(amount * 100);
+ALTER TABLE orders
+    ALTER COLUMN amount_minor SET NOT NULL,
+    ALTER COLUMN currency DROP DEFAULT,
+    ADD CONSTRAINT orders_amount_minor_check CHECK (amount_minor >= 0),
+    DROP COLUMN amount;
+
+-- Items are priced in their order's currency
+ALTER TABLE order_items ADD COLUMN unit_price_minor BIGINT;
+UPDATE order_items SET unit_price_minor = round(unit_price * 100);
+ALTER TABLE order_items
+    ALTER COLUMN unit_price_minor SET NOT NULL,
+    ADD CONSTRAINT order_items_unit_price_minor_check CHECK (unit_price_minor >= 0),
+    DROP COLUMN unit_price;
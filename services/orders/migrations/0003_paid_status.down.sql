@@ -0,0 +1,5 @@
+-- Paid orders go back to pending; the record of payment is lost
+UPDATE orders SET status = 'pending' WHERE status = 'paid';
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'confirmed', 'shipped', 'delivered', 'cancelled'));
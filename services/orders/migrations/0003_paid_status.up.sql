@@ -0,0 +1,4 @@
+-- Orders are paid before they can be confirmed
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'confirmed', 'shipped', 'delivered', 'cancelled'));
@@ -0,0 +1,21 @@
+CREATE TABLE order_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    reason      TEXT NOT NULL DEFAULT '',
+    changed_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history (order_id, id);
+-- For SLA reports: when orders reached each status
+CREATE INDEX order_status_history_to_status_changed_at_idx ON order_status_history (to_status, changed_at);
+
+-- Orders created before this only have their creation and, if they have
+-- moved on since, their last change, whose author isn't known
+INSERT INTO order_status_history (order_id, from_status, to_status, actor, changed_at)
+SELECT id, NULL, 'pending', user_id, created_at FROM orders;
+INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at)
+SELECT id, 'pending', status, '', 'recorded before history was kept', updated_at
+FROM orders WHERE status <> 'pending';
@@ -0,0 +1 @@
+ALTER TABLE order_items DROP COLUMN name;
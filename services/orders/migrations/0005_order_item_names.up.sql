@@ -0,0 +1,2 @@
+-- Items snapshot the catalog's product name when the order is placed
+ALTER TABLE order_items ADD COLUMN name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Discounts are in the order's currency; orders placed before coupons have none
+ALTER TABLE orders ADD COLUMN discount_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN coupon TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Listings page on (created_at, id); the id breaks ties between orders
+-- created in the same microsecond
+CREATE INDEX orders_user_id_created_at_id_idx ON orders (user_id, created_at DESC, id DESC);
+DROP INDEX orders_user_id_created_at_idx;
@@ -0,0 +1,3 @@
+DROP INDEX order_items_product_id_idx;
+DROP INDEX orders_created_at_id_idx;
+DROP TABLE order_notes;
@@ -0,0 +1,13 @@
+-- Internal notes staff keep on orders; customers never see them
+CREATE TABLE order_notes (
+    id         BIGSERIAL PRIMARY KEY,
+    order_id   TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    author     TEXT NOT NULL,
+    text       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX order_notes_order_id_idx ON order_notes (order_id, id);
+-- Operators list every customer's orders and search them by product
+CREATE INDEX orders_created_at_id_idx ON orders (created_at DESC, id DESC);
+CREATE INDEX order_items_product_id_idx ON order_items (product_id);
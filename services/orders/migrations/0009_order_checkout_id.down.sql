@@ -0,0 +1,2 @@
+DROP INDEX orders_checkout_id_key;
+ALTER TABLE orders DROP COLUMN checkout_id;
@@ -0,0 +1,4 @@
+-- A cart checkout places at most one order, however often it retries
+ALTER TABLE orders ADD COLUMN checkout_id TEXT;
+
+CREATE UNIQUE INDEX orders_checkout_id_key ON orders (checkout_id) WHERE checkout_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE outbox_lease;
+DROP TABLE outbox_sequences;
+DROP TABLE outbox_events;
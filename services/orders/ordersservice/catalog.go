@@ -0,0 +1,85 @@
+package ordersservice
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+)
+
+// ordersAccount is who the orders service calls the catalog as. The catalog
+// only takes reservations from it.
+var ordersAccount = identity.Service("orders")
+
+// CatalogClient calls the catalog service directly as ordersAccount
+type CatalogClient struct {
+	baseURL  string
+	identity identity.Config
+	opts     []clients.Option
+}
+
+// NewCatalogClient returns a CatalogClient for the catalog service at
+// baseURL. cfg signs the assertions; without a secret only the plain
+// headers are sent, which the catalog trusts on a trusted network.
+func NewCatalogClient(baseURL string, cfg identity.Config, opts ...clients.Option) *CatalogClient {
+	return &CatalogClient{baseURL: baseURL, identity: cfg, opts: opts}
+}
+
+// client returns a catalog client whose requests carry a fresh assertion
+func (c *CatalogClient) client() (*catalogclient.Client, error) {
+	h := make(http.Header)
+	if err := c.identity.SetHeaders(h, ordersAccount, "catalog"); err != nil {
+		return nil, err
+	}
+	return catalogclient.New(c.baseURL, append([]clients.Option{clients.WithHeaders(h)}, c.opts...)...), nil
+}
+
+func (c *CatalogClient) Lookup(ctx context.Context, ids []string) ([]catalogclient.Product, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Lookup(ctx, ids)
+}
+
+func (c *CatalogClient) Coupon(ctx context.Context, code string) (*catalogclient.Coupon, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Coupon(ctx, code)
+}
+
+func (c *CatalogClient) Reserve(ctx context.Context, orderID string, items []catalogclient.ReservationItem) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Reserve(ctx, orderID, items)
+}
+
+func (c *CatalogClient) ConfirmReservation(ctx context.Context, orderID string, items []catalogclient.ReservationItem) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.ConfirmReservation(ctx, orderID, items)
+}
+
+func (c *CatalogClient) CommitReservation(ctx context.Context, orderID string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.CommitReservation(ctx, orderID)
+}
+
+func (c *CatalogClient) ReleaseReservation(ctx context.Context, orderID string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.ReleaseReservation(ctx, orderID)
+}
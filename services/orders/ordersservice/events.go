@@ -0,0 +1,33 @@
+package ordersservice
+
+import (
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+)
+
+// Events the stores append to the outbox along with the changes they
+// describe. A status change appends "order." followed by the new status,
+// e.g. "order.cancelled".
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderCancelled = "order." + string(StatusCancelled)
+
+	orderAggregate = "order"
+)
+
+// OrderStatusChanged is the payload of an order's status change events
+type OrderStatusChanged struct {
+	OrderID string `json:"order_id"`
+	UserID  string `json:"user_id"`
+	StatusChange
+}
+
+// orderCreated is the event for a new order, carrying the whole order
+func orderCreated(o *Order) (outbox.Event, error) {
+	return outbox.New(orderAggregate, o.ID, EventOrderCreated, o, o.CreatedAt)
+}
+
+// statusChanged is the event for the change of the user's order with id
+func statusChanged(id, userID string, change StatusChange) (outbox.Event, error) {
+	payload := OrderStatusChanged{OrderID: id, UserID: userID, StatusChange: change}
+	return outbox.New(orderAggregate, id, "order."+string(change.To), payload, change.At)
+}
@@ -0,0 +1,105 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+)
+
+// errCatalogUnavailable wraps failures to reach the catalog
+var errCatalogUnavailable = errors.New("catalog unavailable")
+
+// stockError is a reservation the catalog refused for lack of stock
+type stockError struct {
+	msg string
+}
+
+func (e *stockError) Error() string {
+	return e.msg
+}
+
+// reservationError turns the catalog's refusal for lack of stock into a
+// *stockError and anything else into errCatalogUnavailable
+func reservationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var cerr *clients.Error
+	if errors.As(err, &cerr) && cerr.Status == http.StatusConflict {
+		return &stockError{cerr.Detail}
+	}
+	return fmt.Errorf("%w: %v", errCatalogUnavailable, err)
+}
+
+func reservationItems(items []OrderItem) []catalogclient.ReservationItem {
+	reserved := make([]catalogclient.ReservationItem, len(items))
+	for i, item := range items {
+		reserved[i] = catalogclient.ReservationItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+	return reserved
+}
+
+// reserve holds stock for a new order. Until the order is paid the holds
+// expire on their own, so an abandoned order doesn't keep stock forever.
+func (s *Server) reserve(ctx context.Context, order *Order) error {
+	return reservationError(s.catalog.Reserve(ctx, order.ID, reservationItems(order.Items)))
+}
+
+// beforeTransition does the inventory work an order's move to status
+// depends on: paying for it keeps its holds until it ships or is cancelled
+func (s *Server) beforeTransition(ctx context.Context, order *Order, status OrderStatus) error {
+	if status != StatusPaid {
+		return nil
+	}
+	return reservationError(s.catalog.ConfirmReservation(ctx, order.ID, reservationItems(order.Items)))
+}
+
+// transitionFailed undoes beforeTransition for a move to status that didn't
+// happen. Holds confirmed for a payment that didn't go through would
+// outlast the order, so they are released if the order has been cancelled
+// in the meantime, or if it is still pending and no other change to it is
+// underway, which could be a payment that confirmed the same holds and is
+// about to succeed. Paying again places them again.
+func (s *Server) transitionFailed(ctx context.Context, orderID string, status OrderStatus) {
+	if status != StatusPaid {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	order, err := s.store.Get(ctx, orderID, anyOwner)
+	if err != nil {
+		logging.Printf(ctx, "Failed to look up order %s to release its holds: %v", orderID, err)
+		return
+	}
+	switch {
+	case order.Status == StatusCancelled:
+	case order.Status == StatusPending && !s.changing.others(orderID):
+	default:
+		return
+	}
+	if err := s.catalog.ReleaseReservation(ctx, orderID); err != nil {
+		logging.Printf(ctx, "Failed to release the holds of unpaid order %s: %v", orderID, err)
+	}
+}
+
+// afterTransition settles an order's holds once it has moved to status:
+// cancelling releases them and shipping takes the stock off hand. A failure
+// is logged rather than undoing the move; unconfirmed holds still expire.
+func (s *Server) afterTransition(ctx context.Context, orderID string, status OrderStatus) {
+	var err error
+	switch status {
+	case StatusCancelled:
+		err = s.catalog.ReleaseReservation(ctx, orderID)
+	case StatusShipped:
+		err = s.catalog.CommitReservation(ctx, orderID)
+	default:
+		return
+	}
+	if err != nil {
+		logging.Printf(ctx, "Failed to settle stock for order %s moving to %s: %v", orderID, status, err)
+	}
+}
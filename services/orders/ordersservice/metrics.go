@@ -0,0 +1,15 @@
+package ordersservice
+
+import "github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+
+var (
+	ordersCreated = metrics.NewCounter(
+		"orders_created_total",
+		"Orders created.",
+	)
+	orderStatusChanges = metrics.NewCounterVec(
+		"orders_status_changes_total",
+		"Order status changes, by new status.",
+		"status",
+	)
+)
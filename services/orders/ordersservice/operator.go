@@ -0,0 +1,154 @@
+package ordersservice
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+)
+
+// Note is an internal remark staff keep on an order. Customers never see
+// notes.
+type Note struct {
+	// Author is the user ID of the operator who wrote the note
+	Author string    `json:"author" bson:"author"`
+	Text   string    `json:"text" bson:"text"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// handleOperatorGetOrders lists every customer's orders, with the customer
+// filters plus user_id and product_id
+func (s *Server) handleOperatorGetOrders(c *gin.Context) {
+	filter, err := listFilter(c)
+	if err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.UserID = c.Query("user_id"); filter.UserID != "" {
+		if err := ids.Validate(ids.User, filter.UserID); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, "invalid user_id")
+			return
+		}
+	}
+	if filter.ProductID = c.Query("product_id"); filter.ProductID != "" {
+		if err := ids.Validate(ids.Product, filter.ProductID); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "operatorListOrders")
+	defer cancel()
+
+	page, err := s.store.List(ctx, filter)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Server) handleOperatorGetOrder(c *gin.Context) {
+	s.serveOrder(c, "operatorGetOrder", anyOwner)
+}
+
+func (s *Server) handleOperatorGetOrderHistory(c *gin.Context) {
+	s.serveHistory(c, "operatorGetOrderHistory", anyOwner)
+}
+
+// handleUpdateOrderStatus moves any customer's order along its lifecycle,
+// recording the operator as the actor
+func (s *Server) handleUpdateOrderStatus(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	var update struct {
+		Status OrderStatus `json:"status" binding:"required"`
+		Reason string      `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !isValidStatus(update.Status) {
+		apierror.Gin(c, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "updateOrderStatus")
+	defer cancel()
+
+	change := StatusChange{To: update.Status, Actor: getUserID(c), Reason: update.Reason}
+	if err := s.transition(ctx, id, anyOwner, change); err != nil {
+		transitionFailed(c, err, "failed to update order")
+		return
+	}
+
+	orderStatusChanges.WithLabelValues(string(update.Status)).Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "order status updated successfully"})
+}
+
+func (s *Server) handleGetOrderNotes(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "getOrderNotes")
+	defer cancel()
+
+	notes, err := s.store.Notes(ctx, id)
+	if errors.Is(err, ErrOrderNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "order not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch order notes")
+		return
+	}
+	if notes == nil {
+		notes = []Note{}
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+func (s *Server) handleAddOrderNote(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	var req struct {
+		Text string `json:"text" binding:"required,max=2000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "addOrderNote")
+	defer cancel()
+
+	note := Note{Author: getUserID(c), Text: req.Text, At: time.Now()}
+	err := s.store.AddNote(ctx, id, note)
+	if errors.Is(err, ErrOrderNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "order not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to add order note")
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
@@ -0,0 +1,519 @@
+// Package ordersservice is the orders API. The orders binary wires it to a
+// database; testcluster runs it in-process on an in-memory store.
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+type OrderStatus string
+
+const (
+	StatusPending   OrderStatus = "pending"
+	StatusPaid      OrderStatus = "paid"
+	StatusConfirmed OrderStatus = "confirmed"
+	StatusShipped   OrderStatus = "shipped"
+	StatusDelivered OrderStatus = "delivered"
+	StatusCancelled OrderStatus = "cancelled"
+)
+
+// Order is what a user has ordered. Amount is what it costs once Discount,
+// from the Coupon code if one was used, is taken off the items' total.
+type Order struct {
+	ID          string      `json:"id" bson:"_id"`
+	UserID      string      `json:"user_id" bson:"user_id"`
+	Amount      money.Money `json:"amount" bson:"amount"`
+	Discount    money.Money `json:"discount" bson:"discount"`
+	Coupon      string      `json:"coupon,omitempty" bson:"coupon,omitempty"`
+	Status      OrderStatus `json:"status" bson:"status"`
+	Items       []OrderItem `json:"items" bson:"items"`
+	CreatedAt   time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" bson:"updated_at"`
+	Description string      `json:"description" bson:"description"`
+	// CheckoutID is the cart checkout that placed the order, if any. A
+	// checkout places at most one order.
+	CheckoutID string `json:"checkout_id,omitempty" bson:"checkout_id,omitempty"`
+}
+
+// OrderItem is one line of an order. Name and UnitPrice are copied from the
+// catalog when the order is placed, so later catalog changes don't alter it.
+type OrderItem struct {
+	ProductID   string      `json:"product_id" bson:"product_id"`
+	Name        string      `json:"name" bson:"name"`
+	Quantity    int         `json:"quantity" bson:"quantity"`
+	UnitPrice   money.Money `json:"unit_price" bson:"unit_price"`
+	Description string      `json:"description" bson:"description"`
+}
+
+// Deps are what the orders service needs to serve requests
+type Deps struct {
+	Store OrderStore
+	// Identity verifies the assertions the gateway signs for each request
+	Identity identity.Config
+	// Health serves the probe endpoints. The store's readiness is added to
+	// it; nil means a Health with no other checks.
+	Health *health.Health
+	// Catalog prices the items of new orders and holds stock for them
+	Catalog Catalog
+	// Timeouts bound each operation by its operationId in openapi.yaml; the
+	// zero value allows 5s for everything
+	Timeouts deadline.Timeouts
+}
+
+// Server is the orders HTTP API
+type Server struct {
+	store    OrderStore
+	catalog  Catalog
+	timeouts deadline.Timeouts
+	router   *gin.Engine
+	// changing tracks the status changes underway, so one failing doesn't
+	// release holds another has just confirmed
+	changing inFlight
+}
+
+// NewServer registers the service's routes
+func NewServer(deps Deps) *Server {
+	checks := deps.Health
+	if checks == nil {
+		checks = health.New(2 * time.Second)
+	}
+	checks.SetBuild(buildinfo.Get())
+	s := &Server{store: deps.Store, catalog: deps.Catalog, timeouts: deps.Timeouts}
+	if s.store != nil {
+		checks.AddReadiness(health.Func("database", s.store.Ping))
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery(), requestid.Gin(), deadline.Gin(), tracing.Gin("orders"), logging.Gin(), metrics.Gin("orders"))
+	r.GET(metrics.Path, gin.WrapH(metrics.Handler()))
+	r.GET(buildinfo.Path, gin.WrapH(buildinfo.Handler()))
+
+	// Health check endpoints
+	for _, path := range health.Paths {
+		r.GET(path, gin.WrapH(checks))
+	}
+
+	// Order endpoints act on behalf of the user asserted by the gateway.
+	// Customers can place, view and cancel their own orders; everything
+	// else is for operators.
+	orders := r.Group("/orders", identity.Gin(deps.Identity, "orders"))
+	{
+		orders.GET("", s.handleGetOrders)
+		orders.POST("", s.handleCreateOrder)
+		orders.GET("/:id", s.handleGetOrder)
+		orders.GET("/:id/history", s.handleGetOrderHistory)
+		orders.POST("/:id/cancel", s.handleCancelOrder)
+	}
+
+	// Operator endpoints act on every customer's orders. The cart service
+	// may also read an order and change its status, to see its checkouts
+	// through.
+	operator := r.Group("/operator/orders", identity.Gin(deps.Identity, "orders"))
+	staff := identity.RequireRole(identity.RoleOperator)
+	staffOrCart := identity.RequireRoleOrService(identity.RoleOperator, "cart")
+	{
+		operator.GET("", staff, s.handleOperatorGetOrders)
+		operator.GET("/:id", staffOrCart, s.handleOperatorGetOrder)
+		operator.GET("/:id/history", staff, s.handleOperatorGetOrderHistory)
+		operator.PUT("/:id/status", staffOrCart, s.handleUpdateOrderStatus)
+		operator.GET("/:id/notes", staff, s.handleGetOrderNotes)
+		operator.POST("/:id/notes", staff, s.handleAddOrderNote)
+	}
+
+	s.router = r
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Routes lists the registered routes, for comparison with openapi.yaml
+func (s *Server) Routes() []openapi.Route {
+	return openapi.GinRoutes(s.router)
+}
+
+// getUserID returns the caller's user ID as established by identity.Gin
+func getUserID(c *gin.Context) string {
+	id, _ := identity.FromContext(c.Request.Context())
+	return id.UserID
+}
+
+// listFilter reads the listing filters from the query: page parameters,
+// status (repeated or comma-separated) and min_amount and max_amount in
+// currency, which defaults to money.DefaultCurrency. Its errors fit a 400.
+func listFilter(c *gin.Context) (OrderFilter, error) {
+	page, err := paginate.FromQuery(c.Request.URL.Query())
+	if err != nil {
+		return OrderFilter{}, err
+	}
+	filter := OrderFilter{Page: page}
+	for _, v := range c.QueryArray("status") {
+		for _, st := range strings.Split(v, ",") {
+			status := OrderStatus(strings.TrimSpace(st))
+			if _, ok := transitions[status]; !ok {
+				return OrderFilter{}, fmt.Errorf("unknown status %q", st)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	currency := c.DefaultQuery("currency", money.DefaultCurrency)
+	for _, bound := range []struct {
+		name string
+		dst  *money.Money
+	}{
+		{"min_amount", &filter.MinAmount},
+		{"max_amount", &filter.MaxAmount},
+	} {
+		if v := c.Query(bound.name); v != "" {
+			if *bound.dst, err = money.Parse(v, currency); err != nil {
+				return OrderFilter{}, fmt.Errorf("%s: %w", bound.name, err)
+			}
+		}
+	}
+	return filter, nil
+}
+
+func (s *Server) handleGetOrders(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == "" {
+		apierror.Gin(c, http.StatusBadRequest, "missing user ID")
+		return
+	}
+	filter, err := listFilter(c)
+	if err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.UserID = userID
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "listOrders")
+	defer cancel()
+
+	page, err := s.store.List(ctx, filter)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Server) handleGetOrder(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == "" {
+		apierror.Gin(c, http.StatusBadRequest, "missing user ID")
+		return
+	}
+	s.serveOrder(c, "getOrder", userID)
+}
+
+// serveOrder answers with the order in the id path parameter if it belongs
+// to userID, which may be anyOwner
+func (s *Server) serveOrder(c *gin.Context, operation, userID string) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), operation)
+	defer cancel()
+
+	order, err := s.store.Get(ctx, id, userID)
+	if errors.Is(err, ErrOrderNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "order not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch order")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (s *Server) handleGetOrderHistory(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == "" {
+		apierror.Gin(c, http.StatusBadRequest, "missing user ID")
+		return
+	}
+	s.serveHistory(c, "getOrderHistory", userID)
+}
+
+// serveHistory answers with the history of the order in the id path
+// parameter if it belongs to userID, which may be anyOwner
+func (s *Server) serveHistory(c *gin.Context, operation, userID string) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), operation)
+	defer cancel()
+
+	history, err := s.store.History(ctx, id, userID)
+	if errors.Is(err, ErrOrderNotFound) {
+		apierror.Gin(c, http.StatusNotFound, "order not found")
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to fetch order history")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+func (s *Server) handleCreateOrder(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == "" {
+		apierror.Gin(c, http.StatusBadRequest, "missing user ID")
+		return
+	}
+
+	var req struct {
+		Items       []LineItem `json:"items" binding:"required,min=1,dive"`
+		Coupon      string     `json:"coupon"`
+		Description string     `json:"description"`
+		CheckoutID  string     `json:"checkout_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.CheckoutID != "" {
+		if err := ids.Validate(ids.Checkout, req.CheckoutID); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, "invalid checkout_id")
+			return
+		}
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "createOrder")
+	defer cancel()
+
+	// A checkout retrying gets the order it already placed
+	if req.CheckoutID != "" {
+		existing, err := s.store.GetByCheckout(ctx, req.CheckoutID)
+		if err == nil {
+			s.placedByCheckout(c, existing, userID)
+			return
+		} else if !errors.Is(err, ErrOrderNotFound) {
+			apierror.Gin(c, http.StatusInternalServerError, "failed to fetch order")
+			return
+		}
+	}
+
+	// Prices come from the catalog, never from the client
+	items, err := s.priceItems(ctx, req.Items)
+	var perr *pricingError
+	if errors.As(err, &perr) {
+		apierror.Gin(c, http.StatusBadRequest, perr.Error())
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+
+	// Calculate total amount from items, less any coupon
+	subtotal, err := orderTotal(items)
+	if err != nil {
+		apierror.Gin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	discount, err := s.discount(ctx, req.Coupon, subtotal)
+	if errors.As(err, &perr) {
+		apierror.Gin(c, http.StatusBadRequest, perr.Error())
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+	total, err := subtotal.Sub(discount)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to apply coupon")
+		return
+	}
+
+	id, err := ids.New(ids.Order)
+	if err != nil {
+		apierror.Gin(c, http.StatusInternalServerError, "failed to generate order ID")
+		return
+	}
+	now := time.Now()
+	order := Order{
+		ID:          id,
+		UserID:      userID,
+		Amount:      total,
+		Discount:    discount,
+		Coupon:      strings.ToUpper(req.Coupon),
+		Status:      StatusPending,
+		Items:       items,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Description: req.Description,
+		CheckoutID:  req.CheckoutID,
+	}
+
+	// Hold the stock before the order exists, so there's never an order
+	// that can't be filled
+	var serr *stockError
+	if err := s.reserve(ctx, &order); errors.As(err, &serr) {
+		apierror.Gin(c, http.StatusConflict, serr.Error())
+		return
+	} else if err != nil {
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+		return
+	}
+
+	if err := s.store.Create(ctx, &order); err != nil {
+		if err := s.catalog.ReleaseReservation(context.WithoutCancel(ctx), order.ID); err != nil {
+			logging.Printf(ctx, "Failed to release stock for order %s: %v", order.ID, err)
+		}
+		if errors.Is(err, ErrCheckoutHasOrder) {
+			// A concurrent retry of the checkout placed it first
+			existing, err := s.store.GetByCheckout(ctx, req.CheckoutID)
+			if err == nil {
+				s.placedByCheckout(c, existing, userID)
+				return
+			}
+		}
+		apierror.Gin(c, http.StatusInternalServerError, "failed to create order")
+		return
+	}
+	ordersCreated.Inc()
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// placedByCheckout answers a create for a checkout that has already placed
+// order with that order, unless the checkout is another user's
+func (s *Server) placedByCheckout(c *gin.Context, order *Order, userID string) {
+	if order.UserID != userID {
+		apierror.Gin(c, http.StatusConflict, "checkout_id belongs to another user's order")
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func (s *Server) handleCancelOrder(c *gin.Context) {
+	id := c.Param("id")
+	if err := ids.Validate(ids.Order, id); err != nil {
+		apierror.Gin(c, http.StatusBadRequest, "invalid order ID")
+		return
+	}
+	userID := getUserID(c)
+	if userID == "" {
+		apierror.Gin(c, http.StatusBadRequest, "missing user ID")
+		return
+	}
+
+	// The body, and the reason in it, are optional
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			apierror.Gin(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := s.timeouts.Context(c.Request.Context(), "cancelOrder")
+	defer cancel()
+
+	change := StatusChange{To: StatusCancelled, Actor: userID, Reason: body.Reason}
+	if err := s.transition(ctx, id, userID, change); err != nil {
+		transitionFailed(c, err, "failed to cancel order")
+		return
+	}
+
+	orderStatusChanges.WithLabelValues(string(StatusCancelled)).Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "order cancelled successfully"})
+}
+
+// transitionProblem is the body of a rejected status change, listing the
+// statuses the order may move to instead
+type transitionProblem struct {
+	apierror.Problem
+	CurrentStatus OrderStatus   `json:"current_status"`
+	AllowedNext   []OrderStatus `json:"allowed_next"`
+}
+
+// transitionFailed answers a status change that s.transition refused
+func transitionFailed(c *gin.Context, err error, msg string) {
+	var terr *TransitionError
+	var serr *stockError
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		apierror.Gin(c, http.StatusNotFound, "order not found")
+	case errors.As(err, &terr):
+		allowed := terr.Allowed
+		if allowed == nil {
+			allowed = []OrderStatus{}
+		}
+		apierror.GinBody(c, http.StatusConflict, transitionProblem{
+			Problem:       apierror.New(c.Request.Context(), http.StatusConflict, terr.Error()),
+			CurrentStatus: terr.From,
+			AllowedNext:   allowed,
+		})
+	case errors.Is(err, ErrStatusChanged):
+		apierror.Gin(c, http.StatusConflict, "order status changed concurrently; retry")
+	case errors.As(err, &serr):
+		apierror.Gin(c, http.StatusConflict, serr.Error())
+	case errors.Is(err, errCatalogUnavailable):
+		apierror.Gin(c, http.StatusServiceUnavailable, "catalog unavailable")
+	default:
+		apierror.Gin(c, http.StatusInternalServerError, msg)
+	}
+}
+
+// orderTotal sums the line totals of items, which must all be priced in the
+// same currency
+func orderTotal(items []OrderItem) (money.Money, error) {
+	if len(items) == 0 {
+		return money.Money{}, errors.New("order must have at least one item")
+	}
+	total, err := money.Zero(items[0].UnitPrice.Currency())
+	if err != nil {
+		return money.Money{}, errors.New("unit_price is required")
+	}
+	for _, item := range items {
+		if item.UnitPrice.Currency() == "" {
+			return money.Money{}, errors.New("unit_price is required")
+		}
+		if item.UnitPrice.IsNegative() {
+			return money.Money{}, errors.New("unit_price must not be negative")
+		}
+		line, err := item.UnitPrice.Mul(int64(item.Quantity))
+		if err != nil {
+			return money.Money{}, err
+		}
+		if total, err = total.Add(line); errors.Is(err, money.ErrCurrencyMismatch) {
+			return money.Money{}, errors.New("all items must be priced in the same currency")
+		} else if err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,106 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+)
+
+// Catalog looks up the products and coupons being ordered and holds stock
+// for them. *CatalogClient implements it.
+type Catalog interface {
+	// Lookup returns the products with the given IDs, leaving out unknown ones
+	Lookup(ctx context.Context, ids []string) ([]catalogclient.Product, error)
+	Coupon(ctx context.Context, code string) (*catalogclient.Coupon, error)
+	Reserve(ctx context.Context, orderID string, items []catalogclient.ReservationItem) error
+	ConfirmReservation(ctx context.Context, orderID string, items []catalogclient.ReservationItem) error
+	CommitReservation(ctx context.Context, orderID string) error
+	ReleaseReservation(ctx context.Context, orderID string) error
+}
+
+// LineItem is a product and quantity in a create request. Prices come from
+// the catalog; any sent by the client are ignored.
+type LineItem struct {
+	ProductID   string `json:"product_id" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"required,min=1"`
+	Description string `json:"description"`
+}
+
+// pricingError is a line the catalog can't price, reported to the client
+type pricingError struct {
+	msg string
+}
+
+func (e *pricingError) Error() string {
+	return e.msg
+}
+
+// priceItems resolves each line against the catalog, snapshotting the
+// product's name and current price into the order. Unknown and inactive
+// products are rejected with a *pricingError.
+func (s *Server) priceItems(ctx context.Context, lines []LineItem) ([]OrderItem, error) {
+	productIDs := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if ids.Validate(ids.Product, line.ProductID) != nil {
+			return nil, &pricingError{fmt.Sprintf("unknown product %q", line.ProductID)}
+		}
+		productIDs = append(productIDs, line.ProductID)
+	}
+	products, err := s.catalog.Lookup(ctx, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("looking up products: %w", err)
+	}
+	byID := make(map[string]catalogclient.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	items := make([]OrderItem, len(lines))
+	for i, line := range lines {
+		p, ok := byID[line.ProductID]
+		if !ok {
+			return nil, &pricingError{fmt.Sprintf("unknown product %q", line.ProductID)}
+		}
+		if !p.Active {
+			return nil, &pricingError{fmt.Sprintf("product %q is no longer available", line.ProductID)}
+		}
+		items[i] = OrderItem{
+			ProductID:   p.ID,
+			Name:        p.Name,
+			Quantity:    line.Quantity,
+			UnitPrice:   p.Price,
+			Description: line.Description,
+		}
+	}
+	return items, nil
+}
+
+// discount returns what the coupon with code takes off subtotal, which is
+// nothing if code is empty. Unknown, expired and inapplicable coupons are
+// rejected with a *pricingError.
+func (s *Server) discount(ctx context.Context, code string, subtotal money.Money) (money.Money, error) {
+	if code == "" {
+		return money.Zero(subtotal.Currency())
+	}
+	coupon, err := s.catalog.Coupon(ctx, code)
+	if status := clients.StatusCode(err); status == http.StatusNotFound || status == http.StatusBadRequest {
+		return money.Money{}, &pricingError{fmt.Sprintf("unknown coupon %q", code)}
+	} else if err != nil {
+		return money.Money{}, fmt.Errorf("looking up coupon: %w", err)
+	}
+	if !coupon.Valid(time.Now()) {
+		return money.Money{}, &pricingError{fmt.Sprintf("coupon %q is no longer valid", code)}
+	}
+	discount, err := coupon.Discount(subtotal)
+	if errors.Is(err, catalogclient.ErrCouponCurrency) {
+		return money.Money{}, &pricingError{fmt.Sprintf("coupon %q can't be used for orders in %s", code, subtotal.Currency())}
+	}
+	return discount, err
+}
@@ -0,0 +1,185 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transitions is the order lifecycle: the statuses an order may move to from
+// each status. An order is confirmed only once it has been paid and shipped
+// only once confirmed; it can be cancelled until it ships. Delivered and
+// cancelled orders are final.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusPending:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: nil,
+	StatusCancelled: nil,
+}
+
+// customerTransitions are the moves customers may make on their own orders.
+// They can only cancel an order that hasn't been paid for; once money has
+// been taken, cancelling is for staff, who can refund it.
+var customerTransitions = map[OrderStatus][]OrderStatus{
+	StatusPending: {StatusCancelled},
+}
+
+// StatusChange is one entry in an order's history. The first entry records
+// the order's creation and has no From.
+type StatusChange struct {
+	From OrderStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To   OrderStatus `json:"to" bson:"to"`
+	// Actor is the user ID of whoever made the change
+	Actor  string    `json:"actor" bson:"actor"`
+	Reason string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// created is the history entry for a new order
+func created(o *Order) StatusChange {
+	return StatusChange{To: o.Status, Actor: o.UserID, At: o.CreatedAt}
+}
+
+// ErrStatusChanged is returned by OrderStore.UpdateStatus when the order is
+// no longer in the status the caller read
+var ErrStatusChanged = errors.New("order status changed concurrently")
+
+// TransitionError reports a status change the lifecycle doesn't allow
+type TransitionError struct {
+	From    OrderStatus
+	To      OrderStatus
+	Allowed []OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	allowed := "none"
+	if len(transitions[e.From]) == 0 {
+		allowed = "none, it is final"
+	}
+	if len(e.Allowed) > 0 {
+		names := make([]string, len(e.Allowed))
+		for i, s := range e.Allowed {
+			names[i] = string(s)
+		}
+		allowed = strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("cannot move order from %s to %s; allowed next states: %s", e.From, e.To, allowed)
+}
+
+// isValidStatus reports whether status is one of the OrderStatus constants
+func isValidStatus(status OrderStatus) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// NextStatuses returns the statuses an order in status may move to
+func NextStatuses(status OrderStatus) []OrderStatus {
+	return transitions[status]
+}
+
+// CheckTransition returns a *TransitionError unless an order may move from
+// one status to the other
+func CheckTransition(from, to OrderStatus) error {
+	return checkTransition(transitions, from, to)
+}
+
+// checkTransition is CheckTransition for the moves in lifecycle
+func checkTransition(lifecycle map[OrderStatus][]OrderStatus, from, to OrderStatus) error {
+	for _, next := range lifecycle[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to, Allowed: lifecycle[from]}
+}
+
+// maxTransitionAttempts bounds the retries when the status keeps changing
+// between reading the order and updating it
+const maxTransitionAttempts = 3
+
+// transition moves the owner's order to change.To and records change, with
+// From and At filled in, in its history. The order's stock holds are
+// confirmed once, before the change, and committed or released to match
+// after it. The change is applied with a compare-and-set on the status that
+// was checked, so two requests racing from the same status can't both
+// succeed; a lost race is retried against the new status. Holds confirmed
+// for a move that then fails are given up again. Owners other than anyOwner
+// are customers, held to customerTransitions.
+func (s *Server) transition(ctx context.Context, id, userID string, change StatusChange) (err error) {
+	lifecycle := transitions
+	if userID != anyOwner {
+		lifecycle = customerTransitions
+	}
+	defer s.changing.start(id)()
+	order, err := s.store.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(lifecycle, order.Status, change.To); err != nil {
+		return err
+	}
+	if err := s.beforeTransition(ctx, order, change.To); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.transitionFailed(ctx, id, change.To)
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		change.From = order.Status
+		change.At = time.Now()
+		err := s.store.UpdateStatus(ctx, id, userID, change)
+		if errors.Is(err, ErrStatusChanged) && attempt < maxTransitionAttempts {
+			if order, err = s.store.Get(ctx, id, userID); err != nil {
+				return err
+			}
+			if err := checkTransition(lifecycle, order.Status, change.To); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == nil {
+			s.afterTransition(ctx, id, change.To)
+		}
+		return err
+	}
+}
+
+// inFlight counts the status changes underway for each order in this
+// process
+type inFlight struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+// start records a change to the order beginning, returning a func to call
+// when it is over
+func (f *inFlight) start(orderID string) (done func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == nil {
+		f.n = make(map[string]int)
+	}
+	f.n[orderID]++
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.n[orderID]--; f.n[orderID] == 0 {
+			delete(f.n, orderID)
+		}
+	}
+}
+
+// others reports whether a change to the order is underway besides the
+// caller's own
+func (f *inFlight) others(orderID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.n[orderID] > 1
+}
@@ -0,0 +1,168 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/clients/catalogclient"
+)
+
+// fakeCatalog records the reservation calls made to it
+type fakeCatalog struct {
+	Catalog
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *fakeCatalog) record(call string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	return nil
+}
+
+func (c *fakeCatalog) ConfirmReservation(ctx context.Context, orderID string, items []catalogclient.ReservationItem) error {
+	return c.record("confirm " + orderID)
+}
+
+func (c *fakeCatalog) CommitReservation(ctx context.Context, orderID string) error {
+	return c.record("commit " + orderID)
+}
+
+func (c *fakeCatalog) ReleaseReservation(ctx context.Context, orderID string) error {
+	return c.record("release " + orderID)
+}
+
+// cancellingStore cancels an order just before any other status change is
+// applied to it, as a customer's cancel racing the change would
+type cancellingStore struct {
+	OrderStore
+}
+
+func (s cancellingStore) UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error {
+	if change.To != StatusCancelled {
+		cancel := StatusChange{From: change.From, To: StatusCancelled, Actor: "usr_alice", At: change.At}
+		if err := s.OrderStore.UpdateStatus(ctx, id, userID, cancel); err != nil {
+			return err
+		}
+	}
+	return s.OrderStore.UpdateStatus(ctx, id, userID, change)
+}
+
+// newTransitionServer returns a server on store, with one pending order
+// stored in it, and the catalog it reserves from
+func newTransitionServer(t *testing.T, store OrderStore) (*Server, *fakeCatalog, *Order) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	order := testOrder(t, "usr_alice")
+	if err := store.Create(context.Background(), order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	catalog := &fakeCatalog{}
+	return NewServer(Deps{Store: store, Catalog: catalog}), catalog, order
+}
+
+func TestPayingConfirmsHolds(t *testing.T) {
+	s, catalog, order := newTransitionServer(t, NewMemoryStore())
+
+	if err := s.transition(context.Background(), order.ID, anyOwner, StatusChange{To: StatusPaid, Actor: "service:cart"}); err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+	if want := []string{"confirm " + order.ID}; !slices.Equal(catalog.calls, want) {
+		t.Errorf("catalog calls = %v, want %v", catalog.calls, want)
+	}
+}
+
+func TestFailedPaymentReleasesConfirmedHolds(t *testing.T) {
+	s, catalog, order := newTransitionServer(t, cancellingStore{NewMemoryStore()})
+
+	err := s.transition(context.Background(), order.ID, anyOwner, StatusChange{To: StatusPaid, Actor: "service:cart"})
+	var terr *TransitionError
+	if !errors.As(err, &terr) || terr.From != StatusCancelled {
+		t.Fatalf("transition: err = %v, want a move from cancelled refused", err)
+	}
+	// The holds confirmed for the payment mustn't outlast the cancelled order
+	if want := []string{"confirm " + order.ID, "release " + order.ID}; !slices.Equal(catalog.calls, want) {
+		t.Errorf("catalog calls = %v, want %v", catalog.calls, want)
+	}
+}
+
+func TestCustomersCancelOnlyUnpaidOrders(t *testing.T) {
+	ctx := context.Background()
+	s, catalog, order := newTransitionServer(t, NewMemoryStore())
+	if err := s.transition(ctx, order.ID, anyOwner, StatusChange{To: StatusPaid, Actor: "service:cart"}); err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	err := s.transition(ctx, order.ID, "usr_alice", StatusChange{To: StatusCancelled, Actor: "usr_alice"})
+	var terr *TransitionError
+	if !errors.As(err, &terr) || terr.From != StatusPaid {
+		t.Fatalf("cancel paid order: err = %v, want a move from paid refused", err)
+	}
+	if want := []string{"confirm " + order.ID}; !slices.Equal(catalog.calls, want) {
+		t.Errorf("catalog calls = %v, want the paid order's stock kept", catalog.calls)
+	}
+
+	pending := testOrder(t, "usr_alice")
+	if err := s.store.Create(ctx, pending); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.transition(ctx, pending.ID, "usr_alice", StatusChange{To: StatusCancelled, Actor: "usr_alice"}); err != nil {
+		t.Errorf("cancel pending order: %v", err)
+	}
+}
+
+// flakyStore fails status updates with err, without applying them, until it
+// has failed fails times
+type flakyStore struct {
+	OrderStore
+	err   error
+	fails int
+}
+
+func (s *flakyStore) UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error {
+	if s.fails > 0 {
+		s.fails--
+		return s.err
+	}
+	return s.OrderStore.UpdateStatus(ctx, id, userID, change)
+}
+
+func TestRetriedPaymentConfirmsHoldsOnce(t *testing.T) {
+	store := &flakyStore{OrderStore: NewMemoryStore(), err: ErrStatusChanged, fails: maxTransitionAttempts - 1}
+	s, catalog, order := newTransitionServer(t, store)
+
+	if err := s.transition(context.Background(), order.ID, anyOwner, StatusChange{To: StatusPaid, Actor: "service:cart"}); err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+	if want := []string{"confirm " + order.ID}; !slices.Equal(catalog.calls, want) {
+		t.Errorf("catalog calls = %v, want %v", catalog.calls, want)
+	}
+}
+
+func TestFailedPaymentKeepsHoldsOfOneUnderway(t *testing.T) {
+	for _, underway := range []bool{false, true} {
+		store := &flakyStore{OrderStore: NewMemoryStore(), err: errors.New("database unavailable"), fails: 1}
+		s, catalog, order := newTransitionServer(t, store)
+		if underway {
+			// Another payment of the order has confirmed its holds and is
+			// about to record the change
+			defer s.changing.start(order.ID)()
+		}
+
+		if err := s.transition(context.Background(), order.ID, anyOwner, StatusChange{To: StatusPaid, Actor: "service:cart"}); err == nil {
+			t.Fatal("transition succeeded despite the store failing")
+		}
+		want := []string{"confirm " + order.ID, "release " + order.ID}
+		if underway {
+			want = want[:1]
+		}
+		if !slices.Equal(catalog.calls, want) {
+			t.Errorf("another change underway %v: catalog calls = %v, want %v", underway, catalog.calls, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ordersservice
+
+import (
+	"cmp"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrOrderNotFound is returned when no order matches the given ID and
+	// owner
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrCheckoutHasOrder is returned by OrderStore.Create when the order's
+	// checkout has already placed one
+	ErrCheckoutHasOrder = errors.New("checkout already has an order")
+)
+
+// anyOwner, passed as the owner to OrderStore, matches orders of every
+// user. Only the operator routes pass it.
+const anyOwner = ""
+
+// OrderFilter narrows the orders returned by OrderStore.List
+type OrderFilter struct {
+	// UserID is the owner whose orders are listed, or anyOwner
+	UserID string
+	// ProductID, if set, lists only orders with an item of the product
+	ProductID string
+	// Statuses, if any, are the only ones listed
+	Statuses []OrderStatus
+	// MinAmount and MaxAmount, if set, bound the amount inclusively and
+	// leave out orders in other currencies
+	MinAmount money.Money
+	MaxAmount money.Money
+	Page      paginate.Params
+}
+
+// currency returns the currency the amount bounds are in, if any
+func (f OrderFilter) currency() string {
+	return cmp.Or(f.MinAmount.Currency(), f.MaxAmount.Currency())
+}
+
+// orderKey is an order's position in listings
+func orderKey(o Order) paginate.Key {
+	return paginate.Key{CreatedAt: o.CreatedAt, ID: o.ID}
+}
+
+// OrderStore is the persistence boundary for orders. Implementations must
+// scope every lookup by owner so one user can't touch another's orders,
+// unless the owner given is anyOwner.
+type OrderStore interface {
+	List(ctx context.Context, filter OrderFilter) (paginate.Page[Order], error)
+	Get(ctx context.Context, id, userID string) (*Order, error)
+	// GetByCheckout returns the order placed by the checkout with
+	// checkoutID, whoever owns it
+	GetByCheckout(ctx context.Context, checkoutID string) (*Order, error)
+	// Create stores a new order, starting its history with its creation by
+	// the owner, and appends an EventOrderCreated to the outbox. It returns
+	// ErrCheckoutHasOrder if the order's checkout has already placed one.
+	Create(ctx context.Context, order *Order) error
+	// UpdateStatus moves the order from change.From to change.To in a single
+	// compare-and-set, appends change to its history and its event to the
+	// outbox. It returns ErrOrderNotFound if the owner has no such order and
+	// ErrStatusChanged if its status is no longer change.From.
+	UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error
+	// History returns the order's status changes, oldest first
+	History(ctx context.Context, id, userID string) ([]StatusChange, error)
+	// AddNote appends an internal note to the order, returning
+	// ErrOrderNotFound if there is no such order
+	AddNote(ctx context.Context, id string, note Note) error
+	// Notes returns the order's internal notes, oldest first
+	Notes(ctx context.Context, id string) ([]Note, error)
+	// Outbox returns the outbox the store appends events to, for a relay to
+	// publish from
+	Outbox() outbox.Store
+	Ping(ctx context.Context) error
+	// Close releases the connection to the database
+	Close(ctx context.Context) error
+}
+
+// NewMongoStore stores orders in coll and their events in the outbox of
+// coll's database
+func NewMongoStore(coll *mongo.Collection) OrderStore {
+	return &mongoOrderStore{coll: coll, events: outbox.NewMongo(coll.Database())}
+}
+
+// NewPostgresStore stores orders in the orders and order_items tables and
+// their events in the outbox tables
+func NewPostgresStore(pool *pgxpool.Pool) OrderStore {
+	return &postgresOrderStore{pool: pool, events: outbox.NewPostgres(pool)}
+}
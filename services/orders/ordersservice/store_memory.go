@@ -0,0 +1,170 @@
+package ordersservice
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+// memoryOrderStore keeps orders in a map, for tests and local runs without
+// a database
+type memoryOrderStore struct {
+	mu      sync.Mutex
+	orders  map[string]Order
+	history map[string][]StatusChange
+	notes   map[string][]Note
+	events  *outbox.Memory
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() OrderStore {
+	return &memoryOrderStore{
+		orders:  make(map[string]Order),
+		history: make(map[string][]StatusChange),
+		notes:   make(map[string][]Note),
+		events:  outbox.NewMemory(),
+	}
+}
+
+func (s *memoryOrderStore) List(ctx context.Context, filter OrderFilter) (paginate.Page[Order], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []Order
+	for _, o := range s.orders {
+		if !owns(o, filter.UserID) ||
+			filter.ProductID != "" && !hasProduct(o, filter.ProductID) ||
+			len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, o.Status) ||
+			filter.currency() != "" && o.Amount.Currency() != filter.currency() ||
+			filter.MinAmount.Currency() != "" && o.Amount.Minor() < filter.MinAmount.Minor() ||
+			filter.MaxAmount.Currency() != "" && o.Amount.Minor() > filter.MaxAmount.Minor() {
+			continue
+		}
+		orders = append(orders, copyOrder(o))
+	}
+	return paginate.Slice(orders, filter.Page, orderKey), nil
+}
+
+func (s *memoryOrderStore) Get(ctx context.Context, id, userID string) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok || !owns(o, userID) {
+		return nil, ErrOrderNotFound
+	}
+	o = copyOrder(o)
+	return &o, nil
+}
+
+func (s *memoryOrderStore) GetByCheckout(ctx context.Context, checkoutID string) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.orders {
+		if o.CheckoutID == checkoutID {
+			o = copyOrder(o)
+			return &o, nil
+		}
+	}
+	return nil, ErrOrderNotFound
+}
+
+func (s *memoryOrderStore) Create(ctx context.Context, order *Order) error {
+	event, err := orderCreated(order)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if order.CheckoutID != "" {
+		for _, o := range s.orders {
+			if o.CheckoutID == order.CheckoutID {
+				return ErrCheckoutHasOrder
+			}
+		}
+	}
+	s.orders[order.ID] = copyOrder(*order)
+	s.history[order.ID] = []StatusChange{created(order)}
+	return s.events.Append(ctx, event)
+}
+
+func (s *memoryOrderStore) UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok || !owns(o, userID) {
+		return ErrOrderNotFound
+	}
+	if o.Status != change.From {
+		return ErrStatusChanged
+	}
+	event, err := statusChanged(id, o.UserID, change)
+	if err != nil {
+		return err
+	}
+	o.Status = change.To
+	o.UpdatedAt = change.At
+	s.orders[id] = o
+	s.history[id] = append(s.history[id], change)
+	return s.events.Append(ctx, event)
+}
+
+func (s *memoryOrderStore) History(ctx context.Context, id, userID string) ([]StatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok || !owns(o, userID) {
+		return nil, ErrOrderNotFound
+	}
+	return slices.Clone(s.history[id]), nil
+}
+
+func (s *memoryOrderStore) AddNote(ctx context.Context, id string, note Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[id]; !ok {
+		return ErrOrderNotFound
+	}
+	s.notes[id] = append(s.notes[id], note)
+	return nil
+}
+
+func (s *memoryOrderStore) Notes(ctx context.Context, id string) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[id]; !ok {
+		return nil, ErrOrderNotFound
+	}
+	return slices.Clone(s.notes[id]), nil
+}
+
+func (s *memoryOrderStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *memoryOrderStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryOrderStore) Close(ctx context.Context) error {
+	return nil
+}
+
+// owns reports whether o belongs to userID, which may be anyOwner
+func owns(o Order, userID string) bool {
+	return userID == anyOwner || o.UserID == userID
+}
+
+// hasProduct reports whether o has an item of the product
+func hasProduct(o Order, productID string) bool {
+	return slices.ContainsFunc(o.Items, func(item OrderItem) bool {
+		return item.ProductID == productID
+	})
+}
+
+// copyOrder stops callers from sharing the items slice with the store
+func copyOrder(o Order) Order {
+	o.Items = slices.Clone(o.Items)
+	return o
+}
@@ -0,0 +1,202 @@
+package ordersservice
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOrderStore struct {
+	coll   *mongo.Collection
+	events *outbox.Mongo
+}
+
+// mongoOrder is an order as stored, with its history embedded so a status
+// change and its history entry are written in one atomic update. Internal
+// notes are embedded alongside.
+type mongoOrder struct {
+	*Order  `bson:",inline"`
+	History []StatusChange `bson:"history"`
+	Notes   []Note         `bson:"notes"`
+}
+
+// orderOnly leaves the history and notes out of order lookups
+var orderOnly = bson.M{"history": 0, "notes": 0}
+
+// orderFields are where orders keep their listing key
+var orderFields = paginate.Fields{CreatedAt: "created_at", ID: "_id"}
+
+func (s *mongoOrderStore) List(ctx context.Context, filter OrderFilter) (paginate.Page[Order], error) {
+	query := bson.D{}
+	if filter.UserID != anyOwner {
+		query = append(query, bson.E{Key: "user_id", Value: filter.UserID})
+	}
+	if filter.ProductID != "" {
+		query = append(query, bson.E{Key: "items.product_id", Value: filter.ProductID})
+	}
+	if len(filter.Statuses) > 0 {
+		query = append(query, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: filter.Statuses}}})
+	}
+	if cur := filter.currency(); cur != "" {
+		query = append(query, bson.E{Key: "amount.currency", Value: cur})
+		amount := bson.D{}
+		if filter.MinAmount.Currency() != "" {
+			amount = append(amount, bson.E{Key: "$gte", Value: filter.MinAmount.Minor()})
+		}
+		if filter.MaxAmount.Currency() != "" {
+			amount = append(amount, bson.E{Key: "$lte", Value: filter.MaxAmount.Minor()})
+		}
+		query = append(query, bson.E{Key: "amount.minor", Value: amount})
+	}
+	return paginate.MongoFind(ctx, s.coll, query, filter.Page, orderFields, orderKey,
+		options.Find().SetProjection(orderOnly))
+}
+
+func (s *mongoOrderStore) Get(ctx context.Context, id, userID string) (*Order, error) {
+	var order Order
+	err := s.coll.FindOne(ctx, owned(id, userID), options.FindOne().SetProjection(orderOnly)).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *mongoOrderStore) GetByCheckout(ctx context.Context, checkoutID string) (*Order, error) {
+	var order Order
+	err := s.coll.FindOne(ctx, bson.M{"checkout_id": checkoutID}, options.FindOne().SetProjection(orderOnly)).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *mongoOrderStore) Create(ctx context.Context, order *Order) error {
+	event, err := orderCreated(order)
+	if err != nil {
+		return err
+	}
+	return s.events.Transact(ctx, func(ctx context.Context) error {
+		_, err := s.coll.InsertOne(ctx, mongoOrder{
+			Order:   order,
+			History: []StatusChange{created(order)},
+			// An empty array rather than null, which $push can't append to
+			Notes: []Note{},
+		})
+		if mongo.IsDuplicateKeyError(err) && order.CheckoutID != "" {
+			// The unique index on checkout_id
+			return ErrCheckoutHasOrder
+		} else if err != nil {
+			return err
+		}
+		return s.events.Append(ctx, event)
+	})
+}
+
+func (s *mongoOrderStore) UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error {
+	return s.events.Transact(ctx, func(ctx context.Context) error {
+		// Matching on the current status makes the update a compare-and-set
+		filter := owned(id, userID)
+		filter["status"] = change.From
+		var updated struct {
+			UserID string `bson:"user_id"`
+		}
+		err := s.coll.FindOneAndUpdate(
+			ctx,
+			filter,
+			bson.M{
+				"$set": bson.M{
+					"status":     change.To,
+					"updated_at": change.At,
+				},
+				"$push": bson.M{"history": change},
+			},
+			options.FindOneAndUpdate().SetProjection(bson.M{"user_id": 1}),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			// Tell a missing order apart from one whose status moved on
+			n, err := s.coll.CountDocuments(ctx, owned(id, userID), options.Count().SetLimit(1))
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrOrderNotFound
+			}
+			return ErrStatusChanged
+		} else if err != nil {
+			return err
+		}
+		event, err := statusChanged(id, updated.UserID, change)
+		if err != nil {
+			return err
+		}
+		return s.events.Append(ctx, event)
+	})
+}
+
+func (s *mongoOrderStore) History(ctx context.Context, id, userID string) ([]StatusChange, error) {
+	var doc struct {
+		History []StatusChange `bson:"history"`
+	}
+	err := s.coll.FindOne(ctx, owned(id, userID), options.FindOne().SetProjection(bson.M{"history": 1})).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return doc.History, nil
+}
+
+func (s *mongoOrderStore) AddNote(ctx context.Context, id string, note Note) error {
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$push": bson.M{"notes": note}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+func (s *mongoOrderStore) Notes(ctx context.Context, id string) ([]Note, error) {
+	var doc struct {
+		Notes []Note `bson:"notes"`
+	}
+	err := s.coll.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"notes": 1})).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return doc.Notes, nil
+}
+
+// owned matches the order with id if it belongs to userID, which may be
+// anyOwner
+func owned(id, userID string) bson.M {
+	filter := bson.M{"_id": id}
+	if userID != anyOwner {
+		filter["user_id"] = userID
+	}
+	return filter
+}
+
+func (s *mongoOrderStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *mongoOrderStore) Ping(ctx context.Context) error {
+	return s.coll.Database().Client().Ping(ctx, nil)
+}
+
+func (s *mongoOrderStore) Close(ctx context.Context) error {
+	return s.coll.Database().Client().Disconnect(ctx)
+}
@@ -0,0 +1,328 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+type postgresOrderStore struct {
+	pool   *pgxpool.Pool
+	events *outbox.Postgres
+}
+
+// uniqueViolation is the SQLSTATE Postgres reports for a duplicate key
+const uniqueViolation = "23505"
+
+// orderColumns are where orders keep their listing key
+var orderColumns = paginate.Fields{CreatedAt: "created_at", ID: "id"}
+
+func (s *postgresOrderStore) List(ctx context.Context, filter OrderFilter) (paginate.Page[Order], error) {
+	statuses := make([]string, len(filter.Statuses))
+	for i, st := range filter.Statuses {
+		statuses[i] = string(st)
+	}
+	var minAmount, maxAmount *int64
+	if filter.MinAmount.Currency() != "" {
+		v := filter.MinAmount.Minor()
+		minAmount = &v
+	}
+	if filter.MaxAmount.Currency() != "" {
+		v := filter.MaxAmount.Minor()
+		maxAmount = &v
+	}
+	where := `($1 = '' OR user_id = $1)
+		AND (cardinality($2::text[]) = 0 OR status = ANY($2))
+		AND ($3 = '' OR currency = $3)
+		AND ($4::bigint IS NULL OR amount_minor >= $4)
+		AND ($5::bigint IS NULL OR amount_minor <= $5)
+		AND ($6 = '' OR EXISTS (SELECT 1 FROM order_items i WHERE i.order_id = orders.id AND i.product_id = $6))`
+	args := []any{filter.UserID, statuses, filter.currency(), minAmount, maxAmount, filter.ProductID}
+
+	var page paginate.Page[Order]
+	paged, pagedArgs := filter.Page.SQLWhere(orderColumns, args)
+	rows, err := s.pool.Query(ctx, `SELECT id, user_id, amount_minor, discount_minor, currency, coupon, status, description, checkout_id, created_at, updated_at
+		FROM orders
+		WHERE `+where+` AND `+paged+`
+		`+filter.Page.SQLOrder(orderColumns), pagedArgs...)
+	if err != nil {
+		return page, err
+	}
+	orders, err := pgx.CollectRows(rows, scanOrder)
+	if err != nil {
+		return page, err
+	}
+	if err := s.loadItems(ctx, orders); err != nil {
+		return page, err
+	}
+	page = paginate.NewPage(orders, filter.Page, orderKey)
+
+	if filter.Page.Total {
+		ranged, rangedArgs := filter.Page.Unpaged().SQLWhere(orderColumns, args)
+		var total int64
+		err := s.pool.QueryRow(ctx, `SELECT count(*) FROM orders WHERE `+where+` AND `+ranged, rangedArgs...).Scan(&total)
+		if err != nil {
+			return page, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+func (s *postgresOrderStore) Get(ctx context.Context, id, userID string) (*Order, error) {
+	return s.getOne(ctx, `WHERE id = $1 AND ($2 = '' OR user_id = $2)`, id, userID)
+}
+
+func (s *postgresOrderStore) GetByCheckout(ctx context.Context, checkoutID string) (*Order, error) {
+	return s.getOne(ctx, `WHERE checkout_id = $1`, checkoutID)
+}
+
+// getOne returns the order matching where, with its items
+func (s *postgresOrderStore) getOne(ctx context.Context, where string, args ...any) (*Order, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id, user_id, amount_minor, discount_minor, currency, coupon, status, description, checkout_id, created_at, updated_at
+		FROM orders
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	order, err := pgx.CollectOneRow(rows, scanOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	orders := []Order{order}
+	if err := s.loadItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	return &orders[0], nil
+}
+
+func (s *postgresOrderStore) Create(ctx context.Context, order *Order) error {
+	event, err := orderCreated(order)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		var checkoutID *string
+		if order.CheckoutID != "" {
+			checkoutID = &order.CheckoutID
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO orders
+			(id, user_id, amount_minor, discount_minor, currency, coupon, status, description, checkout_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			order.ID, order.UserID, order.Amount.Minor(), order.Discount.Minor(), order.Amount.Currency(),
+			order.Coupon, string(order.Status), order.Description, checkoutID, order.CreatedAt, order.UpdatedAt)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "orders_checkout_id_key" {
+			return ErrCheckoutHasOrder
+		} else if err != nil {
+			return err
+		}
+		if err := insertChange(ctx, tx, order.ID, created(order)); err != nil {
+			return err
+		}
+		for i, item := range order.Items {
+			_, err := tx.Exec(ctx, `INSERT INTO order_items
+				(order_id, position, product_id, name, quantity, unit_price_minor, description)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				order.ID, i, item.ProductID, item.Name, item.Quantity, item.UnitPrice.Minor(), item.Description)
+			if err != nil {
+				return err
+			}
+		}
+		return s.events.Append(ctx, tx, event)
+	})
+}
+
+func (s *postgresOrderStore) UpdateStatus(ctx context.Context, id, userID string, change StatusChange) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// Matching on the current status makes the update a compare-and-set
+		var owner string
+		err := tx.QueryRow(ctx, `UPDATE orders SET status = $4, updated_at = $5
+			WHERE id = $1 AND ($2 = '' OR user_id = $2) AND status = $3
+			RETURNING user_id`,
+			id, userID, string(change.From), string(change.To), change.At).Scan(&owner)
+		if err == nil {
+			if err := insertChange(ctx, tx, id, change); err != nil {
+				return err
+			}
+			event, err := statusChanged(id, owner, change)
+			if err != nil {
+				return err
+			}
+			return s.events.Append(ctx, tx, event)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		// Tell a missing order apart from one whose status moved on
+		var exists bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1 AND ($2 = '' OR user_id = $2))`,
+			id, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrOrderNotFound
+		}
+		return ErrStatusChanged
+	})
+}
+
+func (s *postgresOrderStore) History(ctx context.Context, id, userID string) ([]StatusChange, error) {
+	rows, err := s.pool.Query(ctx, `SELECT h.from_status, h.to_status, h.actor, h.reason, h.changed_at
+		FROM order_status_history h
+		JOIN orders o ON o.id = h.order_id
+		WHERE o.id = $1 AND ($2 = '' OR o.user_id = $2)
+		ORDER BY h.id`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StatusChange, error) {
+		var c StatusChange
+		var from *string
+		var to string
+		err := row.Scan(&from, &to, &c.Actor, &c.Reason, &c.At)
+		if from != nil {
+			c.From = OrderStatus(*from)
+		}
+		c.To = OrderStatus(to)
+		return c, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		// Every order has at least its creation in its history
+		return nil, ErrOrderNotFound
+	}
+	return history, nil
+}
+
+func (s *postgresOrderStore) AddNote(ctx context.Context, id string, note Note) error {
+	// Selecting the order makes a missing one insert nothing
+	tag, err := s.pool.Exec(ctx, `INSERT INTO order_notes (order_id, author, text, created_at)
+		SELECT id, $2, $3, $4 FROM orders WHERE id = $1`,
+		id, note.Author, note.Text, note.At)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+func (s *postgresOrderStore) Notes(ctx context.Context, id string) ([]Note, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+	rows, err := s.pool.Query(ctx, `SELECT author, text, created_at
+		FROM order_notes
+		WHERE order_id = $1
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Note, error) {
+		var n Note
+		err := row.Scan(&n.Author, &n.Text, &n.At)
+		return n, err
+	})
+}
+
+func (s *postgresOrderStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *postgresOrderStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *postgresOrderStore) Close(ctx context.Context) error {
+	s.pool.Close()
+	return nil
+}
+
+// insertChange appends change to the history of the order with id
+func insertChange(ctx context.Context, tx pgx.Tx, id string, change StatusChange) error {
+	var from *string
+	if change.From != "" {
+		f := string(change.From)
+		from = &f
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO order_status_history
+		(order_id, from_status, to_status, actor, reason, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, from, string(change.To), change.Actor, change.Reason, change.At)
+	return err
+}
+
+// loadItems fills in the Items of each order with a single query
+func (s *postgresOrderStore) loadItems(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]string, len(orders))
+	byID := make(map[string]*Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		byID[orders[i].ID] = &orders[i]
+		orders[i].Items = []OrderItem{}
+	}
+
+	rows, err := s.pool.Query(ctx, `SELECT order_id, product_id, name, quantity, unit_price_minor, description
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, position`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var orderID string
+		var unitPrice int64
+		var item OrderItem
+		if err := rows.Scan(&orderID, &item.ProductID, &item.Name, &item.Quantity, &unitPrice, &item.Description); err != nil {
+			return err
+		}
+		// Items are priced in their order's currency
+		order := byID[orderID]
+		if item.UnitPrice, err = money.New(unitPrice, order.Amount.Currency()); err != nil {
+			return err
+		}
+		order.Items = append(order.Items, item)
+	}
+	return rows.Err()
+}
+
+func scanOrder(row pgx.CollectableRow) (Order, error) {
+	var o Order
+	var status, currency string
+	var checkoutID *string
+	var amount, discount int64
+	err := row.Scan(&o.ID, &o.UserID, &amount, &discount, &currency, &o.Coupon, &status, &o.Description, &checkoutID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return o, err
+	}
+	if checkoutID != nil {
+		o.CheckoutID = *checkoutID
+	}
+	o.Status = OrderStatus(status)
+	if o.Amount, err = money.New(amount, currency); err != nil {
+		return o, err
+	}
+	o.Discount, err = money.New(discount, currency)
+	return o, err
+}
@@ -0,0 +1,226 @@
+package ordersservice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+// newPostgresStore returns a store on a freshly migrated schema, skipping
+// the test if no Postgres is configured
+func newPostgresStore(t *testing.T) OrderStore {
+	t.Helper()
+	return NewPostgresStore(dbtest.Postgres(t, os.DirFS("../migrations")))
+}
+
+// testOrder returns a pending order of two items for userID, not yet stored
+func testOrder(t *testing.T, userID string) *Order {
+	t.Helper()
+	id, err := ids.New(ids.Order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	productID, err := ids.New(ids.Product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	price, err := money.New(1250, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount, err := price.Mul(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discount, err := money.Zero("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Postgres keeps microseconds
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return &Order{
+		ID:          id,
+		UserID:      userID,
+		Amount:      amount,
+		Discount:    discount,
+		Status:      StatusPending,
+		Items:       []OrderItem{{ProductID: productID, Name: "Widget", Quantity: 2, UnitPrice: price}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Description: "test order",
+	}
+}
+
+// sameChange compares status changes, their times by instant since
+// Postgres returns them in the local zone
+func sameChange(a, b StatusChange) bool {
+	return a.From == b.From && a.To == b.To && a.Actor == b.Actor && a.Reason == b.Reason && a.At.Equal(b.At)
+}
+
+func TestPostgresStoreCreateGetList(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	order := testOrder(t, "usr_alice")
+	if err := store.Create(ctx, order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Create(ctx, testOrder(t, "usr_bob")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := store.Get(ctx, order.ID, "usr_alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Amount != order.Amount || got.Discount != order.Discount || got.Status != StatusPending || !got.CreatedAt.Equal(order.CreatedAt) {
+		t.Errorf("Get = %+v, want %+v", got, order)
+	}
+	if len(got.Items) != 1 || got.Items[0] != order.Items[0] {
+		t.Errorf("Get items = %+v, want %+v", got.Items, order.Items)
+	}
+	if _, err := store.Get(ctx, order.ID, "usr_bob"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Get by another user: err = %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.Get(ctx, order.ID, anyOwner); err != nil {
+		t.Errorf("Get by any owner: %v", err)
+	}
+
+	page, err := store.List(ctx, OrderFilter{UserID: "usr_alice", Page: paginate.Params{Limit: 10}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != order.ID {
+		t.Errorf("List by owner = %v, want only %s", page.Items, order.ID)
+	}
+	page, err = store.List(ctx, OrderFilter{UserID: anyOwner, Page: paginate.Params{Limit: 10, Total: true}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 2 || page.Total == nil || *page.Total != 2 {
+		t.Errorf("List of every order = %d items, total %v; want 2", len(page.Items), page.Total)
+	}
+
+	history, err := store.History(ctx, order.ID, "usr_alice")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 1 || history[0].To != StatusPending || history[0].Actor != "usr_alice" {
+		t.Errorf("History = %+v, want the order's creation", history)
+	}
+}
+
+func TestPostgresStoreCheckoutPlacesOneOrder(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	first := testOrder(t, "usr_alice")
+	first.CheckoutID = "chk_1"
+	if err := store.Create(ctx, first); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	second := testOrder(t, "usr_alice")
+	second.CheckoutID = "chk_1"
+	if err := store.Create(ctx, second); !errors.Is(err, ErrCheckoutHasOrder) {
+		t.Fatalf("Create for the same checkout: err = %v, want ErrCheckoutHasOrder", err)
+	}
+	// Orders without a checkout don't collide
+	for range 2 {
+		if err := store.Create(ctx, testOrder(t, "usr_alice")); err != nil {
+			t.Fatalf("Create without checkout: %v", err)
+		}
+	}
+
+	got, err := store.GetByCheckout(ctx, "chk_1")
+	if err != nil {
+		t.Fatalf("GetByCheckout: %v", err)
+	}
+	if got.ID != first.ID {
+		t.Errorf("GetByCheckout = %s, want %s", got.ID, first.ID)
+	}
+	if _, err := store.GetByCheckout(ctx, "chk_2"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("GetByCheckout of another checkout: err = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestPostgresStoreUpdateStatus(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	order := testOrder(t, "usr_alice")
+	if err := store.Create(ctx, order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	at := order.CreatedAt.Add(time.Second)
+	paid := StatusChange{From: StatusPending, To: StatusPaid, Actor: "usr_alice", At: at}
+	if err := store.UpdateStatus(ctx, order.ID, "usr_alice", paid); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	// The order is no longer pending, so the same change loses the race
+	if err := store.UpdateStatus(ctx, order.ID, "usr_alice", paid); !errors.Is(err, ErrStatusChanged) {
+		t.Errorf("UpdateStatus from a stale status: err = %v, want ErrStatusChanged", err)
+	}
+	confirmed := StatusChange{From: StatusPaid, To: StatusConfirmed, Actor: "usr_bob", At: at}
+	if err := store.UpdateStatus(ctx, order.ID, "usr_bob", confirmed); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("UpdateStatus by another user: err = %v, want ErrOrderNotFound", err)
+	}
+	if err := store.UpdateStatus(ctx, "ord_missing", anyOwner, confirmed); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("UpdateStatus of a missing order: err = %v, want ErrOrderNotFound", err)
+	}
+
+	got, err := store.Get(ctx, order.ID, "usr_alice")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != StatusPaid || !got.UpdatedAt.Equal(at) {
+		t.Errorf("order is %s updated at %v, want paid at %v", got.Status, got.UpdatedAt, at)
+	}
+	history, err := store.History(ctx, order.ID, anyOwner)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 2 || !sameChange(history[1], paid) {
+		t.Errorf("History = %+v, want creation then %+v", history, paid)
+	}
+
+	// One event for the creation and one for the change that went through
+	events, err := store.Outbox().Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != EventOrderCreated || events[1].Type != "order."+string(StatusPaid) || events[1].Sequence != 2 {
+		t.Errorf("outbox = %+v, want order.created then order.paid", events)
+	}
+}
+
+func TestPostgresStoreNotes(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	order := testOrder(t, "usr_alice")
+	if err := store.Create(ctx, order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	note := Note{Author: "usr_operator", Text: "called the customer", At: order.CreatedAt}
+	if err := store.AddNote(ctx, order.ID, note); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	if err := store.AddNote(ctx, "ord_missing", note); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("AddNote to a missing order: err = %v, want ErrOrderNotFound", err)
+	}
+	notes, err := store.Notes(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("Notes: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Author != note.Author || notes[0].Text != note.Text || !notes[0].At.Equal(note.At) {
+		t.Errorf("Notes = %+v, want [%+v]", notes, note)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/migrate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/services/payments/paymentsservice"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigrations evolve the payments database when PAYMENTS_STORE=mongo.
+// The Postgres schema lives in migrations/*.sql instead.
+var mongoMigrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "unique index on payment id",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("payments").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("payments").Indexes().DropOne(ctx, "id_1")
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "store amount and currency as money",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return rewritePayments(ctx, db, bson.M{"amount": bson.M{"$type": "number"}},
+				func(doc bson.Raw) (bson.M, error) {
+					currency, _ := doc.Lookup("currency").StringValueOK()
+					if currency == "" {
+						currency = money.DefaultCurrency
+					}
+					var amount float64
+					if f, ok := doc.Lookup("amount").DoubleOK(); ok {
+						amount = f
+					} else if n, ok := doc.Lookup("amount").AsInt64OK(); ok {
+						amount = float64(n)
+					}
+					m, err := money.FromFloat(amount, currency)
+					if err != nil {
+						return nil, err
+					}
+					return bson.M{"$set": bson.M{"amount": m}, "$unset": bson.M{"currency": ""}}, nil
+				})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return rewritePayments(ctx, db, bson.M{"amount": bson.M{"$type": "object"}},
+				func(doc bson.Raw) (bson.M, error) {
+					var p paymentsservice.Payment
+					if err := bson.Unmarshal(doc, &p); err != nil {
+						return nil, err
+					}
+					amount, err := strconv.ParseFloat(p.Amount.Decimal(), 64)
+					if err != nil {
+						return nil, err
+					}
+					return bson.M{"$set": bson.M{"amount": amount, "currency": p.Amount.Currency()}}, nil
+				})
+		},
+	},
+	{
+		Version:     3,
+		Description: "index payments by created_at and id for keyset pagination",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("payments").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "id", Value: -1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("payments").Indexes().DropOne(ctx, "created_at_-1_id_-1")
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "unique index on the order a payment pays for",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Partial, so payments without an order don't collide
+			_, err := db.Collection("payments").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "order_id", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"order_id": bson.M{"$type": "string"}}),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("payments").Indexes().DropOne(ctx, "order_id_1")
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "outbox of payment events, indexed by publication",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Transactions can't create collections on older servers
+			for _, name := range []string{"outbox", "outbox_sequences", "outbox_lease"} {
+				if err := db.CreateCollection(ctx, name); err != nil {
+					return err
+				}
+			}
+			_, err := db.Collection("outbox").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}},
+				{
+					Keys:    bson.D{{Key: "aggregate_type", Value: 1}, {Key: "aggregate_id", Value: 1}, {Key: "sequence", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"outbox", "outbox_sequences", "outbox_lease"} {
+				if err := db.Collection(name).Drop(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// rewritePayments applies the update built by convert to every payment
+// matching filter, in batches
+func rewritePayments(ctx context.Context, db *mongo.Database, filter bson.M, convert func(bson.Raw) (bson.M, error)) error {
+	coll := db.Collection("payments")
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		update, err := convert(cursor.Current)
+		if err != nil {
+			return fmt.Errorf("payment %v: %w", cursor.Current.Lookup("_id"), err)
+		}
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": cursor.Current.Lookup("_id")}).
+			SetUpdate(update))
+		if len(batch) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
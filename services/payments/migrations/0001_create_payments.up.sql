@@ -0,0 +1,10 @@
+CREATE TABLE payments (
+    id         TEXT PRIMARY KEY,
+    amount     NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+    currency   TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX payments_created_at_idx ON payments (created_at DESC);
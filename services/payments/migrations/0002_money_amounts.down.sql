@@ -0,0 +1,11 @@
+ALTER TABLE payments ADD COLUMN amount NUMERIC(18, 2);
+UPDATE payments SET amount = amount_minor / CASE
+    WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+                      'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1.0
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000.0
+    ELSE 100.0
+END;
+ALTER TABLE payments
+    ALTER COLUMN amount SET NOT NULL,
+    ADD CONSTRAINT payments_amount_check CHECK (amount > 0),
+    DROP COLUMN amount_minor;
@@ -0,0 +1,14 @@
+-- Amounts become integer minor units in the payment's currency
+ALTER TABLE payments ADD COLUMN amount_minor BIGINT;
+UPDATE payments SET
+    currency = upper(currency),
+    amount_minor = round(amount * CASE
+        WHEN upper(currency) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+                                 'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+        WHEN upper(currency) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+        ELSE 100
+    END);
+ALTER TABLE payments
+    ALTER COLUMN amount_minor SET NOT NULL,
+    ADD CONSTRAINT payments_amount_minor_check CHECK (amount_minor > 0),
+    DROP COLUMN amount;
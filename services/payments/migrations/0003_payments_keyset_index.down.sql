@@ -0,0 +1,2 @@
+CREATE INDEX payments_created_at_idx ON payments (created_at DESC);
+DROP INDEX payments_created_at_id_idx;
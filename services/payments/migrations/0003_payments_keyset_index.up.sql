@@ -0,0 +1,4 @@
+-- Listings page on (created_at, id); the id breaks ties between payments
+-- created in the same microsecond
+CREATE INDEX payments_created_at_id_idx ON payments (created_at DESC, id DESC);
+DROP INDEX payments_created_at_idx;
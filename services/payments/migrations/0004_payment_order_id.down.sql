@@ -0,0 +1,2 @@
+DROP INDEX payments_order_id_key;
+ALTER TABLE payments DROP COLUMN order_id;
@@ -0,0 +1,5 @@
+-- A payment pays for at most one order, and an order has at most one
+-- payment. Payments created before orders were linked have no order.
+ALTER TABLE payments ADD COLUMN order_id TEXT;
+
+CREATE UNIQUE INDEX payments_order_id_key ON payments (order_id) WHERE order_id IS NOT NULL;
@@ -0,0 +1,30 @@
+-- Domain events, written in the same transaction as the payment change they
+-- describe and published by the outbox relay
+CREATE TABLE outbox_events (
+    id             TEXT PRIMARY KEY,
+    type           TEXT NOT NULL,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id   TEXT NOT NULL,
+    sequence       BIGINT NOT NULL,
+    payload        JSONB NOT NULL,
+    occurred_at    TIMESTAMPTZ NOT NULL,
+    published_at   TIMESTAMPTZ,
+    UNIQUE (aggregate_type, aggregate_id, sequence)
+);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (occurred_at, id) WHERE published_at IS NULL;
+
+-- The last sequence number handed out per aggregate
+CREATE TABLE outbox_sequences (
+    aggregate_type TEXT NOT NULL,
+    aggregate_id   TEXT NOT NULL,
+    seq            BIGINT NOT NULL,
+    PRIMARY KEY (aggregate_type, aggregate_id)
+);
+
+-- Which relay may publish, until when
+CREATE TABLE outbox_lease (
+    id         TEXT PRIMARY KEY,
+    holder     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
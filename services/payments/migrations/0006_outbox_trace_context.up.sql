@@ -0,0 +1,3 @@
+-- The trace of the request that recorded each event, so the relay can pass
+-- it on to consumers
+ALTER TABLE outbox_events ADD COLUMN trace_context JSONB;
@@ -0,0 +1,44 @@
+package paymentsservice
+
+import (
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+)
+
+// Events the stores append to the outbox along with the changes they
+// describe. Each carries the payment as it was stored.
+const (
+	EventPaymentCreated   = "payment.created"
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventPaymentCancelled = "payment.cancelled"
+	EventPaymentRefunded  = "payment.refunded"
+
+	paymentAggregate = "payment"
+)
+
+// statusEvents are the events for a payment moving to each status
+var statusEvents = map[string]string{
+	StatusCompleted: EventPaymentSucceeded,
+	StatusFailed:    EventPaymentFailed,
+	StatusCancelled: EventPaymentCancelled,
+	StatusRefunded:  EventPaymentRefunded,
+}
+
+// paymentCreated is the event for a new payment
+func paymentCreated(p *Payment) (outbox.Event, error) {
+	return outbox.New(paymentAggregate, p.ID, EventPaymentCreated, p, p.CreatedAt)
+}
+
+// paymentUpdated returns the events for an update that moved p from the
+// status from: none unless its status changed
+func paymentUpdated(p *Payment, from string) ([]outbox.Event, error) {
+	typ, ok := statusEvents[p.Status]
+	if !ok || p.Status == from {
+		return nil, nil
+	}
+	e, err := outbox.New(paymentAggregate, p.ID, typ, p, p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return []outbox.Event{e}, nil
+}
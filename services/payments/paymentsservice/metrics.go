@@ -0,0 +1,9 @@
+package paymentsservice
+
+import "github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+
+var paymentsByStatus = metrics.NewCounterVec(
+	"payments_total",
+	"Payments created or updated, by resulting status.",
+	"status",
+)
@@ -0,0 +1,391 @@
+// Package paymentsservice is the payments API. The payments binary wires it
+// to a database; testcluster runs it in-process on an in-memory store.
+package paymentsservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/apierror"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/buildinfo"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/deadline"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/health"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/identity"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/logging"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/metrics"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/openapi"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/requestid"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/tracing"
+)
+
+// Payment statuses. A payment starts pending and is settled once: it
+// completes, fails or is cancelled. Only a completed payment can be
+// refunded.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+// transitions are the statuses a payment may move to from each status
+var transitions = map[string][]string{
+	StatusPending:   {StatusCompleted, StatusFailed, StatusCancelled},
+	StatusCompleted: {StatusRefunded},
+	StatusFailed:    nil,
+	StatusCancelled: nil,
+	StatusRefunded:  nil,
+}
+
+type Payment struct {
+	ID string `json:"id" bson:"id"`
+	// OrderID is the order the payment is for, if any. An order has at
+	// most one payment.
+	OrderID   string      `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	Amount    money.Money `json:"amount" bson:"amount"`
+	Status    string      `json:"status" bson:"status"`
+	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"`
+}
+
+// paymentRequest is the body of create and update requests. Older clients
+// send amount as a bare number with the currency alongside it, which is
+// still accepted.
+type paymentRequest struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+	Status   string          `json:"status"`
+	OrderID  string          `json:"order_id"`
+}
+
+// decodePayment reads a paymentRequest body into a Payment
+func decodePayment(r *http.Request) (Payment, error) {
+	var req paymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return Payment{}, err
+	}
+	p := Payment{Status: req.Status, OrderID: req.OrderID}
+	if len(req.Amount) == 0 {
+		return p, nil
+	}
+	currency := req.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	amount, err := money.DecodeJSON(req.Amount, currency)
+	if err != nil {
+		return Payment{}, err
+	}
+	p.Amount = amount
+	return p, nil
+}
+
+// Deps are what the payments service needs to serve requests
+type Deps struct {
+	Store PaymentStore
+	// Identity verifies the assertions the gateway signs for each request
+	Identity identity.Config
+	// Health serves the probe endpoints. The store's readiness is added to
+	// it; nil means a Health with no other checks.
+	Health *health.Health
+	// Timeouts bound each operation by its operationId in openapi.yaml; the
+	// zero value allows 5s for everything
+	Timeouts deadline.Timeouts
+}
+
+// Server is the payments HTTP API
+type Server struct {
+	store    PaymentStore
+	timeouts deadline.Timeouts
+	handler  http.Handler
+}
+
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes are the API endpoints. They are registered by NewServer and
+// compared with openapi.yaml by the speccheck subcommand.
+func (s *Server) routes() []route {
+	return []route{
+		{"GET /payments", s.getPayments},
+		{"POST /payments", s.createPayment},
+		{"GET /payments/{id}", s.getPayment},
+		{"PUT /payments/{id}", s.updatePayment},
+		{"DELETE /payments/{id}", s.deletePayment},
+	}
+}
+
+// NewServer registers the service's routes
+func NewServer(deps Deps) *Server {
+	checks := deps.Health
+	if checks == nil {
+		checks = health.New(2 * time.Second)
+	}
+	checks.SetBuild(buildinfo.Get())
+	s := &Server{store: deps.Store, timeouts: deps.Timeouts}
+	if s.store != nil {
+		checks.AddReadiness(health.Func("database", s.store.Ping))
+	}
+
+	mux := http.NewServeMux()
+	for _, path := range health.Paths {
+		mux.Handle(path, checks)
+	}
+	mux.Handle(metrics.Path, metrics.Handler())
+	mux.Handle(buildinfo.Path, buildinfo.Handler())
+
+	// Payment endpoints require an identity asserted by the gateway
+	for _, route := range s.routes() {
+		mux.Handle(route.pattern, identity.Middleware(deps.Identity, "payments", route.handler))
+	}
+	s.handler = requestid.Middleware(deadline.Middleware(tracing.Middleware("payments", metrics.Middleware("payments", mux))))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Routes lists the registered routes, for comparison with openapi.yaml
+func (s *Server) Routes() []openapi.Route {
+	var routes []openapi.Route
+	for _, route := range s.routes() {
+		routes = append(routes, openapi.MuxRoute(route.pattern))
+	}
+	return routes
+}
+
+func (s *Server) getPayments(w http.ResponseWriter, r *http.Request) {
+	page, err := paginate.FromQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := s.timeouts.Context(r.Context(), "listPayments")
+	defer cancel()
+	payments, err := s.store.List(ctx, page)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(payments); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// paymentIDFromPath extracts the payment ID from /payments/{id}, writing a
+// 400 response and returning false if it is malformed
+func paymentIDFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if err := ids.Validate(ids.Payment, id); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "invalid payment id")
+		return "", false
+	}
+	return id, true
+}
+
+func (s *Server) getPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := paymentIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := s.timeouts.Context(r.Context(), "getPayment")
+	defer cancel()
+	p, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrPaymentNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// createPayment creates a pending payment. Payments for an order are taken
+// by the cart service's checkouts or by operators. Creating a payment for
+// an order that already has one returns the existing payment, so a caller
+// can safely retry.
+func (s *Server) createPayment(w http.ResponseWriter, r *http.Request) {
+	p, err := decodePayment(r)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if !p.Amount.IsPositive() {
+		apierror.Write(w, r, http.StatusBadRequest, "amount and currency required")
+		return
+	}
+	if p.OrderID != "" {
+		if err := ids.Validate(ids.Order, p.OrderID); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, "invalid order_id")
+			return
+		}
+		if !requireOperator(w, r, true, "only operators can take an order's payment") {
+			return
+		}
+	}
+	id, err := ids.New(ids.Payment)
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "id generation error")
+		return
+	}
+	p.ID = id
+	p.Status = StatusPending
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	ctx, cancel := s.timeouts.Context(r.Context(), "createPayment")
+	defer cancel()
+	err = s.store.Create(ctx, &p)
+	if errors.Is(err, ErrOrderHasPayment) {
+		existing, err := s.store.GetByOrder(ctx, p.OrderID)
+		if err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, "db error")
+			return
+		}
+		if existing.Amount != p.Amount {
+			apierror.Write(w, r, http.StatusConflict, "order already has a payment of "+existing.Amount.String())
+			return
+		}
+		p = *existing
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	paymentsByStatus.WithLabelValues(p.Status).Inc()
+	logging.Printf(r.Context(), "Created payment: %+v", p)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// requireOperator writes a 403 response and returns false unless the
+// request's identity holds the operator role, or with cart is the cart
+// service's own, which takes its checkouts' payments
+func requireOperator(w http.ResponseWriter, r *http.Request, cart bool, msg string) bool {
+	id, _ := identity.FromContext(r.Context())
+	if !id.HasRole(identity.RoleOperator) && !(cart && id.IsService("cart")) {
+		apierror.Write(w, r, http.StatusForbidden, msg)
+		return false
+	}
+	return true
+}
+
+// updatePayment settles a payment or changes its amount, which only
+// operators and the cart service may do
+func (s *Server) updatePayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := paymentIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	if !requireOperator(w, r, true, "only operators can change a payment") {
+		return
+	}
+	p, err := decodePayment(r)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if !p.Amount.IsPositive() {
+		apierror.Write(w, r, http.StatusBadRequest, "amount and currency required")
+		return
+	}
+	if _, known := transitions[p.Status]; p.Status != "" && !known {
+		apierror.Write(w, r, http.StatusBadRequest, fmt.Sprintf("unknown status %q", p.Status))
+		return
+	}
+	ctx, cancel := s.timeouts.Context(r.Context(), "updatePayment")
+	defer cancel()
+	existing, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrPaymentNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	if p.Status == "" {
+		p.Status = existing.Status
+	}
+	if err := checkUpdate(existing, &p); err != nil {
+		apierror.Write(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	p.ID = id
+	p.UpdatedAt = time.Now()
+	err = s.store.Update(ctx, &p, existing.Status)
+	if errors.Is(err, ErrPaymentNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, "not found")
+		return
+	} else if errors.Is(err, ErrPaymentChanged) {
+		apierror.Write(w, r, http.StatusConflict, "payment status changed concurrently; retry")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	paymentsByStatus.WithLabelValues(p.Status).Inc()
+	logging.Printf(r.Context(), "Updated payment: %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkUpdate returns an error unless payment may be replaced by update:
+// the status must stay the same or move on along transitions, and only a
+// pending payment's amount can change
+func checkUpdate(payment *Payment, update *Payment) error {
+	if update.Status != payment.Status && !slices.Contains(transitions[payment.Status], update.Status) {
+		return fmt.Errorf("cannot move payment from %s to %s", payment.Status, update.Status)
+	}
+	if payment.Status != StatusPending && update.Amount != payment.Amount {
+		return fmt.Errorf("the amount of a %s payment can't change", payment.Status)
+	}
+	return nil
+}
+
+// deletePayment deletes a payment. A payment for an order can only be
+// deleted by an operator.
+func (s *Server) deletePayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := paymentIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := s.timeouts.Context(r.Context(), "deletePayment")
+	defer cancel()
+	existing, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrPaymentNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	if existing.OrderID != "" && !requireOperator(w, r, false, "only operators can delete an order's payment") {
+		return
+	}
+	err = s.store.Delete(ctx, id)
+	if errors.Is(err, ErrPaymentNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "db error")
+		return
+	}
+	logging.Printf(r.Context(), "Deleted payment: %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package paymentsservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrPaymentNotFound is returned when no payment has the given ID
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrOrderHasPayment is returned by PaymentStore.Create when the
+	// payment's order already has one
+	ErrOrderHasPayment = errors.New("order already has a payment")
+	// ErrPaymentChanged is returned by PaymentStore.Update when the payment
+	// is no longer in the status the caller read
+	ErrPaymentChanged = errors.New("payment status changed concurrently")
+)
+
+// paymentKey is a payment's position in listings
+func paymentKey(p Payment) paginate.Key {
+	return paginate.Key{CreatedAt: p.CreatedAt, ID: p.ID}
+}
+
+// PaymentStore is the persistence boundary for payments
+type PaymentStore interface {
+	// List returns one page of payments
+	List(ctx context.Context, page paginate.Params) (paginate.Page[Payment], error)
+	Get(ctx context.Context, id string) (*Payment, error)
+	// GetByOrder returns the payment for the order with orderID
+	GetByOrder(ctx context.Context, orderID string) (*Payment, error)
+	// Create stores a new payment and appends an EventPaymentCreated to the
+	// outbox, returning ErrOrderHasPayment if its order already has one
+	Create(ctx context.Context, p *Payment) error
+	// Update overwrites the amount, currency, status and updated_at of the
+	// payment with p.ID if its status is still from, and appends the event
+	// for a change of status to the outbox. It returns
+	// ErrPaymentNotFound if there is no such payment and ErrPaymentChanged if
+	// its status has moved on.
+	Update(ctx context.Context, p *Payment, from string) error
+	Delete(ctx context.Context, id string) error
+	// Outbox returns the outbox the store appends events to, for a relay to
+	// publish from
+	Outbox() outbox.Store
+	Ping(ctx context.Context) error
+	// Close releases the connection to the database
+	Close(ctx context.Context) error
+}
+
+// NewMongoStore stores payments in coll and their events in the outbox of
+// coll's database
+func NewMongoStore(coll *mongo.Collection) PaymentStore {
+	return &mongoPaymentStore{coll: coll, events: outbox.NewMongo(coll.Database())}
+}
+
+// NewPostgresStore stores payments in the payments table and their events
+// in the outbox tables
+func NewPostgresStore(pool *pgxpool.Pool) PaymentStore {
+	return &postgresPaymentStore{pool: pool, events: outbox.NewPostgres(pool)}
+}
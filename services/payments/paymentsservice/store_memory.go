@@ -0,0 +1,117 @@
+package paymentsservice
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+// memoryPaymentStore keeps payments in a map, for tests and local runs
+// without a database
+type memoryPaymentStore struct {
+	mu       sync.Mutex
+	payments map[string]Payment
+	events   *outbox.Memory
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() PaymentStore {
+	return &memoryPaymentStore{payments: make(map[string]Payment), events: outbox.NewMemory()}
+}
+
+func (s *memoryPaymentStore) List(ctx context.Context, page paginate.Params) (paginate.Page[Payment], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return paginate.Slice(slices.Collect(maps.Values(s.payments)), page, paymentKey), nil
+}
+
+func (s *memoryPaymentStore) Get(ctx context.Context, id string) (*Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[id]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	return &p, nil
+}
+
+func (s *memoryPaymentStore) GetByOrder(ctx context.Context, orderID string) (*Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.byOrder(orderID); ok {
+		return &p, nil
+	}
+	return nil, ErrPaymentNotFound
+}
+
+func (s *memoryPaymentStore) byOrder(orderID string) (Payment, bool) {
+	for _, p := range s.payments {
+		if p.OrderID == orderID {
+			return p, true
+		}
+	}
+	return Payment{}, false
+}
+
+func (s *memoryPaymentStore) Create(ctx context.Context, p *Payment) error {
+	event, err := paymentCreated(p)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.OrderID != "" {
+		if _, taken := s.byOrder(p.OrderID); taken {
+			return ErrOrderHasPayment
+		}
+	}
+	s.payments[p.ID] = *p
+	return s.events.Append(ctx, event)
+}
+
+func (s *memoryPaymentStore) Update(ctx context.Context, p *Payment, from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.payments[p.ID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if existing.Status != from {
+		return ErrPaymentChanged
+	}
+	existing.Amount = p.Amount
+	existing.Status = p.Status
+	existing.UpdatedAt = p.UpdatedAt
+	events, err := paymentUpdated(&existing, from)
+	if err != nil {
+		return err
+	}
+	s.payments[p.ID] = existing
+	return s.events.Append(ctx, events...)
+}
+
+func (s *memoryPaymentStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.payments[id]; !ok {
+		return ErrPaymentNotFound
+	}
+	delete(s.payments, id)
+	return nil
+}
+
+func (s *memoryPaymentStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *memoryPaymentStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryPaymentStore) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package paymentsservice
+
+import (
+	"context"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoPaymentStore struct {
+	coll   *mongo.Collection
+	events *outbox.Mongo
+}
+
+func (s *mongoPaymentStore) List(ctx context.Context, page paginate.Params) (paginate.Page[Payment], error) {
+	fields := paginate.Fields{CreatedAt: "created_at", ID: "id"}
+	return paginate.MongoFind(ctx, s.coll, bson.D{}, page, fields, paymentKey)
+}
+
+func (s *mongoPaymentStore) Get(ctx context.Context, id string) (*Payment, error) {
+	var p Payment
+	err := s.coll.FindOne(ctx, bson.M{"id": id}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *mongoPaymentStore) GetByOrder(ctx context.Context, orderID string) (*Payment, error) {
+	var p Payment
+	err := s.coll.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *mongoPaymentStore) Create(ctx context.Context, p *Payment) error {
+	event, err := paymentCreated(p)
+	if err != nil {
+		return err
+	}
+	return s.events.Transact(ctx, func(ctx context.Context) error {
+		_, err := s.coll.InsertOne(ctx, p)
+		if mongo.IsDuplicateKeyError(err) && p.OrderID != "" {
+			// The unique index on order_id
+			return ErrOrderHasPayment
+		} else if err != nil {
+			return err
+		}
+		return s.events.Append(ctx, event)
+	})
+}
+
+func (s *mongoPaymentStore) Update(ctx context.Context, p *Payment, from string) error {
+	update := bson.M{"$set": bson.M{
+		"amount":     p.Amount,
+		"status":     p.Status,
+		"updated_at": p.UpdatedAt,
+	}}
+	return s.events.Transact(ctx, func(ctx context.Context) error {
+		// Matching on the current status makes the update a compare-and-set
+		var updated Payment
+		err := s.coll.FindOneAndUpdate(ctx, bson.M{"id": p.ID, "status": from}, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			// Tell a missing payment apart from one whose status moved on
+			n, err := s.coll.CountDocuments(ctx, bson.M{"id": p.ID}, options.Count().SetLimit(1))
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrPaymentNotFound
+			}
+			return ErrPaymentChanged
+		} else if err != nil {
+			return err
+		}
+		events, err := paymentUpdated(&updated, from)
+		if err != nil {
+			return err
+		}
+		return s.events.Append(ctx, events...)
+	})
+}
+
+func (s *mongoPaymentStore) Delete(ctx context.Context, id string) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrPaymentNotFound
+	}
+	return nil
+}
+
+func (s *mongoPaymentStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *mongoPaymentStore) Ping(ctx context.Context) error {
+	return s.coll.Database().Client().Ping(ctx, nil)
+}
+
+func (s *mongoPaymentStore) Close(ctx context.Context) error {
+	return s.coll.Database().Client().Disconnect(ctx)
+}
@@ -0,0 +1,168 @@
+package paymentsservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/outbox"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+type postgresPaymentStore struct {
+	pool   *pgxpool.Pool
+	events *outbox.Postgres
+}
+
+func (s *postgresPaymentStore) List(ctx context.Context, page paginate.Params) (paginate.Page[Payment], error) {
+	columns := paginate.Fields{CreatedAt: "created_at", ID: "id"}
+	where, args := page.SQLWhere(columns, nil)
+	rows, err := s.pool.Query(ctx, `SELECT id, order_id, amount_minor, currency, status, created_at, updated_at
+		FROM payments
+		WHERE `+where+`
+		`+page.SQLOrder(columns), args...)
+	if err != nil {
+		return paginate.Page[Payment]{}, err
+	}
+	payments, err := pgx.CollectRows(rows, scanPayment)
+	if err != nil {
+		return paginate.Page[Payment]{}, err
+	}
+	result := paginate.NewPage(payments, page, paymentKey)
+	if page.Total {
+		where, args := page.Unpaged().SQLWhere(columns, nil)
+		var total int64
+		if err := s.pool.QueryRow(ctx, `SELECT count(*) FROM payments WHERE `+where, args...).Scan(&total); err != nil {
+			return paginate.Page[Payment]{}, err
+		}
+		result.Total = &total
+	}
+	return result, nil
+}
+
+func (s *postgresPaymentStore) Get(ctx context.Context, id string) (*Payment, error) {
+	return s.getOne(ctx, `WHERE id = $1`, id)
+}
+
+func (s *postgresPaymentStore) GetByOrder(ctx context.Context, orderID string) (*Payment, error) {
+	return s.getOne(ctx, `WHERE order_id = $1`, orderID)
+}
+
+func (s *postgresPaymentStore) getOne(ctx context.Context, where string, args ...any) (*Payment, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id, order_id, amount_minor, currency, status, created_at, updated_at
+		FROM payments
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pgx.CollectOneRow(rows, scanPayment)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// uniqueViolation is the SQLSTATE Postgres reports for a duplicate key
+const uniqueViolation = "23505"
+
+func (s *postgresPaymentStore) Create(ctx context.Context, p *Payment) error {
+	event, err := paymentCreated(p)
+	if err != nil {
+		return err
+	}
+	var orderID *string
+	if p.OrderID != "" {
+		orderID = &p.OrderID
+	}
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO payments
+			(id, order_id, amount_minor, currency, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			p.ID, orderID, p.Amount.Minor(), p.Amount.Currency(), p.Status, p.CreatedAt, p.UpdatedAt)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "payments_order_id_key" {
+			return ErrOrderHasPayment
+		} else if err != nil {
+			return err
+		}
+		return s.events.Append(ctx, tx, event)
+	})
+}
+
+func (s *postgresPaymentStore) Update(ctx context.Context, p *Payment, from string) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// Matching on the current status makes the update a compare-and-set
+		rows, err := tx.Query(ctx, `UPDATE payments
+			SET amount_minor = $2, currency = $3, status = $4, updated_at = $5
+			WHERE id = $1 AND status = $6
+			RETURNING id, order_id, amount_minor, currency, status, created_at, updated_at`,
+			p.ID, p.Amount.Minor(), p.Amount.Currency(), p.Status, p.UpdatedAt, from)
+		if err != nil {
+			return err
+		}
+		updated, err := pgx.CollectOneRow(rows, scanPayment)
+		if err == nil {
+			events, err := paymentUpdated(&updated, from)
+			if err != nil {
+				return err
+			}
+			return s.events.Append(ctx, tx, events...)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		// Tell a missing payment apart from one whose status moved on
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM payments WHERE id = $1)`, p.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPaymentNotFound
+		}
+		return ErrPaymentChanged
+	})
+}
+
+func (s *postgresPaymentStore) Delete(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM payments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPaymentNotFound
+	}
+	return nil
+}
+
+func (s *postgresPaymentStore) Outbox() outbox.Store {
+	return s.events
+}
+
+func (s *postgresPaymentStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *postgresPaymentStore) Close(ctx context.Context) error {
+	s.pool.Close()
+	return nil
+}
+
+func scanPayment(row pgx.CollectableRow) (Payment, error) {
+	var p Payment
+	var orderID *string
+	var amount int64
+	var currency string
+	err := row.Scan(&p.ID, &orderID, &amount, &currency, &p.Status, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	if orderID != nil {
+		p.OrderID = *orderID
+	}
+	p.Amount, err = money.New(amount, currency)
+	return p, err
+}
@@ -0,0 +1,145 @@
+package paymentsservice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/obakengphikiso/go-monorepo/libs/shared/dbtest"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/ids"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/money"
+	"github.com/obakengphikiso/go-monorepo/libs/shared/paginate"
+)
+
+// newPostgresStore returns a store on a freshly migrated schema, skipping
+// the test if no Postgres is configured
+func newPostgresStore(t *testing.T) PaymentStore {
+	t.Helper()
+	return NewPostgresStore(dbtest.Postgres(t, os.DirFS("../migrations")))
+}
+
+// testPayment returns a pending payment of 25.00 USD for orderID, not yet
+// stored
+func testPayment(t *testing.T, orderID string) *Payment {
+	t.Helper()
+	id, err := ids.New(ids.Payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount, err := money.New(2500, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Postgres keeps microseconds
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return &Payment{
+		ID:        id,
+		OrderID:   orderID,
+		Amount:    amount,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestPostgresStoreCRUD(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	p := testPayment(t, "ord_1")
+	if err := store.Create(ctx, p); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Create(ctx, testPayment(t, "")); err != nil {
+		t.Fatalf("Create without order: %v", err)
+	}
+
+	got, err := store.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.OrderID != p.OrderID || got.Amount != p.Amount || got.Status != p.Status || !got.CreatedAt.Equal(p.CreatedAt) {
+		t.Errorf("Get = %+v, want %+v", got, p)
+	}
+	if got, err := store.GetByOrder(ctx, "ord_1"); err != nil || got.ID != p.ID {
+		t.Errorf("GetByOrder = %v, %v; want %s", got, err, p.ID)
+	}
+	if _, err := store.GetByOrder(ctx, "ord_2"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("GetByOrder of an order without payment: err = %v, want ErrPaymentNotFound", err)
+	}
+
+	page, err := store.List(ctx, paginate.Params{Limit: 1, Total: true})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 1 || page.Total == nil || *page.Total != 2 || page.NextCursor == "" {
+		t.Errorf("List = %d items, total %v, next %q; want 1 of 2 and a cursor", len(page.Items), page.Total, page.NextCursor)
+	}
+
+	if err := store.Delete(ctx, p.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, p.ID); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrPaymentNotFound", err)
+	}
+	if err := store.Delete(ctx, p.ID); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Delete twice: err = %v, want ErrPaymentNotFound", err)
+	}
+}
+
+func TestPostgresStoreOrderHasOnePayment(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	if err := store.Create(ctx, testPayment(t, "ord_1")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Create(ctx, testPayment(t, "ord_1")); !errors.Is(err, ErrOrderHasPayment) {
+		t.Errorf("Create for the same order: err = %v, want ErrOrderHasPayment", err)
+	}
+}
+
+func TestPostgresStoreUpdate(t *testing.T) {
+	store := newPostgresStore(t)
+	ctx := context.Background()
+
+	p := testPayment(t, "ord_1")
+	if err := store.Create(ctx, p); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	completed := *p
+	completed.Status = StatusCompleted
+	completed.UpdatedAt = p.CreatedAt.Add(time.Second)
+	if err := store.Update(ctx, &completed, StatusPending); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// The payment is no longer pending, so a second writer loses the race
+	failed := *p
+	failed.Status = StatusFailed
+	if err := store.Update(ctx, &failed, StatusPending); !errors.Is(err, ErrPaymentChanged) {
+		t.Errorf("Update from a stale status: err = %v, want ErrPaymentChanged", err)
+	}
+	missing := testPayment(t, "")
+	if err := store.Update(ctx, missing, StatusPending); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Update of a missing payment: err = %v, want ErrPaymentNotFound", err)
+	}
+
+	got, err := store.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != StatusCompleted || !got.UpdatedAt.Equal(completed.UpdatedAt) {
+		t.Errorf("payment is %s updated at %v, want completed at %v", got.Status, got.UpdatedAt, completed.UpdatedAt)
+	}
+
+	events, err := store.Outbox().Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != EventPaymentCreated || events[1].Type != EventPaymentSucceeded || events[1].Sequence != 2 {
+		t.Errorf("outbox = %+v, want payment.created then payment.succeeded", events)
+	}
+}